@@ -4,12 +4,17 @@ go 1.24.1
 
 require (
 	github.com/alpacahq/alpaca-trade-api-go/v3 v3.8.1
+	github.com/coder/websocket v1.8.12
 	github.com/dgraph-io/badger/v4 v4.8.0
+	github.com/ethereum/go-ethereum v1.16.2
 	github.com/go-chi/chi/v5 v5.2.2
 	github.com/hiero-ledger/hiero-sdk-go/v2 v2.67.0
 	github.com/holiman/uint256 v1.3.2
 	github.com/imroc/req/v3 v3.54.0
 	github.com/joho/godotenv v1.5.1
+	github.com/shopspring/decimal v1.3.1
+	github.com/vmihailenco/msgpack/v5 v5.3.0
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
@@ -37,7 +42,6 @@ require (
 	github.com/dgraph-io/ristretto/v2 v2.2.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/ethereum/c-kzg-4844/v2 v2.1.0 // indirect
-	github.com/ethereum/go-ethereum v1.16.2 // indirect
 	github.com/ethereum/go-verkle v0.2.2 // indirect
 	github.com/go-logr/logr v1.4.3 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
@@ -51,8 +55,8 @@ require (
 	github.com/quic-go/qpack v0.5.1 // indirect
 	github.com/quic-go/quic-go v0.53.0 // indirect
 	github.com/refraction-networking/utls v1.7.3 // indirect
-	github.com/shopspring/decimal v1.3.1 // indirect
 	github.com/supranational/blst v0.3.14 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
 	go.opentelemetry.io/otel v1.37.0 // indirect
@@ -69,5 +73,4 @@ require (
 	golang.org/x/tools v0.34.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250603155806-513f23925822 // indirect
 	google.golang.org/grpc v1.73.0 // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
 )
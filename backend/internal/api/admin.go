@@ -0,0 +1,24 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+)
+
+// AdminOnly guards admin routes with the ADMIN_API_KEY bearer token. Admin routes are
+// disabled entirely when no key is configured.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminKey := os.Getenv("ADMIN_API_KEY")
+		if adminKey == "" {
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+adminKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
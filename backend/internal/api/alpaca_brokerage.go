@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+// AlpacaBrokerage is an Alpaca trading account. Quotes come from MarketData, which is the
+// platform's data subscription rather than the account's. Alpaca cannot lock shares, so
+// locks on Alpaca accounts are enforced by monitoring instead.
+type AlpacaBrokerage struct {
+	Client     *alpaca.Client
+	MarketData *marketdata.Client
+}
+
+func NewAlpacaBrokerage(client *alpaca.Client, marketData *marketdata.Client) *AlpacaBrokerage {
+	return &AlpacaBrokerage{Client: client, MarketData: marketData}
+}
+
+func decimalOrZero(d *decimal.Decimal) decimal.Decimal {
+	if d == nil {
+		return decimal.Zero
+	}
+	return *d
+}
+
+func fromAlpacaPosition(position alpaca.Position) BrokeragePosition {
+	return BrokeragePosition{
+		Symbol:        position.Symbol,
+		Qty:           position.Qty,
+		QtyAvailable:  position.QtyAvailable,
+		AvgEntryPrice: position.AvgEntryPrice,
+		CurrentPrice:  decimalOrZero(position.CurrentPrice),
+		ChangeToday:   decimalOrZero(position.ChangeToday),
+		MarketValue:   decimalOrZero(position.MarketValue),
+		CostBasis:     position.CostBasis,
+		UnrealizedPL:  decimalOrZero(position.UnrealizedPL),
+	}
+}
+
+func (a *AlpacaBrokerage) Provider() string {
+	return BrokerageAlpaca
+}
+
+func (a *AlpacaBrokerage) Account() (BrokerageAccount, error) {
+	account, err := a.Client.GetAccount()
+	if err != nil {
+		return BrokerageAccount{}, err
+	}
+	return BrokerageAccount{
+		Provider:       BrokerageAlpaca,
+		AccountNumber:  account.AccountNumber,
+		Status:         account.Status,
+		Currency:       account.Currency,
+		Cash:           account.Cash,
+		Equity:         account.Equity,
+		PortfolioValue: account.PortfolioValue,
+	}, nil
+}
+
+func (a *AlpacaBrokerage) Positions() ([]BrokeragePosition, error) {
+	positions, err := a.Client.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	normalized := []BrokeragePosition{}
+	for _, position := range positions {
+		normalized = append(normalized, fromAlpacaPosition(position))
+	}
+	return normalized, nil
+}
+
+func (a *AlpacaBrokerage) Position(symbol string) (BrokeragePosition, error) {
+	position, err := a.Client.GetPosition(symbol)
+	var apiErr *alpaca.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return BrokeragePosition{}, ErrPositionNotFound
+	}
+	if err != nil {
+		return BrokeragePosition{}, err
+	}
+	return fromAlpacaPosition(*position), nil
+}
+
+// PortfolioHistory asks Alpaca for whole days, which is all its client can express, and
+// trims the result to Start and End.
+func (a *AlpacaBrokerage) PortfolioHistory(request PortfolioHistoryRequest) (PortfolioHistory, error) {
+	period := request.Period
+	if !request.Start.IsZero() {
+		end := request.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		period = fmt.Sprintf("%dD", int(end.Sub(request.Start).Hours()/24)+1)
+	}
+	history, err := a.Client.GetPortfolioHistory(alpaca.GetPortfolioHistoryRequest{
+		Period:        period,
+		TimeFrame:     alpaca.TimeFrame(request.Timeframe),
+		DateEnd:       request.End,
+		ExtendedHours: request.ExtendedHours,
+	})
+	if err != nil {
+		return PortfolioHistory{}, err
+	}
+	trimmed := PortfolioHistory{
+		Timeframe: string(history.Timeframe),
+		BaseValue: history.BaseValue,
+	}
+	for j, timestamp := range history.Timestamp {
+		if (!request.Start.IsZero() && timestamp < request.Start.Unix()) || (!request.End.IsZero() && timestamp > request.End.Unix()) {
+			continue
+		}
+		if j >= len(history.Equity) || j >= len(history.ProfitLoss) || j >= len(history.ProfitLossPct) {
+			break
+		}
+		trimmed.Timestamps = append(trimmed.Timestamps, timestamp)
+		trimmed.Equity = append(trimmed.Equity, history.Equity[j])
+		trimmed.ProfitLoss = append(trimmed.ProfitLoss, history.ProfitLoss[j])
+		trimmed.ProfitLossPct = append(trimmed.ProfitLossPct, history.ProfitLossPct[j])
+	}
+	return trimmed, nil
+}
+
+func (a *AlpacaBrokerage) StreamTradeUpdates(ctx context.Context, since time.Time, handler func(TradeUpdate)) error {
+	// Alpaca's since is inclusive
+	if !since.IsZero() {
+		since = since.Add(time.Nanosecond)
+	}
+	return a.Client.StreamTradeUpdates(ctx, func(update alpaca.TradeUpdate) {
+		handler(TradeUpdate{
+			Event:       update.Event,
+			OrderId:     update.Order.ID,
+			Symbol:      update.Order.Symbol,
+			Side:        string(update.Order.Side),
+			Qty:         decimalOrZero(update.Qty),
+			Price:       decimalOrZero(update.Price),
+			PositionQty: update.PositionQty,
+			At:          update.At,
+		})
+	}, alpaca.StreamTradeUpdatesRequest{Since: since})
+}
+
+func (a *AlpacaBrokerage) Quote(symbol string) (Quote, error) {
+	return latestQuote(a.MarketData, symbol)
+}
+
+// latestQuote reads the latest IEX quote and trade of symbol, from the stream when it is
+// recent enough.
+func latestQuote(marketData *marketdata.Client, symbol string) (Quote, error) {
+	if quote, ok := livePrice(symbol); ok {
+		return quote, nil
+	}
+	if marketData == nil {
+		return Quote{}, ErrBrokerageUnsupported
+	}
+	trade, err := marketData.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{Feed: marketdata.IEX})
+	if err != nil {
+		return Quote{}, err
+	}
+	quote, err := marketData.GetLatestQuote(symbol, marketdata.GetLatestQuoteRequest{Feed: marketdata.IEX})
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{
+		Symbol:    symbol,
+		BidPrice:  quote.BidPrice,
+		AskPrice:  quote.AskPrice,
+		LastPrice: trade.Price,
+		Timestamp: trade.Timestamp,
+	}, nil
+}
+
+func (a *AlpacaBrokerage) PlaceOrder(request OrderRequest) (Order, error) {
+	side := alpaca.Buy
+	if request.Side == OrderSideSell {
+		side = alpaca.Sell
+	}
+	order, err := a.Client.PlaceOrder(alpaca.PlaceOrderRequest{
+		Symbol:        request.Symbol,
+		Qty:           &request.Qty,
+		Side:          side,
+		Type:          alpaca.Market,
+		TimeInForce:   alpaca.Day,
+		ClientOrderID: request.ClientOrderId,
+	})
+	if err != nil {
+		return Order{}, err
+	}
+	return Order{
+		Id:            order.ID,
+		ClientOrderId: order.ClientOrderID,
+		Symbol:        order.Symbol,
+		Qty:           decimalOrZero(order.Qty),
+		Side:          string(order.Side),
+		Status:        order.Status,
+	}, nil
+}
+
+func (a *AlpacaBrokerage) LockShares(symbol string, qty decimal.Decimal) error {
+	return ErrBrokerageUnsupported
+}
+
+func (a *AlpacaBrokerage) UnlockShares(symbol string, qty decimal.Decimal) error {
+	return ErrBrokerageUnsupported
+}
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const assetPrefix = "asset:"
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetExists   = errors.New("asset already registered")
+)
+
+// AssetRecord maps a brokerage stock to the HTS token it is tokenized as. MaxSupply is in
+// the token's smallest unit and 0 means unlimited.
+type AssetRecord struct {
+	Symbol        string `json:"symbol"`
+	TokenId       string `json:"tokenId"`
+	TokenSymbol   string `json:"tokenSymbol"`
+	Name          string `json:"name"`
+	Decimals      int    `json:"decimals"`
+	KycRequired   bool   `json:"kycRequired"`
+	FreezeDefault bool   `json:"freezeDefault"`
+	MaxSupply     uint64 `json:"maxSupply"`
+	Enabled       bool   `json:"enabled"`
+	TransactionId string `json:"transactionId,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt,omitempty"`
+}
+
+// CreateAssetRequest registers an existing token when TokenId is set and creates a new one
+// with the operator as treasury otherwise.
+type CreateAssetRequest struct {
+	Symbol        string `json:"symbol"`
+	Name          string `json:"name"`
+	TokenId       string `json:"tokenId"`
+	Decimals      int    `json:"decimals"`
+	KycRequired   bool   `json:"kycRequired"`
+	FreezeDefault bool   `json:"freezeDefault"`
+	MaxSupply     uint64 `json:"maxSupply"`
+	Enabled       bool   `json:"enabled"`
+}
+
+type UpdateAssetRequest struct {
+	Enabled     *bool   `json:"enabled"`
+	KycRequired *bool   `json:"kycRequired"`
+	MaxSupply   *uint64 `json:"maxSupply"`
+}
+
+// defaultAssets are the tokens created before the registry existed.
+var defaultAssets = []AssetRecord{
+	{
+		Symbol:      "AAPL",
+		TokenId:     "0.0.6509511",
+		TokenSymbol: "dAAPL",
+		Name:        "Apple Inc",
+		Decimals:    2,
+		Enabled:     true,
+	},
+}
+
+// AssetRegistry keeps the stocks the backend tokenizes, keyed by their brokerage symbol.
+type AssetRegistry struct {
+	DB *badger.DB
+}
+
+func NewAssetRegistry(db *badger.DB) *AssetRegistry {
+	return &AssetRegistry{DB: db}
+}
+
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// Units converts a share quantity to the token's smallest unit, dropping any fraction of a
+// share finer than the token's decimals. It returns the shares the units represent.
+func (asset AssetRecord) Units(shares decimal.Decimal) (decimal.Decimal, int64, error) {
+	units := shares.Shift(int32(asset.Decimals)).Truncate(0)
+	if units.IsNegative() {
+		return decimal.Zero, 0, fmt.Errorf("negative quantity %s", shares)
+	}
+	if !units.BigInt().IsInt64() {
+		return decimal.Zero, 0, fmt.Errorf("%s shares of %s overflow the token's supply", shares, asset.Symbol)
+	}
+	return asset.Shares(units.IntPart()), units.IntPart(), nil
+}
+
+// Shares converts an amount in the token's smallest unit to shares.
+func (asset AssetRecord) Shares(units int64) decimal.Decimal {
+	return decimal.New(units, -int32(asset.Decimals))
+}
+
+func (a *AssetRegistry) put(record AssetRecord) error {
+	marshaledRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return a.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(assetPrefix+record.Symbol), marshaledRecord)
+	})
+}
+
+func defaultAsset(symbol string) (AssetRecord, bool) {
+	for _, record := range defaultAssets {
+		if record.Symbol == symbol {
+			return record, true
+		}
+	}
+	return AssetRecord{}, false
+}
+
+// Get returns a registered asset. The default assets are registered the first time they are
+// asked for.
+func (a *AssetRegistry) Get(symbol string) (AssetRecord, error) {
+	symbol = normalizeSymbol(symbol)
+	var record AssetRecord
+	err := a.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(assetPrefix + symbol))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+	})
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		return AssetRecord{}, err
+	}
+	record, ok := defaultAsset(symbol)
+	if !ok {
+		return AssetRecord{}, ErrAssetNotFound
+	}
+	record.CreatedAt = time.Now().Format(time.RFC3339)
+	return record, a.put(record)
+}
+
+func (a *AssetRegistry) List() ([]AssetRecord, error) {
+	records := []AssetRecord{}
+	registered := map[string]bool{}
+	err := a.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(assetPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var record AssetRecord
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &record)
+			})
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			registered[record.Symbol] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range defaultAssets {
+		if registered[record.Symbol] {
+			continue
+		}
+		record, err := a.Get(record.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Eligible returns the asset a position in symbol can be tokenized as, if any.
+func (a *AssetRegistry) Eligible(symbol string) (AssetRecord, bool, error) {
+	record, err := a.Get(symbol)
+	if errors.Is(err, ErrAssetNotFound) {
+		return AssetRecord{}, false, nil
+	}
+	if err != nil {
+		return AssetRecord{}, false, err
+	}
+	return record, record.Enabled && record.TokenId != "", nil
+}
+
+// Create registers a stock. With a token id the token's symbol and decimals are read from
+// the mirror node, without one a new fungible token is created with the operator as
+// treasury and admin, wipe, pause, freeze and supply key, plus the KYC key when required.
+func (a *AssetRegistry) Create(request CreateAssetRequest) (AssetRecord, error) {
+	symbol := normalizeSymbol(request.Symbol)
+	if symbol == "" {
+		return AssetRecord{}, errors.New("missing symbol")
+	}
+	if _, err := a.Get(symbol); err == nil {
+		return AssetRecord{}, ErrAssetExists
+	} else if !errors.Is(err, ErrAssetNotFound) {
+		return AssetRecord{}, err
+	}
+	record := AssetRecord{
+		Symbol:        symbol,
+		TokenId:       request.TokenId,
+		TokenSymbol:   tokenizedSymbol(symbol),
+		Name:          request.Name,
+		Decimals:      request.Decimals,
+		KycRequired:   request.KycRequired,
+		FreezeDefault: request.FreezeDefault,
+		MaxSupply:     request.MaxSupply,
+		Enabled:       request.Enabled,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	}
+	if record.Name == "" {
+		record.Name = symbol
+	}
+
+	if record.TokenId != "" {
+		if _, err := hiero.TokenIDFromString(record.TokenId); err != nil {
+			return AssetRecord{}, fmt.Errorf("invalid token id %q", record.TokenId)
+		}
+		token, err := getTokenInfo(record.TokenId)
+		if err != nil {
+			return AssetRecord{}, err
+		}
+		record.TokenSymbol = token.Symbol
+		record.Decimals, err = strconv.Atoi(token.Decimals)
+		if err != nil {
+			return AssetRecord{}, err
+		}
+		return record, a.put(record)
+	}
+
+	tokenId, txId, err := createAssetToken(record)
+	if err != nil {
+		return AssetRecord{}, err
+	}
+	record.TokenId = tokenId
+	record.TransactionId = txId
+	return record, a.put(record)
+}
+
+func createAssetToken(record AssetRecord) (string, string, error) {
+	operatorId, err := hiero.AccountIDFromString(os.Getenv("MY_ACCOUNT_ID"))
+	if err != nil {
+		return "", "", err
+	}
+	operatorKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return "", "", err
+	}
+	client, err := newOperatorClient()
+	if err != nil {
+		return "", "", err
+	}
+	defer client.Close()
+
+	transaction := hiero.NewTokenCreateTransaction().
+		SetTransactionMemo(fmt.Sprintf("%s - %s Fungible Token", record.Name, record.TokenSymbol)).
+		SetTokenType(hiero.TokenTypeFungibleCommon).
+		SetTokenName(record.Name).
+		SetTokenSymbol(record.TokenSymbol).
+		SetDecimals(uint(record.Decimals)).
+		SetInitialSupply(0).
+		SetTreasuryAccountID(operatorId).
+		SetAdminKey(operatorKey.PublicKey()).
+		SetWipeKey(operatorKey.PublicKey()).
+		SetPauseKey(operatorKey.PublicKey()).
+		SetFreezeKey(operatorKey.PublicKey()).
+		SetSupplyKey(operatorKey.PublicKey()).
+		SetFreezeDefault(record.FreezeDefault).
+		SetMaxTransactionFee(hiero.HbarFrom(100, hiero.HbarUnits.Hbar))
+	if record.KycRequired {
+		transaction.SetKycKey(operatorKey.PublicKey())
+	}
+	if record.MaxSupply > 0 {
+		transaction.SetSupplyType(hiero.TokenSupplyTypeFinite).SetMaxSupply(int64(record.MaxSupply))
+	}
+	frozen, err := transaction.FreezeWith(client)
+	if err != nil {
+		return "", "", err
+	}
+	txResponse, err := frozen.Sign(operatorKey).Execute(client)
+	if err != nil {
+		return "", "", err
+	}
+	receipt, err := txResponse.GetReceipt(client)
+	if err != nil {
+		return "", txResponse.TransactionID.String(), err
+	}
+	if receipt.TokenID == nil {
+		return "", txResponse.TransactionID.String(), errors.New("token create receipt has no token id")
+	}
+	fmt.Printf("Created %s as token %s\n", record.TokenSymbol, receipt.TokenID.String())
+	return receipt.TokenID.String(), txResponse.TransactionID.String(), nil
+}
+
+// Update changes an asset's flags. Decimals and the token id are fixed once registered.
+func (a *AssetRegistry) Update(symbol string, request UpdateAssetRequest) (AssetRecord, error) {
+	record, err := a.Get(symbol)
+	if err != nil {
+		return AssetRecord{}, err
+	}
+	if request.Enabled != nil {
+		record.Enabled = *request.Enabled
+	}
+	if request.KycRequired != nil {
+		record.KycRequired = *request.KycRequired
+	}
+	if request.MaxSupply != nil {
+		record.MaxSupply = *request.MaxSupply
+	}
+	record.UpdatedAt = time.Now().Format(time.RFC3339)
+	return record, a.put(record)
+}
+
+func (a *AssetRegistry) HandleListAssets(w http.ResponseWriter, r *http.Request) {
+	assets, err := a.List()
+	if err != nil {
+		fmt.Println("Error listing assets: ", err)
+		http.Error(w, "Failed to list assets", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]AssetRecord{
+		"assets": assets,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode assets", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *AssetRegistry) HandleCreateAsset(w http.ResponseWriter, r *http.Request) {
+	var request CreateAssetRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Failed to decode asset", http.StatusBadRequest)
+		return
+	}
+	if request.TokenId == "" && (request.Decimals < 0 || request.Decimals > 18) {
+		http.Error(w, "Decimals must be between 0 and 18", http.StatusBadRequest)
+		return
+	}
+
+	record, err := a.Create(request)
+	if errors.Is(err, ErrAssetExists) {
+		http.Error(w, "Asset already registered", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error creating asset: ", err)
+		http.Error(w, "Failed to create asset", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]AssetRecord{
+		"asset": record,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode asset", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *AssetRegistry) HandleUpdateAsset(w http.ResponseWriter, r *http.Request) {
+	var request UpdateAssetRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Failed to decode asset", http.StatusBadRequest)
+		return
+	}
+
+	record, err := a.Update(chi.URLParam(r, "symbol"), request)
+	if errors.Is(err, ErrAssetNotFound) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error updating asset: ", err)
+		http.Error(w, "Failed to update asset", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]AssetRecord{
+		"asset": record,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode asset", http.StatusInternalServerError)
+		return
+	}
+}
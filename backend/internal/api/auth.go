@@ -0,0 +1,385 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	"github.com/hiero-ledger/hiero-sdk-go/v2/proto/services"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	authChallengePrefix = "auth-challenge:"
+	authSessionPrefix   = "auth-session:"
+	SessionCookieName   = "hashrexa_session"
+	// hedera_signMessage signs the message behind this prefix and its length
+	hederaMessagePrefix = "\x19Hedera Signed Message:\n"
+)
+
+var (
+	defaultChallengeTTL = 5 * time.Minute
+	defaultSessionTTL   = 24 * time.Hour
+
+	ErrUnauthenticated    = errors.New("not signed in")
+	errChallengeNotFound  = errors.New("no challenge pending, or it expired")
+	errSignatureInvalid   = errors.New("signature does not match the account key")
+	errUnsupportedAuthKey = errors.New("only accounts with a single ED25519 or ECDSA key can sign in")
+)
+
+// AuthChallenge is the message a user signs with their account key to sign in. Each one is
+// good for a single sign-in.
+type AuthChallenge struct {
+	UserAccountId string `json:"userAccountId"`
+	Message       string `json:"message"`
+	ExpiresAt     int64  `json:"expiresAt"`
+}
+
+// AuthSession is a signed-in user. Only a hash of its token is stored.
+type AuthSession struct {
+	Token         string `json:"token,omitempty"`
+	UserAccountId string `json:"userAccountId"`
+	CreatedAt     int64  `json:"createdAt"`
+	ExpiresAt     int64  `json:"expiresAt"`
+}
+
+// SignInRequest carries the signed challenge. SignatureMap is what hedera_signMessage
+// returns: a base64 SignatureMap over the prefixed message.
+type SignInRequest struct {
+	Message      string `json:"message"`
+	SignatureMap string `json:"signatureMap"`
+}
+
+// Authenticator signs users in by having them sign a challenge with their Hedera account key,
+// and guards the routes that act on a user's behalf. AccountKey looks up the key an account
+// signs with; it reads the mirror node unless replaced.
+type Authenticator struct {
+	DB           *badger.DB
+	ChallengeTTL time.Duration
+	SessionTTL   time.Duration
+	SecureCookie bool
+	AccountKey   func(userAccountId string) (hiero.PublicKey, error)
+}
+
+func NewAuthenticator(db *badger.DB) *Authenticator {
+	a := &Authenticator{
+		DB:           db,
+		ChallengeTTL: defaultChallengeTTL,
+		SessionTTL:   defaultSessionTTL,
+		SecureCookie: os.Getenv("AUTH_SECURE_COOKIE") == "true",
+		AccountKey:   mirrorAccountKey,
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("AUTH_SESSION_TTL")); err == nil {
+		a.SessionTTL = ttl
+	}
+	return a
+}
+
+// mirrorAccountKey is the account's key as the mirror node reports it.
+func mirrorAccountKey(userAccountId string) (hiero.PublicKey, error) {
+	var account AccountMNAPIResponse
+	err := mirrorGet("/api/v1/accounts/"+userAccountId, &account)
+	if err != nil {
+		return hiero.PublicKey{}, err
+	}
+	switch account.Key.Type {
+	case "ED25519":
+		return hiero.PublicKeyFromStringEd25519(account.Key.Key)
+	case "ECDSA_SECP256K1":
+		return hiero.PublicKeyFromStringECDSA(account.Key.Key)
+	}
+	return hiero.PublicKey{}, errUnsupportedAuthKey
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sessionKey(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return []byte(authSessionPrefix + hex.EncodeToString(sum[:]))
+}
+
+// Challenge issues a new challenge for the account, replacing any pending one.
+func (a *Authenticator) Challenge(userAccountId string) (AuthChallenge, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return AuthChallenge{}, err
+	}
+	expiresAt := time.Now().Add(a.ChallengeTTL)
+	challenge := AuthChallenge{
+		UserAccountId: userAccountId,
+		Message:       fmt.Sprintf("Sign in to Hashrexa as %s\nNonce: %s\nExpires: %s", userAccountId, nonce, expiresAt.UTC().Format(time.RFC3339)),
+		ExpiresAt:     expiresAt.Unix(),
+	}
+	marshaledChallenge, err := json.Marshal(challenge)
+	if err != nil {
+		return AuthChallenge{}, err
+	}
+	err = a.DB.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(authChallengePrefix+userAccountId), marshaledChallenge).WithTTL(a.ChallengeTTL))
+	})
+	return challenge, err
+}
+
+// takeChallenge returns the account's pending challenge and deletes it, so a signature can
+// only be used once.
+func (a *Authenticator) takeChallenge(userAccountId string) (AuthChallenge, error) {
+	var challenge AuthChallenge
+	err := a.DB.Update(func(txn *badger.Txn) error {
+		key := []byte(authChallengePrefix + userAccountId)
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return errChallengeNotFound
+		}
+		if err != nil {
+			return err
+		}
+		err = item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &challenge)
+		})
+		if err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+	if err == nil && time.Now().Unix() > challenge.ExpiresAt {
+		err = errChallengeNotFound
+	}
+	return challenge, err
+}
+
+// verifySignatureMap checks that the map holds the key's signature over the message, as
+// hedera_signMessage signs it.
+func verifySignatureMap(key hiero.PublicKey, message string, signatureMap string) error {
+	raw, err := base64.StdEncoding.DecodeString(signatureMap)
+	if err != nil {
+		return err
+	}
+	var sigMap services.SignatureMap
+	err = proto.Unmarshal(raw, &sigMap)
+	if err != nil {
+		return err
+	}
+	signed := []byte(fmt.Sprintf("%s%d%s", hederaMessagePrefix, len(message), message))
+	for _, pair := range sigMap.GetSigPair() {
+		signature := pair.GetEd25519()
+		if signature == nil {
+			signature = pair.GetECDSASecp256K1()
+		}
+		if signature != nil && key.VerifySignedMessage(signed, signature) {
+			return nil
+		}
+	}
+	return errSignatureInvalid
+}
+
+// SignIn checks a signed challenge and starts a session for the account.
+func (a *Authenticator) SignIn(userAccountId string, request SignInRequest) (AuthSession, error) {
+	challenge, err := a.takeChallenge(userAccountId)
+	if err != nil {
+		return AuthSession{}, err
+	}
+	if request.Message != challenge.Message {
+		return AuthSession{}, errSignatureInvalid
+	}
+	key, err := a.AccountKey(userAccountId)
+	if err != nil {
+		return AuthSession{}, err
+	}
+	err = verifySignatureMap(key, challenge.Message, request.SignatureMap)
+	if err != nil {
+		return AuthSession{}, err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return AuthSession{}, err
+	}
+	now := time.Now()
+	session := AuthSession{
+		UserAccountId: userAccountId,
+		CreatedAt:     now.Unix(),
+		ExpiresAt:     now.Add(a.SessionTTL).Unix(),
+	}
+	marshaledSession, err := json.Marshal(session)
+	if err != nil {
+		return AuthSession{}, err
+	}
+	err = a.DB.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(sessionKey(token), marshaledSession).WithTTL(a.SessionTTL))
+	})
+	session.Token = token
+	return session, err
+}
+
+func requestToken(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return token
+	}
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Session returns the session the request carries, in its cookie or as a bearer token.
+func (a *Authenticator) Session(r *http.Request) (AuthSession, error) {
+	token := requestToken(r)
+	if token == "" {
+		return AuthSession{}, ErrUnauthenticated
+	}
+	var session AuthSession
+	err := a.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(sessionKey(token))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &session)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return AuthSession{}, ErrUnauthenticated
+	}
+	return session, err
+}
+
+// SessionUser is the account the request is signed in as.
+func (a *Authenticator) SessionUser(r *http.Request) (string, error) {
+	session, err := a.Session(r)
+	return session.UserAccountId, err
+}
+
+type authUserKey struct{}
+
+// AuthenticatedUser is the account RequireUser let the request through as.
+func AuthenticatedUser(ctx context.Context) (string, bool) {
+	userAccountId, ok := ctx.Value(authUserKey{}).(string)
+	return userAccountId, ok
+}
+
+// RequireUser lets a request through only when it is signed in as the route's
+// {userAccountId}.
+func (a *Authenticator) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAccountId, err := a.SessionUser(r)
+		if errors.Is(err, ErrUnauthenticated) {
+			http.Error(w, "Sign in first", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			fmt.Println("Error reading session: ", err)
+			http.Error(w, "Failed to read session", http.StatusInternalServerError)
+			return
+		}
+		if routeUser := chi.URLParam(r, "userAccountId"); routeUser != "" && routeUser != userAccountId {
+			http.Error(w, "Signed in as a different account", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, userAccountId)))
+	})
+}
+
+func (a *Authenticator) HandleChallenge(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if _, err := hiero.AccountIDFromString(userAccountId); err != nil {
+		http.Error(w, "Invalid user account ID", http.StatusBadRequest)
+		return
+	}
+	challenge, err := a.Challenge(userAccountId)
+	if err != nil {
+		fmt.Println("Error creating challenge: ", err)
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]AuthChallenge{
+		"challenge": challenge,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode challenge", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleSignIn exchanges a signed challenge for a session, set as an HttpOnly cookie and
+// returned for clients that send it as a bearer token instead.
+func (a *Authenticator) HandleSignIn(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	var request SignInRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Message == "" || request.SignatureMap == "" {
+		http.Error(w, "message and signatureMap are required", http.StatusBadRequest)
+		return
+	}
+	session, err := a.SignIn(userAccountId, request)
+	if errors.Is(err, errChallengeNotFound) || errors.Is(err, errSignatureInvalid) || errors.Is(err, errUnsupportedAuthKey) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error signing in: ", err)
+		http.Error(w, "Failed to sign in", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		HttpOnly: true,
+		Secure:   a.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]AuthSession{
+		"session": session,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode session", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *Authenticator) HandleSignOut(w http.ResponseWriter, r *http.Request) {
+	if token := requestToken(r); token != "" {
+		err := a.DB.Update(func(txn *badger.Txn) error {
+			return txn.Delete(sessionKey(token))
+		})
+		if err != nil {
+			fmt.Println("Error signing out: ", err)
+			http.Error(w, "Failed to sign out", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
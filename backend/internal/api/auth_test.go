@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hiero-ledger/hiero-sdk-go/v2/proto/services"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"google.golang.org/protobuf/proto"
+)
+
+// signChallenge signs a message the way hedera_signMessage does and returns the
+// base64 signature map.
+func signChallenge(t *testing.T, key hiero.PrivateKey, message string) string {
+	t.Helper()
+	signature := key.Sign([]byte(fmt.Sprintf("%s%d%s", hederaMessagePrefix, len(message), message)))
+	pair := &services.SignaturePair{PubKeyPrefix: key.PublicKey().BytesRaw()}
+	// compressed ECDSA public keys are 33 bytes, ED25519 ones 32
+	if len(pair.PubKeyPrefix) == 33 {
+		pair.Signature = &services.SignaturePair_ECDSASecp256K1{ECDSASecp256K1: signature}
+	} else {
+		pair.Signature = &services.SignaturePair_Ed25519{Ed25519: signature}
+	}
+	raw, err := proto.Marshal(&services.SignatureMap{SigPair: []*services.SignaturePair{pair}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func newTestAuthenticator(t *testing.T, keys map[string]hiero.PrivateKey) *Authenticator {
+	a := NewAuthenticator(newTestDB(t))
+	a.AccountKey = func(userAccountId string) (hiero.PublicKey, error) {
+		key, ok := keys[userAccountId]
+		if !ok {
+			return hiero.PublicKey{}, errUnsupportedAuthKey
+		}
+		return key.PublicKey(), nil
+	}
+	return a
+}
+
+// signIn signs account in with key and returns the session token.
+func signIn(t *testing.T, a *Authenticator, account string, key hiero.PrivateKey) string {
+	t.Helper()
+	challenge, err := a.Challenge(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := a.SignIn(account, SignInRequest{Message: challenge.Message, SignatureMap: signChallenge(t, key, challenge.Message)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.Token
+}
+
+func TestSignIn(t *testing.T) {
+	ed25519Key, _ := hiero.PrivateKeyGenerateEd25519()
+	ecdsaKey, _ := hiero.PrivateKeyGenerateEcdsa()
+	otherKey, _ := hiero.PrivateKeyGenerateEd25519()
+	a := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": ed25519Key, "0.0.1002": ecdsaKey})
+
+	tests := []struct {
+		name    string
+		account string
+		key     hiero.PrivateKey
+		tamper  bool
+		wantErr error
+	}{
+		{name: "ed25519", account: "0.0.1001", key: ed25519Key},
+		{name: "ecdsa", account: "0.0.1002", key: ecdsaKey},
+		{name: "wrong key", account: "0.0.1001", key: otherKey, wantErr: errSignatureInvalid},
+		{name: "other message", account: "0.0.1001", key: ed25519Key, tamper: true, wantErr: errSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := a.Challenge(tt.account)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message := challenge.Message
+			if tt.tamper {
+				message += "!"
+			}
+			session, err := a.SignIn(tt.account, SignInRequest{Message: message, SignatureMap: signChallenge(t, tt.key, message)})
+			if err != tt.wantErr {
+				t.Fatalf("SignIn error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (session.Token == "" || session.UserAccountId != tt.account) {
+				t.Fatalf("unexpected session %+v", session)
+			}
+		})
+	}
+}
+
+func TestChallengeIsSingleUse(t *testing.T) {
+	key, _ := hiero.PrivateKeyGenerateEd25519()
+	a := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": key})
+	challenge, _ := a.Challenge("0.0.1001")
+	request := SignInRequest{Message: challenge.Message, SignatureMap: signChallenge(t, key, challenge.Message)}
+	if _, err := a.SignIn("0.0.1001", request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SignIn("0.0.1001", request); err != errChallengeNotFound {
+		t.Fatalf("replayed sign-in error = %v, want %v", err, errChallengeNotFound)
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	key, _ := hiero.PrivateKeyGenerateEd25519()
+	a := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": key})
+	token := signIn(t, a, "0.0.1001", key)
+
+	r := chi.NewRouter()
+	r.With(a.RequireUser).Get("/portfolio/{userAccountId}", func(w http.ResponseWriter, r *http.Request) {
+		userAccountId, _ := AuthenticatedUser(r.Context())
+		fmt.Fprint(w, userAccountId)
+	})
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		bearer string
+		want   int
+	}{
+		{name: "no session", path: "/portfolio/0.0.1001", want: http.StatusUnauthorized},
+		{name: "unknown token", path: "/portfolio/0.0.1001", bearer: "forged", want: http.StatusUnauthorized},
+		{name: "cookie", path: "/portfolio/0.0.1001", cookie: token, want: http.StatusOK},
+		{name: "bearer", path: "/portfolio/0.0.1001", bearer: token, want: http.StatusOK},
+		{name: "other user", path: "/portfolio/0.0.2002", cookie: token, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.cookie})
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	BrokerageAlpaca = "alpaca"
+	BrokerageManual = "manual"
+
+	OrderSideBuy  = "buy"
+	OrderSideSell = "sell"
+)
+
+var (
+	ErrBrokerageUnsupported = errors.New("not supported by this brokerage")
+	ErrPositionNotFound     = errors.New("no position in symbol")
+	ErrInsufficientShares   = errors.New("not enough unlocked shares")
+)
+
+// Brokerage is a user's account at a brokerage, in provider-neutral terms. Providers that
+// cannot do something return ErrBrokerageUnsupported.
+type Brokerage interface {
+	Provider() string
+	Account() (BrokerageAccount, error)
+	Positions() ([]BrokeragePosition, error)
+	// Position returns ErrPositionNotFound when the account holds none of symbol.
+	Position(symbol string) (BrokeragePosition, error)
+	PortfolioHistory(request PortfolioHistoryRequest) (PortfolioHistory, error)
+	Quote(symbol string) (Quote, error)
+	PlaceOrder(request OrderRequest) (Order, error)
+	// LockShares keeps qty shares of symbol from being sold or withdrawn while they back
+	// tokens; UnlockShares releases them.
+	LockShares(symbol string, qty decimal.Decimal) error
+	UnlockShares(symbol string, qty decimal.Decimal) error
+}
+
+type BrokerageAccount struct {
+	Provider       string          `json:"provider"`
+	AccountNumber  string          `json:"accountNumber"`
+	Status         string          `json:"status"`
+	Currency       string          `json:"currency"`
+	Cash           decimal.Decimal `json:"cash"`
+	Equity         decimal.Decimal `json:"equity"`
+	PortfolioValue decimal.Decimal `json:"portfolioValue"`
+}
+
+// BrokeragePosition is a long position. QtyAvailable excludes shares held for open orders
+// and the Locked shares the brokerage itself keeps from being sold.
+type BrokeragePosition struct {
+	Symbol        string          `json:"symbol"`
+	Qty           decimal.Decimal `json:"qty"`
+	QtyAvailable  decimal.Decimal `json:"qtyAvailable"`
+	AvgEntryPrice decimal.Decimal `json:"avgEntryPrice"`
+	CurrentPrice  decimal.Decimal `json:"currentPrice"`
+	ChangeToday   decimal.Decimal `json:"changeToday"`
+	MarketValue   decimal.Decimal `json:"marketValue"`
+	CostBasis     decimal.Decimal `json:"costBasis"`
+	UnrealizedPL  decimal.Decimal `json:"unrealizedPL"`
+	Locked        decimal.Decimal `json:"locked"`
+}
+
+// PortfolioHistoryRequest covers Period up to End, or Start to End when Start is set. A zero
+// End is now.
+type PortfolioHistoryRequest struct {
+	Period        string
+	Timeframe     string
+	Start         time.Time
+	End           time.Time
+	ExtendedHours bool
+}
+
+// PortfolioHistory is the account's equity and profit over time, one entry per timestamp.
+type PortfolioHistory struct {
+	Timeframe     string            `json:"timeframe"`
+	BaseValue     decimal.Decimal   `json:"baseValue"`
+	Timestamps    []int64           `json:"timestamps"`
+	Equity        []decimal.Decimal `json:"equity"`
+	ProfitLoss    []decimal.Decimal `json:"profitLoss"`
+	ProfitLossPct []decimal.Decimal `json:"profitLossPct"`
+}
+
+type Quote struct {
+	Symbol    string    `json:"symbol"`
+	BidPrice  float64   `json:"bidPrice"`
+	AskPrice  float64   `json:"askPrice"`
+	LastPrice float64   `json:"lastPrice"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OrderRequest is a market order for the day.
+type OrderRequest struct {
+	Symbol        string
+	Qty           decimal.Decimal
+	Side          string
+	ClientOrderId string
+}
+
+type Order struct {
+	Id            string          `json:"id"`
+	ClientOrderId string          `json:"clientOrderId"`
+	Symbol        string          `json:"symbol"`
+	Qty           decimal.Decimal `json:"qty"`
+	Side          string          `json:"side"`
+	Status        string          `json:"status"`
+}
+
+// TradeUpdate is an event in the life of an order, such as a fill. PositionQty is the
+// position in Symbol after the event, when the brokerage reports it.
+type TradeUpdate struct {
+	Event       string           `json:"event"`
+	OrderId     string           `json:"orderId"`
+	Symbol      string           `json:"symbol"`
+	Side        string           `json:"side"`
+	Qty         decimal.Decimal  `json:"qty"`
+	Price       decimal.Decimal  `json:"price"`
+	PositionQty *decimal.Decimal `json:"positionQty,omitempty"`
+	At          time.Time        `json:"at"`
+}
+
+// TradeUpdateStreamer is a brokerage whose order events can be streamed. StreamTradeUpdates
+// calls handler for each update after since until ctx ends or the stream drops.
+type TradeUpdateStreamer interface {
+	StreamTradeUpdates(ctx context.Context, since time.Time, handler func(TradeUpdate)) error
+}
+
+// brokerage is the user's own brokerage account.
+func (u *UserHandler) brokerage(userAccountId string) (Brokerage, error) {
+	return u.Credentials.Brokerage(userAccountId)
+}
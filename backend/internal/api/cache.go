@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// getCached decodes the value cached under key into out, and reports false if there is none.
+func getCached(db *badger.DB, key string, out interface{}) (bool, error) {
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, out)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// setCached caches value under key for ttl. A failure is only logged, the caller has the
+// value either way.
+func setCached(db *badger.DB, key string, value interface{}, ttl time.Duration) {
+	marshaledValue, err := json.Marshal(value)
+	if err == nil {
+		err = db.Update(func(txn *badger.Txn) error {
+			return txn.SetEntry(badger.NewEntry([]byte(key), marshaledValue).WithTTL(ttl))
+		})
+	}
+	if err != nil {
+		fmt.Println("Error caching ", key, ": ", err)
+	}
+}
@@ -0,0 +1,447 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const (
+	brokerageCredentialsPrefix = "brokerage-credentials:"
+	// brokerageAccountPrefix indexes the linked users by brokerage account number
+	brokerageAccountPrefix = "brokerage-account:"
+)
+
+const (
+	alpacaPaperURL = "https://paper-api.alpaca.markets"
+	alpacaLiveURL  = "https://api.alpaca.markets"
+)
+
+const (
+	BrokerageMethodAPIKey = "api_key"
+	BrokerageMethodOAuth  = "oauth"
+)
+
+var (
+	ErrBrokerageNotLinked = errors.New("no brokerage account linked")
+	// one brokerage account backs the tokens of one user only, or each could tokenize it whole
+	ErrBrokerageAccountTaken = errors.New("brokerage account is linked to another user")
+	// the key is 32 bytes, hex encoded, for AES-256-GCM
+	errBrokerageEncryptionKey = errors.New("BROKERAGE_ENCRYPTION_KEY must be 32 hex-encoded bytes")
+)
+
+// BrokerageSecrets are what authenticates a user to Alpaca: an API key pair or an OAuth
+// access token. They are only ever stored encrypted.
+type BrokerageSecrets struct {
+	APIKey     string `json:"apiKey,omitempty"`
+	APISecret  string `json:"apiSecret,omitempty"`
+	OAuthToken string `json:"oauthToken,omitempty"`
+}
+
+// BrokerageCredentials links a Hedera account to a brokerage account. Secrets holds the
+// encrypted BrokerageSecrets, nonce first.
+type BrokerageCredentials struct {
+	UserAccountId string `json:"userAccountId"`
+	Provider      string `json:"provider"`
+	Method        string `json:"method"`
+	AccountNumber string `json:"accountNumber"`
+	Paper         bool   `json:"paper"`
+	Secrets       []byte `json:"secrets,omitempty"`
+	LinkedAt      string `json:"linkedAt"`
+}
+
+type LinkBrokerageRequest struct {
+	APIKey    string `json:"apiKey"`
+	APISecret string `json:"apiSecret"`
+	Paper     *bool  `json:"paper"`
+}
+
+// BrokerageCredentialStore keeps each user's brokerage credentials in badger, encrypted
+// with BROKERAGE_ENCRYPTION_KEY, and opens the brokerage they point to. MarketData prices
+// the accounts.
+type BrokerageCredentialStore struct {
+	DB         *badger.DB
+	MarketData *marketdata.Client
+}
+
+func NewBrokerageCredentialStore(db *badger.DB, marketData *marketdata.Client) *BrokerageCredentialStore {
+	return &BrokerageCredentialStore{DB: db, MarketData: marketData}
+}
+
+func brokerageCipher() (cipher.AEAD, error) {
+	key, err := hex.DecodeString(os.Getenv("BROKERAGE_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, errBrokerageEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBrokerageSecrets encrypts secrets bound to the user they belong to, so a record copied
+// to another user's key does not decrypt.
+func sealBrokerageSecrets(userAccountId string, secrets BrokerageSecrets) ([]byte, error) {
+	aead, err := brokerageCipher()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(userAccountId)), nil
+}
+
+func openBrokerageSecrets(userAccountId string, sealed []byte) (BrokerageSecrets, error) {
+	var secrets BrokerageSecrets
+	aead, err := brokerageCipher()
+	if err != nil {
+		return secrets, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return secrets, errors.New("sealed brokerage secrets are truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(userAccountId))
+	if err != nil {
+		return secrets, err
+	}
+	return secrets, json.Unmarshal(plaintext, &secrets)
+}
+
+// newAlpacaClient builds a trading client for a user's account. ALPACA_BASE_URL overrides
+// the paper and live endpoints, to point users at a stub server.
+func newAlpacaClient(secrets BrokerageSecrets, paper bool) *alpaca.Client {
+	baseURL := alpacaLiveURL
+	if paper {
+		baseURL = alpacaPaperURL
+	}
+	if override := os.Getenv("ALPACA_BASE_URL"); override != "" {
+		baseURL = override
+	}
+	return alpaca.NewClient(alpaca.ClientOpts{
+		APIKey:    secrets.APIKey,
+		APISecret: secrets.APISecret,
+		OAuth:     secrets.OAuthToken,
+		BaseURL:   baseURL,
+	})
+}
+
+func (c *BrokerageCredentialStore) Get(userAccountId string) (BrokerageCredentials, error) {
+	var credentials BrokerageCredentials
+	err := c.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(brokerageCredentialsPrefix + userAccountId))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &credentials)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return credentials, ErrBrokerageNotLinked
+	}
+	return credentials, err
+}
+
+// List returns every linked account.
+func (c *BrokerageCredentialStore) List() ([]BrokerageCredentials, error) {
+	linked := []BrokerageCredentials{}
+	err := c.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(brokerageCredentialsPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var credentials BrokerageCredentials
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &credentials)
+			})
+			if err != nil {
+				return err
+			}
+			linked = append(linked, credentials)
+		}
+		return nil
+	})
+	return linked, err
+}
+
+// Link checks the secrets against Alpaca and stores them for the user, replacing any
+// account linked before unless its shares back outstanding tokens.
+func (c *BrokerageCredentialStore) Link(userAccountId string, secrets BrokerageSecrets, paper bool) (BrokerageCredentials, error) {
+	account, err := newAlpacaClient(secrets, paper).GetAccount()
+	if err != nil {
+		return BrokerageCredentials{}, err
+	}
+	sealed, err := sealBrokerageSecrets(userAccountId, secrets)
+	if err != nil {
+		return BrokerageCredentials{}, err
+	}
+	method := BrokerageMethodAPIKey
+	if secrets.OAuthToken != "" {
+		method = BrokerageMethodOAuth
+	}
+	credentials := BrokerageCredentials{
+		UserAccountId: userAccountId,
+		Provider:      BrokerageAlpaca,
+		Method:        method,
+		AccountNumber: account.AccountNumber,
+		Paper:         paper,
+		Secrets:       sealed,
+		LinkedAt:      time.Now().Format(time.RFC3339),
+	}
+	return credentials, c.put(credentials)
+}
+
+// refuseWhileLocked fails while shares in the user's linked account back outstanding tokens,
+// which must stay with that account.
+func (c *BrokerageCredentialStore) refuseWhileLocked(userAccountId string) error {
+	symbols, err := lockedSymbols(c.DB, userAccountId)
+	if err != nil {
+		return err
+	}
+	if len(symbols) > 0 {
+		return fmt.Errorf("%w: shares of %s back outstanding tokens", ErrInsufficientShares, strings.Join(symbols, ", "))
+	}
+	return nil
+}
+
+// put stores the user's credentials and indexes their account number, refusing an account
+// another user has linked, and a switch to another account while the linked one backs
+// tokens. Links made before the index existed are found by a scan.
+func (c *BrokerageCredentialStore) put(credentials BrokerageCredentials) error {
+	previous, err := c.Get(credentials.UserAccountId)
+	if err == nil && previous.AccountNumber != credentials.AccountNumber {
+		err = c.refuseWhileLocked(credentials.UserAccountId)
+	}
+	if err != nil && !errors.Is(err, ErrBrokerageNotLinked) {
+		return err
+	}
+	marshaledCredentials, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	accountKey := []byte(brokerageAccountPrefix + credentials.AccountNumber)
+	return c.DB.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(accountKey)
+		if err == nil {
+			owner, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if string(owner) != credentials.UserAccountId {
+				return ErrBrokerageAccountTaken
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := []byte(brokerageCredentialsPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var linked BrokerageCredentials
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &linked)
+			})
+			if err != nil {
+				it.Close()
+				return err
+			}
+			if linked.UserAccountId == credentials.UserAccountId {
+				if linked.AccountNumber != credentials.AccountNumber {
+					err = txn.Delete([]byte(brokerageAccountPrefix + linked.AccountNumber))
+				}
+			} else if linked.AccountNumber == credentials.AccountNumber {
+				err = ErrBrokerageAccountTaken
+			}
+			if err != nil {
+				it.Close()
+				return err
+			}
+		}
+		it.Close()
+		err = txn.Set(accountKey, []byte(credentials.UserAccountId))
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte(brokerageCredentialsPrefix+credentials.UserAccountId), marshaledCredentials)
+	})
+}
+
+// LinkManual points the user at their manual holdings. It keeps the original link time when
+// holdings are uploaded again.
+func (c *BrokerageCredentialStore) LinkManual(userAccountId string) error {
+	credentials, err := c.Get(userAccountId)
+	if err == nil && credentials.Provider == BrokerageManual {
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrBrokerageNotLinked) {
+		return err
+	}
+	return c.put(BrokerageCredentials{
+		UserAccountId: userAccountId,
+		Provider:      BrokerageManual,
+		Method:        BrokerageManual,
+		AccountNumber: "manual-" + userAccountId,
+		LinkedAt:      time.Now().Format(time.RFC3339),
+	})
+}
+
+// Unlink forgets the user's brokerage account, revoking its OAuth token first. It refuses
+// while shares in the account back outstanding tokens.
+func (c *BrokerageCredentialStore) Unlink(userAccountId string) error {
+	credentials, err := c.Get(userAccountId)
+	if errors.Is(err, ErrBrokerageNotLinked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = c.refuseWhileLocked(userAccountId)
+	if err != nil {
+		return err
+	}
+	if credentials.Provider == BrokerageManual {
+		err = c.DB.Update(func(txn *badger.Txn) error {
+			return txn.Delete([]byte(manualHoldingsPrefix + userAccountId))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if credentials.Method == BrokerageMethodOAuth {
+		secrets, err := openBrokerageSecrets(userAccountId, credentials.Secrets)
+		if err != nil {
+			return err
+		}
+		err = revokeAlpacaToken(secrets.OAuthToken)
+		if err != nil {
+			return err
+		}
+	}
+	return c.DB.Update(func(txn *badger.Txn) error {
+		err := txn.Delete([]byte(brokerageAccountPrefix + credentials.AccountNumber))
+		if err != nil {
+			return err
+		}
+		return txn.Delete([]byte(brokerageCredentialsPrefix + userAccountId))
+	})
+}
+
+// Brokerage opens the user's linked brokerage account.
+func (c *BrokerageCredentialStore) Brokerage(userAccountId string) (Brokerage, error) {
+	credentials, err := c.Get(userAccountId)
+	if err != nil {
+		return nil, err
+	}
+	return c.open(credentials)
+}
+
+func (c *BrokerageCredentialStore) open(credentials BrokerageCredentials) (Brokerage, error) {
+	switch credentials.Provider {
+	case BrokerageManual:
+		return NewManualBrokerage(c.DB, c.MarketData, credentials.UserAccountId), nil
+	case BrokerageAlpaca:
+		secrets, err := openBrokerageSecrets(credentials.UserAccountId, credentials.Secrets)
+		if err != nil {
+			return nil, err
+		}
+		return NewAlpacaBrokerage(newAlpacaClient(secrets, credentials.Paper), c.MarketData), nil
+	}
+	return nil, fmt.Errorf("unknown brokerage provider %q", credentials.Provider)
+}
+
+// writeBrokerageError answers a request that needed the user's brokerage account.
+func writeBrokerageError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, ErrBrokerageNotLinked) {
+		http.Error(w, "Link your brokerage account first", http.StatusNotFound)
+		return
+	}
+	fmt.Println("Error ", message, ": ", err)
+	http.Error(w, "Failed to "+message, http.StatusInternalServerError)
+}
+
+// HandleLinkBrokerage links an Alpaca account to the user with an API key pair. Accounts are
+// paper accounts unless paper is false.
+func (u *UserHandler) HandleLinkBrokerage(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if _, err := hiero.AccountIDFromString(userAccountId); err != nil {
+		http.Error(w, "Invalid user account ID", http.StatusBadRequest)
+		return
+	}
+	var request LinkBrokerageRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.APIKey == "" || request.APISecret == "" {
+		http.Error(w, "apiKey and apiSecret are required", http.StatusBadRequest)
+		return
+	}
+	paper := request.Paper == nil || *request.Paper
+	credentials, err := u.Credentials.Link(userAccountId, BrokerageSecrets{APIKey: request.APIKey, APISecret: request.APISecret}, paper)
+	var apiErr *alpaca.APIError
+	if errors.As(err, &apiErr) {
+		http.Error(w, "Alpaca rejected the credentials", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, ErrBrokerageAccountTaken) {
+		http.Error(w, "This Alpaca account is linked to another user", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrInsufficientShares) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error linking brokerage account: ", err)
+		http.Error(w, "Failed to link brokerage account", http.StatusInternalServerError)
+		return
+	}
+	credentials.Secrets = nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]BrokerageCredentials{
+		"brokerage": credentials,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode brokerage account", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserHandler) HandleUnlinkBrokerage(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	err := u.Credentials.Unlink(userAccountId)
+	if errors.Is(err, ErrInsufficientShares) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error unlinking brokerage account: ", err)
+		http.Error(w, "Failed to unlink brokerage account", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
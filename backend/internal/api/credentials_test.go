@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestBrokerageAccountLinksToOneUser(t *testing.T) {
+	store := NewBrokerageCredentialStore(newTestDB(t), nil)
+	link := func(user, accountNumber string) error {
+		return store.put(BrokerageCredentials{UserAccountId: user, Provider: BrokerageAlpaca, AccountNumber: accountNumber})
+	}
+	steps := []struct {
+		user, accountNumber string
+		wantErr             error
+	}{
+		{"0.0.1001", "PA1", nil},
+		{"0.0.1001", "PA1", nil},
+		{"0.0.1002", "PA1", ErrBrokerageAccountTaken},
+		// relinking elsewhere frees the old account
+		{"0.0.1001", "PA2", nil},
+		{"0.0.1002", "PA1", nil},
+		{"0.0.1001", "PA1", ErrBrokerageAccountTaken},
+	}
+	for j, step := range steps {
+		err := link(step.user, step.accountNumber)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("step %d: linking %s to %s: error = %v, want %v", j, step.accountNumber, step.user, err, step.wantErr)
+		}
+	}
+}
+
+func TestBrokerageAccountTakenByLegacyLink(t *testing.T) {
+	store := NewBrokerageCredentialStore(newTestDB(t), nil)
+	// a link stored before account numbers were indexed
+	err := store.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(brokerageCredentialsPrefix+"0.0.1001"), []byte(`{"userAccountId":"0.0.1001","accountNumber":"PA1"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.put(BrokerageCredentials{UserAccountId: "0.0.1002", AccountNumber: "PA1"})
+	if !errors.Is(err, ErrBrokerageAccountTaken) {
+		t.Fatalf("error = %v, want %v", err, ErrBrokerageAccountTaken)
+	}
+}
+
+func TestBrokerageAccountKeptWhileSharesLocked(t *testing.T) {
+	store := NewBrokerageCredentialStore(newTestDB(t), nil)
+	err := store.put(BrokerageCredentials{UserAccountId: "0.0.1001", Provider: BrokerageAlpaca, AccountNumber: "PA1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(shareLockKey("0.0.1001", "AAPL")), []byte(`{"userAccountId":"0.0.1001","symbol":"AAPL","units":10,"shares":"1"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same account can be relinked, another cannot
+	err = store.put(BrokerageCredentials{UserAccountId: "0.0.1001", Provider: BrokerageAlpaca, AccountNumber: "PA1"})
+	if err != nil {
+		t.Fatalf("relinking the same account: %v", err)
+	}
+	err = store.put(BrokerageCredentials{UserAccountId: "0.0.1001", Provider: BrokerageAlpaca, AccountNumber: "PA2"})
+	if !errors.Is(err, ErrInsufficientShares) {
+		t.Fatalf("switching accounts: error = %v, want %v", err, ErrInsufficientShares)
+	}
+	err = store.put(BrokerageCredentials{UserAccountId: "0.0.1002", Provider: BrokerageAlpaca, AccountNumber: "PA1"})
+	if !errors.Is(err, ErrBrokerageAccountTaken) {
+		t.Fatalf("linking the locked account to another user: error = %v, want %v", err, ErrBrokerageAccountTaken)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// newTestDB opens an in-memory badger database that is closed when the test ends.
+func newTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	eventPrefix       = "event:"
+	eventUserPrefix   = "event-user:"
+	eventMarketPrefix = "event-market:"
+	indexerCursorKey  = "indexer:cursor"
+)
+
+var defaultIndexerInterval = 15 * time.Second
+
+// ContractEvent is a decoded lending pool log. Amount fields are only set for the events
+// that carry them.
+type ContractEvent struct {
+	Key             string        `json:"key"`
+	Name            string        `json:"name"`
+	MarketId        string        `json:"marketId,omitempty"`
+	BlockNumber     int64         `json:"blockNumber"`
+	TransactionIdx  int64         `json:"transactionIndex"`
+	LogIndex        int64         `json:"logIndex"`
+	Timestamp       string        `json:"timestamp"`
+	TransactionHash string        `json:"transactionHash"`
+	Caller          string        `json:"caller,omitempty"`
+	OnBehalf        string        `json:"onBehalf,omitempty"`
+	Receiver        string        `json:"receiver,omitempty"`
+	Borrower        string        `json:"borrower,omitempty"`
+	Assets          *big.Int      `json:"assets,omitempty"`
+	Shares          *big.Int      `json:"shares,omitempty"`
+	RepaidAssets    *big.Int      `json:"repaidAssets,omitempty"`
+	RepaidShares    *big.Int      `json:"repaidShares,omitempty"`
+	SeizedAssets    *big.Int      `json:"seizedAssets,omitempty"`
+	BadDebtAssets   *big.Int      `json:"badDebtAssets,omitempty"`
+	BadDebtShares   *big.Int      `json:"badDebtShares,omitempty"`
+	Interest        *big.Int      `json:"interest,omitempty"`
+	MarketParams    *MarketParams `json:"marketParams,omitempty"`
+}
+
+// Account returns the position owner an event applies to.
+func (e ContractEvent) Account() string {
+	if e.Borrower != "" {
+		return e.Borrower
+	}
+	return e.OnBehalf
+}
+
+type MarketVolume struct {
+	MarketId            string   `json:"marketId"`
+	From                string   `json:"from,omitempty"`
+	To                  string   `json:"to,omitempty"`
+	Events              int      `json:"events"`
+	Supplied            *big.Int `json:"supplied"`
+	Withdrawn           *big.Int `json:"withdrawn"`
+	Borrowed            *big.Int `json:"borrowed"`
+	Repaid              *big.Int `json:"repaid"`
+	CollateralSupplied  *big.Int `json:"collateralSupplied"`
+	CollateralWithdrawn *big.Int `json:"collateralWithdrawn"`
+	LiquidatedRepaid    *big.Int `json:"liquidatedRepaid"`
+	LiquidatedSeized    *big.Int `json:"liquidatedSeized"`
+	Liquidations        int      `json:"liquidations"`
+}
+
+// EventIndexer pages the lending pool's logs from the mirror node, decodes them with the
+// Morpho event ABI and stores them in badger ordered by (block, transaction, log index).
+// The consensus timestamp of the last indexed log is kept as a cursor so restarts resume.
+type EventIndexer struct {
+	DB       *badger.DB
+	Interval time.Duration
+
+	mu          sync.Mutex
+	eventsABI   abi.ABI
+	subscribers []func()
+}
+
+func NewEventIndexer(db *badger.DB) (*EventIndexer, error) {
+	eventsABI, err := abi.JSON(strings.NewReader(morphoEventsABI))
+	if err != nil {
+		return nil, err
+	}
+	return &EventIndexer{DB: db, Interval: defaultIndexerInterval, eventsABI: eventsABI}, nil
+}
+
+func eventKey(blockNumber, transactionIndex, logIndex int64) string {
+	return fmt.Sprintf("%012d:%06d:%06d", blockNumber, transactionIndex, logIndex)
+}
+
+// Subscribe registers fn to run after every background sync, once the new events are stored.
+func (i *EventIndexer) Subscribe(fn func()) {
+	i.subscribers = append(i.subscribers, fn)
+}
+
+func (i *EventIndexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := i.Sync()
+		if err != nil {
+			fmt.Println("Error indexing contract events: ", err)
+		}
+		for _, fn := range i.subscribers {
+			fn()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync indexes every log newer than the cursor and returns the events it stored.
+func (i *EventIndexer) Sync() ([]ContractEvent, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	cursor, err := i.cursor()
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/api/v1/contracts/%s/results/logs?order=asc&limit=100", LendingPoolContractId)
+	if cursor != "" {
+		// gte so logs sharing the cursor's timestamp are not skipped, re-indexing is idempotent
+		path += "&timestamp=gte:" + cursor
+	}
+
+	var indexed []ContractEvent
+	err = getContractLogs(path, func(page ContractLogsMNAPIResponse) (bool, error) {
+		return true, i.DB.Update(func(txn *badger.Txn) error {
+			for _, log := range page.Logs {
+				event, err := i.decode(log)
+				if err != nil {
+					fmt.Println("Skipping undecodable log ", log.TransactionHash, ": ", err)
+					continue
+				}
+				isNew, err := putEvent(txn, event)
+				if err != nil {
+					return err
+				}
+				if isNew {
+					indexed = append(indexed, event)
+				}
+			}
+			if len(page.Logs) == 0 {
+				return nil
+			}
+			return txn.Set([]byte(indexerCursorKey), []byte(page.Logs[len(page.Logs)-1].Timestamp))
+		})
+	})
+	return indexed, err
+}
+
+func (i *EventIndexer) cursor() (string, error) {
+	var cursor string
+	err := i.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(indexerCursorKey))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		cursor = string(value)
+		return err
+	})
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return "", err
+	}
+	return cursor, nil
+}
+
+func putEvent(txn *badger.Txn, event ContractEvent) (bool, error) {
+	primary := []byte(eventPrefix + event.Key)
+	_, err := txn.Get(primary)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		return false, err
+	}
+	marshaledEvent, err := json.Marshal(event)
+	if err != nil {
+		return false, err
+	}
+	err = txn.Set(primary, marshaledEvent)
+	if err != nil {
+		return false, err
+	}
+	for _, account := range uniqueAddresses(event.Caller, event.OnBehalf, event.Receiver, event.Borrower) {
+		err = txn.Set([]byte(eventUserPrefix+account+":"+event.Key), primary)
+		if err != nil {
+			return false, err
+		}
+	}
+	if event.MarketId != "" {
+		err = txn.Set([]byte(eventMarketPrefix+event.MarketId+":"+event.Key), primary)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func uniqueAddresses(addresses ...string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, address := range addresses {
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		unique = append(unique, address)
+	}
+	return unique
+}
+
+func (i *EventIndexer) decode(log ContractLog) (ContractEvent, error) {
+	if len(log.Topics) == 0 {
+		return ContractEvent{}, errors.New("log has no topics")
+	}
+	topics := make([]common.Hash, len(log.Topics))
+	for j, topic := range log.Topics {
+		topics[j] = common.HexToHash(topic)
+	}
+	abiEvent, err := i.eventsABI.EventByID(topics[0])
+	if err != nil {
+		return ContractEvent{}, err
+	}
+
+	fields := map[string]interface{}{}
+	var indexed abi.Arguments
+	for _, input := range abiEvent.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	err = abi.ParseTopicsIntoMap(fields, indexed, topics[1:])
+	if err != nil {
+		return ContractEvent{}, err
+	}
+	err = abiEvent.Inputs.NonIndexed().UnpackIntoMap(fields, common.FromHex(log.Data))
+	if err != nil {
+		return ContractEvent{}, err
+	}
+
+	event := ContractEvent{
+		Key:             eventKey(log.BlockNumber, log.TransactionIndex, log.Index),
+		Name:            abiEvent.Name,
+		BlockNumber:     log.BlockNumber,
+		TransactionIdx:  log.TransactionIndex,
+		LogIndex:        log.Index,
+		Timestamp:       log.Timestamp,
+		TransactionHash: log.TransactionHash,
+	}
+	address := func(name string) string {
+		if value, ok := fields[name].(common.Address); ok {
+			return strings.ToLower(value.Hex())
+		}
+		return ""
+	}
+	amount := func(name string) *big.Int {
+		if value, ok := fields[name].(*big.Int); ok {
+			return value
+		}
+		return nil
+	}
+	if id, ok := fields["id"].([32]byte); ok {
+		event.MarketId = common.Hash(id).Hex()
+	}
+	event.Caller = address("caller")
+	event.OnBehalf = address("onBehalf")
+	event.Receiver = address("receiver")
+	event.Borrower = address("borrower")
+	event.Assets = amount("assets")
+	event.Shares = amount("shares")
+	event.RepaidAssets = amount("repaidAssets")
+	event.RepaidShares = amount("repaidShares")
+	event.SeizedAssets = amount("seizedAssets")
+	event.BadDebtAssets = amount("badDebtAssets")
+	event.BadDebtShares = amount("badDebtShares")
+	event.Interest = amount("interest")
+	if value, ok := fields["marketParams"]; ok {
+		params := *abi.ConvertType(value, new(MarketParams)).(*MarketParams)
+		event.MarketParams = &params
+	}
+	return event, nil
+}
+
+// eventsByIndex returns the events referenced by an index prefix in chain order, optionally
+// bounded by consensus timestamps (inclusive, empty for unbounded). Index keys end in the
+// event key, so a non-empty after seeks past that event and everything before it.
+func (i *EventIndexer) eventsByIndex(prefix, after, from, to string, limit int) ([]ContractEvent, error) {
+	events := []ContractEvent{}
+	err := i.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		seek := []byte(prefix)
+		if after != "" {
+			seek = []byte(prefix + after + "\x00")
+		}
+		for it.Seek(seek); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			primary, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			item, err := txn.Get(primary)
+			if err != nil {
+				return err
+			}
+			var event ContractEvent
+			err = item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &event)
+			})
+			if err != nil {
+				return err
+			}
+			if (from != "" && compareTimestamps(event.Timestamp, from) < 0) || (to != "" && compareTimestamps(event.Timestamp, to) > 0) {
+				continue
+			}
+			events = append(events, event)
+			if limit > 0 && len(events) >= limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// compareTimestamps compares "seconds.nanos" consensus timestamps numerically.
+func compareTimestamps(a, b string) int {
+	af, _ := new(big.Float).SetString(a)
+	bf, _ := new(big.Float).SetString(b)
+	if af == nil || bf == nil {
+		return strings.Compare(a, b)
+	}
+	return af.Cmp(bf)
+}
+
+func (i *EventIndexer) UserEvents(address string) ([]ContractEvent, error) {
+	return i.eventsByIndex(eventUserPrefix+strings.ToLower(address)+":", "", "", "", 0)
+}
+
+func (i *EventIndexer) MarketEvents(marketId, from, to string) ([]ContractEvent, error) {
+	return i.eventsByIndex(eventMarketPrefix+strings.ToLower(marketId)+":", "", from, to, 0)
+}
+
+// MarketEventsAfter returns the market's events indexed after the event keyed after.
+func (i *EventIndexer) MarketEventsAfter(marketId, after string) ([]ContractEvent, error) {
+	return i.eventsByIndex(eventMarketPrefix+strings.ToLower(marketId)+":", after, "", "", 0)
+}
+
+func addAmount(total, amount *big.Int) {
+	if amount != nil {
+		total.Add(total, amount)
+	}
+}
+
+func (i *EventIndexer) MarketVolume(marketId, from, to string) (MarketVolume, error) {
+	events, err := i.MarketEvents(marketId, from, to)
+	if err != nil {
+		return MarketVolume{}, err
+	}
+	volume := MarketVolume{
+		MarketId:            strings.ToLower(marketId),
+		From:                from,
+		To:                  to,
+		Events:              len(events),
+		Supplied:            big.NewInt(0),
+		Withdrawn:           big.NewInt(0),
+		Borrowed:            big.NewInt(0),
+		Repaid:              big.NewInt(0),
+		CollateralSupplied:  big.NewInt(0),
+		CollateralWithdrawn: big.NewInt(0),
+		LiquidatedRepaid:    big.NewInt(0),
+		LiquidatedSeized:    big.NewInt(0),
+	}
+	for _, event := range events {
+		switch event.Name {
+		case "Supply":
+			addAmount(volume.Supplied, event.Assets)
+		case "Withdraw":
+			addAmount(volume.Withdrawn, event.Assets)
+		case "Borrow":
+			addAmount(volume.Borrowed, event.Assets)
+		case "Repay":
+			addAmount(volume.Repaid, event.Assets)
+		case "SupplyCollateral":
+			addAmount(volume.CollateralSupplied, event.Assets)
+		case "WithdrawCollateral":
+			addAmount(volume.CollateralWithdrawn, event.Assets)
+		case "Liquidate":
+			volume.Liquidations++
+			addAmount(volume.LiquidatedRepaid, event.RepaidAssets)
+			addAmount(volume.LiquidatedSeized, event.SeizedAssets)
+		}
+	}
+	return volume, nil
+}
+
+func (i *EventIndexer) HandleGetUserActivity(w http.ResponseWriter, r *http.Request) {
+	address := chi.URLParam(r, "address")
+	if address == "" {
+		http.Error(w, "Missing address", http.StatusBadRequest)
+		return
+	}
+	evmAddress, err := resolveEvmAddress(address)
+	if err != nil {
+		fmt.Println("Error resolving evm address: ", err)
+		http.Error(w, "Failed to resolve address", http.StatusBadRequest)
+		return
+	}
+	events, err := i.UserEvents(evmAddress)
+	if err != nil {
+		http.Error(w, "Failed to get user activity", http.StatusInternalServerError)
+		return
+	}
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && limit < len(events) {
+		events = events[len(events)-limit:]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]ContractEvent{
+		"activity": events,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode user activity", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (i *EventIndexer) HandleGetMarketVolume(w http.ResponseWriter, r *http.Request) {
+	marketId := chi.URLParam(r, "marketId")
+	if _, err := marketIdToBytes32(marketId); err != nil {
+		http.Error(w, "Invalid market ID", http.StatusBadRequest)
+		return
+	}
+	volume, err := i.MarketVolume(marketId, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Failed to get market volume", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]MarketVolume{
+		"volume": volume,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode market volume", http.StatusInternalServerError)
+		return
+	}
+}
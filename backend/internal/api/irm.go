@@ -0,0 +1,206 @@
+package api
+
+import (
+	"math"
+	"math/big"
+)
+
+// Go port of the Morpho Blue share math and the AdaptiveCurveIrm used by the lending pool.
+// Everything here works on WAD (1e18) fixed point big.Ints so results match the contracts
+// down to the last wei.
+
+const secondsPerYear = 365 * 24 * 60 * 60
+
+var (
+	wad = big.NewInt(1e18)
+
+	virtualShares = big.NewInt(1e6)
+	virtualAssets = big.NewInt(1)
+
+	oraclePriceScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(36), nil)
+
+	// AdaptiveCurveIrm ConstantsLib, per-second values are 50/0.04/0.001/2 ether / 365 days
+	curveSteepness      = big.NewInt(4e18)
+	adjustmentSpeed     = big.NewInt(1585489599188)
+	targetUtilization   = big.NewInt(0.9e18)
+	initialRateAtTarget = big.NewInt(1268391679)
+	minRateAtTarget     = big.NewInt(31709791)
+	maxRateAtTarget     = big.NewInt(63419583967)
+
+	// ExpLib
+	ln2Int, _         = new(big.Int).SetString("693147180559945309", 10)
+	lnWeiInt, _       = new(big.Int).SetString("-41446531673892822312", 10)
+	wExpUpperBound, _ = new(big.Int).SetString("93859467695000404319", 10)
+	wExpUpperValue, _ = new(big.Int).SetString("57716089161558943949701069502944508345128422502756744429568", 10)
+)
+
+func mulDivDown(x, y, d *big.Int) *big.Int {
+	return new(big.Int).Div(new(big.Int).Mul(x, y), d)
+}
+
+func mulDivUp(x, y, d *big.Int) *big.Int {
+	num := new(big.Int).Mul(x, y)
+	num.Add(num, new(big.Int).Sub(d, big.NewInt(1)))
+	return num.Div(num, d)
+}
+
+func wMulDown(x, y *big.Int) *big.Int { return mulDivDown(x, y, wad) }
+func wDivDown(x, y *big.Int) *big.Int { return mulDivDown(x, wad, y) }
+func wDivUp(x, y *big.Int) *big.Int   { return mulDivUp(x, wad, y) }
+
+// signed helpers, rounding towards zero like solidity's int256 division
+func wMulToZero(x, y *big.Int) *big.Int {
+	return new(big.Int).Quo(new(big.Int).Mul(x, y), wad)
+}
+
+func wDivToZero(x, y *big.Int) *big.Int {
+	return new(big.Int).Quo(new(big.Int).Mul(x, wad), y)
+}
+
+func wTaylorCompounded(x, n *big.Int) *big.Int {
+	firstTerm := new(big.Int).Mul(x, n)
+	secondTerm := mulDivDown(firstTerm, firstTerm, new(big.Int).Mul(big.NewInt(2), wad))
+	thirdTerm := mulDivDown(secondTerm, firstTerm, new(big.Int).Mul(big.NewInt(3), wad))
+	return new(big.Int).Add(firstTerm, new(big.Int).Add(secondTerm, thirdTerm))
+}
+
+func toSharesDown(assets, totalAssets, totalShares *big.Int) *big.Int {
+	return mulDivDown(assets, new(big.Int).Add(totalShares, virtualShares), new(big.Int).Add(totalAssets, virtualAssets))
+}
+
+func toSharesUp(assets, totalAssets, totalShares *big.Int) *big.Int {
+	return mulDivUp(assets, new(big.Int).Add(totalShares, virtualShares), new(big.Int).Add(totalAssets, virtualAssets))
+}
+
+func toAssetsDown(shares, totalAssets, totalShares *big.Int) *big.Int {
+	return mulDivDown(shares, new(big.Int).Add(totalAssets, virtualAssets), new(big.Int).Add(totalShares, virtualShares))
+}
+
+func toAssetsUp(shares, totalAssets, totalShares *big.Int) *big.Int {
+	return mulDivUp(shares, new(big.Int).Add(totalAssets, virtualAssets), new(big.Int).Add(totalShares, virtualShares))
+}
+
+func wExp(x *big.Int) *big.Int {
+	if x.Cmp(lnWeiInt) < 0 {
+		return big.NewInt(0)
+	}
+	if x.Cmp(wExpUpperBound) >= 0 {
+		return new(big.Int).Set(wExpUpperValue)
+	}
+	roundingAdjustment := new(big.Int).Quo(ln2Int, big.NewInt(2))
+	if x.Sign() < 0 {
+		roundingAdjustment.Neg(roundingAdjustment)
+	}
+	q := new(big.Int).Quo(new(big.Int).Add(x, roundingAdjustment), ln2Int)
+	r := new(big.Int).Sub(x, new(big.Int).Mul(q, ln2Int))
+	rr := new(big.Int).Quo(new(big.Int).Quo(new(big.Int).Mul(r, r), wad), big.NewInt(2))
+	expR := new(big.Int).Add(wad, new(big.Int).Add(r, rr))
+	if q.Sign() >= 0 {
+		return expR.Lsh(expR, uint(q.Uint64()))
+	}
+	return expR.Rsh(expR, uint(new(big.Int).Neg(q).Uint64()))
+}
+
+func boundInt(x, low, high *big.Int) *big.Int {
+	if x.Cmp(low) < 0 {
+		return new(big.Int).Set(low)
+	}
+	if x.Cmp(high) > 0 {
+		return new(big.Int).Set(high)
+	}
+	return new(big.Int).Set(x)
+}
+
+func newRateAtTarget(startRateAtTarget, linearAdaptation *big.Int) *big.Int {
+	return boundInt(wMulToZero(startRateAtTarget, wExp(linearAdaptation)), minRateAtTarget, maxRateAtTarget)
+}
+
+func curve(rateAtTarget, errNorm *big.Int) *big.Int {
+	var coeff *big.Int
+	if errNorm.Sign() < 0 {
+		coeff = new(big.Int).Sub(wad, wDivToZero(wad, curveSteepness))
+	} else {
+		coeff = new(big.Int).Sub(curveSteepness, wad)
+	}
+	return wMulToZero(new(big.Int).Add(wMulToZero(coeff, errNorm), wad), rateAtTarget)
+}
+
+// adaptiveCurveBorrowRate mirrors AdaptiveCurveIrm._borrowRate and returns the average
+// borrow rate per second over the elapsed period along with the rate at target at its end.
+func adaptiveCurveBorrowRate(startRateAtTarget *big.Int, market MarketPosition, now int64) (*big.Int, *big.Int) {
+	utilization := big.NewInt(0)
+	if market.TotalSupplyAssets.Sign() > 0 {
+		utilization = wDivDown(market.TotalBorrowAssets, market.TotalSupplyAssets)
+	}
+	errNormFactor := targetUtilization
+	if utilization.Cmp(targetUtilization) > 0 {
+		errNormFactor = new(big.Int).Sub(wad, targetUtilization)
+	}
+	errNorm := wDivToZero(new(big.Int).Sub(utilization, targetUtilization), errNormFactor)
+
+	var avgRateAtTarget, endRateAtTarget *big.Int
+	if startRateAtTarget.Sign() == 0 {
+		avgRateAtTarget = initialRateAtTarget
+		endRateAtTarget = initialRateAtTarget
+	} else {
+		speed := wMulToZero(adjustmentSpeed, errNorm)
+		elapsed := big.NewInt(now - market.LastUpdate.Int64())
+		linearAdaptation := new(big.Int).Mul(speed, elapsed)
+		if linearAdaptation.Sign() == 0 {
+			avgRateAtTarget = startRateAtTarget
+			endRateAtTarget = startRateAtTarget
+		} else {
+			endRateAtTarget = newRateAtTarget(startRateAtTarget, linearAdaptation)
+			midRateAtTarget := newRateAtTarget(startRateAtTarget, new(big.Int).Quo(linearAdaptation, big.NewInt(2)))
+			sum := new(big.Int).Add(startRateAtTarget, endRateAtTarget)
+			sum.Add(sum, new(big.Int).Mul(big.NewInt(2), midRateAtTarget))
+			avgRateAtTarget = sum.Quo(sum, big.NewInt(4))
+		}
+	}
+	return curve(avgRateAtTarget, errNorm), endRateAtTarget
+}
+
+// expectedMarketBalances mirrors MorphoBalancesLib.expectedMarketBalances: the market totals
+// as they would be right after an accrueInterest call at `now`.
+func expectedMarketBalances(market MarketPosition, borrowRate *big.Int, now int64) MarketPosition {
+	accrued := MarketPosition{
+		TotalSupplyAssets: new(big.Int).Set(market.TotalSupplyAssets),
+		TotalSupplyShares: new(big.Int).Set(market.TotalSupplyShares),
+		TotalBorrowAssets: new(big.Int).Set(market.TotalBorrowAssets),
+		TotalBorrowShares: new(big.Int).Set(market.TotalBorrowShares),
+		LastUpdate:        big.NewInt(now),
+		Fee:               new(big.Int).Set(market.Fee),
+	}
+	elapsed := big.NewInt(now - market.LastUpdate.Int64())
+	if elapsed.Sign() <= 0 || market.TotalBorrowAssets.Sign() == 0 || borrowRate == nil || borrowRate.Sign() == 0 {
+		accrued.LastUpdate = new(big.Int).Set(market.LastUpdate)
+		return accrued
+	}
+	interest := wMulDown(market.TotalBorrowAssets, wTaylorCompounded(borrowRate, elapsed))
+	accrued.TotalBorrowAssets.Add(accrued.TotalBorrowAssets, interest)
+	accrued.TotalSupplyAssets.Add(accrued.TotalSupplyAssets, interest)
+	if market.Fee.Sign() != 0 {
+		feeAmount := wMulDown(interest, market.Fee)
+		feeShares := toSharesDown(feeAmount, new(big.Int).Sub(accrued.TotalSupplyAssets, feeAmount), accrued.TotalSupplyShares)
+		accrued.TotalSupplyShares.Add(accrued.TotalSupplyShares, feeShares)
+	}
+	return accrued
+}
+
+// projectAPY turns a per-second WAD borrow rate into continuously compounded borrow and
+// supply APYs (as fractions, 0.05 == 5%) at the market's current utilization and fee.
+func projectAPY(borrowRate *big.Int, market MarketPosition) (float64, float64) {
+	if borrowRate == nil {
+		return 0, 0
+	}
+	ratePerSecond, _ := new(big.Float).Quo(new(big.Float).SetInt(borrowRate), new(big.Float).SetInt(wad)).Float64()
+	borrowAPY := math.Expm1(ratePerSecond * secondsPerYear)
+
+	utilization := 0.0
+	if market.TotalSupplyAssets.Sign() > 0 {
+		utilization, _ = new(big.Float).Quo(new(big.Float).SetInt(market.TotalBorrowAssets), new(big.Float).SetInt(market.TotalSupplyAssets)).Float64()
+	}
+	fee, _ := new(big.Float).Quo(new(big.Float).SetInt(market.Fee), new(big.Float).SetInt(wad)).Float64()
+	supplyAPY := borrowAPY * utilization * (1 - fee)
+	return borrowAPY, supplyAPY
+}
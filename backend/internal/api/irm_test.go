@@ -0,0 +1,213 @@
+package api
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func bigString(t *testing.T, s string) *big.Int {
+	t.Helper()
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid integer %q", s)
+	}
+	return x
+}
+
+// approxEqRel mirrors forge's assertApproxEqRel, with maxDelta a WAD fraction of want.
+func approxEqRel(got, want, maxDelta *big.Int) bool {
+	delta := new(big.Int).Abs(new(big.Int).Sub(got, want))
+	return delta.Cmp(wMulDown(new(big.Int).Abs(want), maxDelta)) <= 0
+}
+
+func TestAdaptiveCurveConstants(t *testing.T) {
+	// ConstantsLib defines the per-second values as yearly amounts over 365 days
+	tests := []struct {
+		name   string
+		got    *big.Int
+		yearly string
+	}{
+		{"ADJUSTMENT_SPEED", adjustmentSpeed, "50000000000000000000"},
+		{"INITIAL_RATE_AT_TARGET", initialRateAtTarget, "40000000000000000"},
+		{"MIN_RATE_AT_TARGET", minRateAtTarget, "1000000000000000"},
+		{"MAX_RATE_AT_TARGET", maxRateAtTarget, "2000000000000000000"},
+	}
+	for _, tt := range tests {
+		want := new(big.Int).Quo(bigString(t, tt.yearly), big.NewInt(secondsPerYear))
+		if tt.got.Cmp(want) != 0 {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, want)
+		}
+	}
+}
+
+func TestSharesMath(t *testing.T) {
+	tests := []struct {
+		name                       string
+		value, totalAssets, shares int64
+		sharesDown, sharesUp       int64
+	}{
+		// an empty market mints VIRTUAL_SHARES per asset
+		{"empty market", 1, 0, 0, 1e6, 1e6},
+		{"exact", 100, 1000, 1000e6, 100e6, 100e6},
+		{"rounded", 100, 1000, 999e6, 99900099, 99900100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, totalAssets, totalShares := big.NewInt(tt.value), big.NewInt(tt.totalAssets), big.NewInt(tt.shares)
+			if got := toSharesDown(value, totalAssets, totalShares); got.Int64() != tt.sharesDown {
+				t.Errorf("toSharesDown = %s, want %d", got, tt.sharesDown)
+			}
+			if got := toSharesUp(value, totalAssets, totalShares); got.Int64() != tt.sharesUp {
+				t.Errorf("toSharesUp = %s, want %d", got, tt.sharesUp)
+			}
+			// converting the shares back never yields more assets than were put in
+			if got := toAssetsDown(big.NewInt(tt.sharesDown), totalAssets, totalShares); got.Cmp(value) > 0 {
+				t.Errorf("toAssetsDown(toSharesDown) = %s, more than %d", got, tt.value)
+			}
+			if got := toAssetsUp(big.NewInt(tt.sharesUp), totalAssets, totalShares); got.Cmp(value) < 0 {
+				t.Errorf("toAssetsUp(toSharesUp) = %s, less than %d", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestWadMath(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want *big.Int
+	}{
+		{"wMulDown", wMulDown(big.NewInt(1.5e18), big.NewInt(2.5e18)), big.NewInt(3.75e18)},
+		{"wMulDown rounds down", wMulDown(big.NewInt(1), big.NewInt(0.5e18)), big.NewInt(0)},
+		{"wDivDown", wDivDown(big.NewInt(1e18), big.NewInt(3e18)), big.NewInt(333333333333333333)},
+		{"wDivUp", wDivUp(big.NewInt(1e18), big.NewInt(3e18)), big.NewInt(333333333333333334)},
+		{"wMulToZero rounds negatives up", wMulToZero(big.NewInt(-1), big.NewInt(0.5e18)), big.NewInt(0)},
+		{"wDivToZero", wDivToZero(big.NewInt(-1e18), big.NewInt(3e18)), big.NewInt(-333333333333333333)},
+		// x*n + (x*n)^2/2 + (x*n)^3/6 with x*n = 0.1
+		{"wTaylorCompounded", wTaylorCompounded(big.NewInt(0.1e18), big.NewInt(1)), big.NewInt(105166666666666666)},
+	}
+	for _, tt := range tests {
+		if tt.got.Cmp(tt.want) != 0 {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestWExp(t *testing.T) {
+	tests := []struct {
+		name string
+		x    *big.Int
+		want *big.Int
+	}{
+		{"zero", big.NewInt(0), big.NewInt(1e18)},
+		{"ln 2", ln2Int, big.NewInt(2e18)},
+		{"-ln 2", new(big.Int).Neg(ln2Int), big.NewInt(0.5e18)},
+		{"below LN_WEI_INT", new(big.Int).Sub(lnWeiInt, big.NewInt(1)), big.NewInt(0)},
+		{"WEXP_UPPER_BOUND", wExpUpperBound, wExpUpperValue},
+		{"above WEXP_UPPER_BOUND", new(big.Int).Add(wExpUpperBound, big.NewInt(1e18)), wExpUpperValue},
+	}
+	for _, tt := range tests {
+		if got := wExp(tt.x); got.Cmp(tt.want) != 0 {
+			t.Errorf("wExp(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// ExpLibTest checks the approximation within 1% of exp over the useful range
+	for _, x := range []float64{-10, -1, -0.5, 0.1, 1, 5, 20} {
+		want, _ := new(big.Float).Mul(big.NewFloat(math.Exp(x)), big.NewFloat(1e18)).Int(nil)
+		wadX, _ := new(big.Float).Mul(big.NewFloat(x), big.NewFloat(1e18)).Int(nil)
+		got := wExp(wadX)
+		if !approxEqRel(got, want, big.NewInt(0.01e18)) {
+			t.Errorf("wExp(%v) = %s, want about %s", x, got, want)
+		}
+	}
+}
+
+func TestAdaptiveCurveBorrowRate(t *testing.T) {
+	market := func(borrowed, elapsed int64) MarketPosition {
+		return MarketPosition{
+			TotalSupplyAssets: big.NewInt(1e18),
+			TotalSupplyShares: new(big.Int).Mul(big.NewInt(1e18), virtualShares),
+			TotalBorrowAssets: big.NewInt(borrowed),
+			TotalBorrowShares: new(big.Int).Mul(big.NewInt(borrowed), virtualShares),
+			LastUpdate:        big.NewInt(1_000_000 - elapsed),
+			Fee:               big.NewInt(0),
+		}
+	}
+	const now = 1_000_000
+	const day = 24 * 60 * 60
+
+	tests := []struct {
+		name             string
+		rateAtTarget     *big.Int
+		borrowed         int64
+		elapsed          int64
+		wantRate         *big.Int
+		wantRateAtTarget *big.Int
+	}{
+		// AdaptiveCurveIrmTest.testFirstBorrowRateUtilizationZero
+		{"first borrow at zero utilization", big.NewInt(0), 0, 0, new(big.Int).Quo(initialRateAtTarget, big.NewInt(4)), initialRateAtTarget},
+		// AdaptiveCurveIrmTest.testFirstBorrowRateUtilizationOne
+		{"first borrow at full utilization", big.NewInt(0), 1e18, 0, new(big.Int).Mul(initialRateAtTarget, big.NewInt(4)), initialRateAtTarget},
+		{"at target the rate holds", initialRateAtTarget, 0.9e18, 30 * day, initialRateAtTarget, initialRateAtTarget},
+		{"no time elapsed", initialRateAtTarget, 1e18, 0, new(big.Int).Mul(initialRateAtTarget, big.NewInt(4)), initialRateAtTarget},
+		{"rate at target is capped", maxRateAtTarget, 1e18, 365 * day, new(big.Int).Mul(maxRateAtTarget, big.NewInt(4)), maxRateAtTarget},
+		{"rate at target is floored", minRateAtTarget, 0, 365 * day, new(big.Int).Quo(minRateAtTarget, big.NewInt(4)), minRateAtTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, rateAtTarget := adaptiveCurveBorrowRate(tt.rateAtTarget, market(tt.borrowed, tt.elapsed), now)
+			if rate.Cmp(tt.wantRate) != 0 {
+				t.Errorf("borrow rate = %s, want %s", rate, tt.wantRate)
+			}
+			if rateAtTarget.Cmp(tt.wantRateAtTarget) != 0 {
+				t.Errorf("rate at target = %s, want %s", rateAtTarget, tt.wantRateAtTarget)
+			}
+		})
+	}
+
+	// AdaptiveCurveIrmTest.testRateAfterUtilizationOne: five days at full utilization scale
+	// the rate at target by exp(ADJUSTMENT_SPEED * 5 days)
+	_, rateAtTarget := adaptiveCurveBorrowRate(initialRateAtTarget, market(1e18, 5*day), now)
+	growth := math.Exp(50.0 / 365 * 5)
+	want, _ := new(big.Float).Mul(new(big.Float).SetInt(initialRateAtTarget), big.NewFloat(growth)).Int(nil)
+	if !approxEqRel(rateAtTarget, want, big.NewInt(0.01e18)) {
+		t.Errorf("rate at target after 5 days at full utilization = %s, want about %s", rateAtTarget, want)
+	}
+}
+
+func TestExpectedMarketBalances(t *testing.T) {
+	market := MarketPosition{
+		TotalSupplyAssets: bigString(t, "1000000000000000000000"),
+		TotalSupplyShares: bigString(t, "1000000000000000000000000000"),
+		TotalBorrowAssets: bigString(t, "800000000000000000000"),
+		TotalBorrowShares: bigString(t, "800000000000000000000000000"),
+		LastUpdate:        big.NewInt(1_000_000),
+		Fee:               big.NewInt(0.1e18),
+	}
+	rate := new(big.Int).Mul(initialRateAtTarget, big.NewInt(4))
+
+	unchanged := expectedMarketBalances(market, rate, 1_000_000)
+	if unchanged.TotalBorrowAssets.Cmp(market.TotalBorrowAssets) != 0 || unchanged.LastUpdate.Cmp(market.LastUpdate) != 0 {
+		t.Errorf("no elapsed time accrued %s", unchanged.TotalBorrowAssets)
+	}
+
+	// one day: interest = totalBorrowAssets.wMulDown(rate.wTaylorCompounded(1 days)) and the
+	// fee is minted as supply shares at the post-interest share price, as in _accrueInterest
+	accrued := expectedMarketBalances(market, rate, 1_000_000+86400)
+	tests := []struct {
+		name string
+		got  *big.Int
+		want string
+	}{
+		{"totalSupplyAssets", accrued.TotalSupplyAssets, "1000350761805091660800"},
+		{"totalBorrowAssets", accrued.TotalBorrowAssets, "800350761805091660800"},
+		{"totalSupplyShares", accrued.TotalSupplyShares, "1000035065110957712340100313"},
+		{"lastUpdate", accrued.LastUpdate, "1086400"},
+	}
+	for _, tt := range tests {
+		if tt.got.Cmp(bigString(t, tt.want)) != 0 {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
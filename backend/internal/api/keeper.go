@@ -0,0 +1,443 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+const liquidationPrefix = "liquidation:"
+
+var (
+	liquidationCursor              = big.NewInt(0.3e18)
+	maxLiquidationIncentiveFactor  = big.NewInt(1.15e18)
+	defaultKeeperInterval          = 30 * time.Second
+	defaultKeeperSweepInterval     = 5 * time.Minute
+	defaultKeeperGasPerLiquidation = uint64(1_000_000)
+	defaultKeeperMaxGas            = uint64(3_000_000)
+)
+
+type LiquidationCandidate struct {
+	MarketId       string   `json:"marketId"`
+	Borrower       string   `json:"borrower"`
+	Collateral     *big.Int `json:"collateral"`
+	BorrowShares   *big.Int `json:"borrowShares"`
+	BorrowAssets   *big.Int `json:"borrowAssets"`
+	Health         float64  `json:"health"`
+	SeizedAssets   *big.Int `json:"seizedAssets"`
+	RepaidShares   *big.Int `json:"repaidShares"`
+	RepaidAssets   *big.Int `json:"repaidAssets"`
+	ExpectedProfit *big.Int `json:"expectedProfit"`
+	Profitable     bool     `json:"profitable"`
+	Status         string   `json:"status"`
+	EvaluatedAt    int64    `json:"evaluatedAt"`
+}
+
+type LiquidationRecord struct {
+	LiquidationCandidate
+	TransactionId string `json:"transactionId"`
+	GasLimit      uint64 `json:"gasLimit"`
+	Error         string `json:"error,omitempty"`
+	ExecutedAt    int64  `json:"executedAt"`
+}
+
+type LiquidationReport struct {
+	MarketId  string                 `json:"marketId"`
+	DryRun    bool                   `json:"dryRun"`
+	MaxGas    uint64                 `json:"maxGas"`
+	Borrowers int                    `json:"borrowers"`
+	LastPrice *big.Int               `json:"lastPrice"`
+	LastSweep int64                  `json:"lastSweep"`
+	Pending   []LiquidationCandidate `json:"pending"`
+	Executed  []LiquidationRecord    `json:"executed"`
+}
+
+// keeperMarket is the keeper's view of one market between ticks. cursor is the key of the
+// last indexed event it has read.
+type keeperMarket struct {
+	borrowers map[common.Address]struct{}
+	cursor    string
+	lastPrice *big.Int
+	lastSweep time.Time
+	pending   []LiquidationCandidate
+}
+
+// LiquidationKeeper tracks borrowers of every registered market from the SupplyCollateral and
+// Borrow events the indexer stores and liquidates the ones whose health drops below 1 when
+// it pays to do so. MaxGas is the budget for a whole tick, shared across markets. While the
+// collateral's stock market is closed the oracle price is stale, so the threshold drops by
+// the session's liquidation buffer.
+type LiquidationKeeper struct {
+	DB                *badger.DB
+	Markets           *MarketRegistry
+	Session           *MarketSessionTracker
+	Indexer           *EventIndexer
+	DryRun            bool
+	GasPerLiquidation uint64
+	MaxGas            uint64
+	MinProfit         *big.Int
+	Interval          time.Duration
+	SweepInterval     time.Duration
+
+	mu      sync.Mutex
+	markets map[string]*keeperMarket
+}
+
+func NewLiquidationKeeper(db *badger.DB, markets *MarketRegistry, session *MarketSessionTracker, indexer *EventIndexer) *LiquidationKeeper {
+	k := &LiquidationKeeper{
+		DB:                db,
+		Markets:           markets,
+		Session:           session,
+		Indexer:           indexer,
+		DryRun:            os.Getenv("KEEPER_DRY_RUN") != "false",
+		GasPerLiquidation: envUint64("KEEPER_GAS_PER_LIQUIDATION", defaultKeeperGasPerLiquidation),
+		MaxGas:            envUint64("KEEPER_MAX_GAS", defaultKeeperMaxGas),
+		MinProfit:         big.NewInt(int64(envUint64("KEEPER_MIN_PROFIT", 0))),
+		Interval:          defaultKeeperInterval,
+		SweepInterval:     defaultKeeperSweepInterval,
+		markets:           map[string]*keeperMarket{},
+	}
+	if interval, err := time.ParseDuration(os.Getenv("KEEPER_INTERVAL")); err == nil {
+		k.Interval = interval
+	}
+	return k
+}
+
+func envUint64(key string, fallback uint64) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Run polls each market's oracle every Interval and re-evaluates the market's borrowers when
+// the price moves, when new borrowers show up, or at least every SweepInterval to pick up
+// accrued interest.
+func (k *LiquidationKeeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.Interval)
+	defer ticker.Stop()
+	for {
+		k.tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *LiquidationKeeper) tick() {
+	markets, err := k.Markets.List()
+	if err != nil {
+		fmt.Println("Error listing markets: ", err)
+		return
+	}
+	added, err := k.refreshBorrowers(markets)
+	if err != nil {
+		fmt.Println("Error refreshing borrowers: ", err)
+	}
+	gasLeft := k.MaxGas
+	for _, record := range markets {
+		price, err := getOraclePrice(record.Params.Oracle)
+		if err != nil {
+			fmt.Println("Error getting oracle price for ", record.MarketId, ": ", err)
+			continue
+		}
+		if price == nil || price.Sign() <= 0 {
+			// an unset oracle would make every borrower look insolvent
+			fmt.Println("Skipping market ", record.MarketId, ": oracle reports no price")
+			continue
+		}
+
+		k.mu.Lock()
+		market := k.market(record.MarketId)
+		priceChanged := market.lastPrice == nil || market.lastPrice.Cmp(price) != 0
+		stale := time.Since(market.lastSweep) >= k.SweepInterval
+		market.lastPrice = price
+		k.mu.Unlock()
+
+		if priceChanged || added[record.MarketId] > 0 || stale {
+			threshold := 1 - float64(k.Session.LiquidationBufferBps(record.CollateralSymbol))/10_000
+			gasLeft, err = k.sweep(record.MarketId, price, threshold, gasLeft)
+			if err != nil {
+				fmt.Println("Error sweeping borrowers of ", record.MarketId, ": ", err)
+			}
+		}
+	}
+}
+
+// market returns the keeper state for a market, creating it on first use. Callers hold k.mu.
+func (k *LiquidationKeeper) market(marketId string) *keeperMarket {
+	marketId = strings.ToLower(marketId)
+	market, ok := k.markets[marketId]
+	if !ok {
+		market = &keeperMarket{borrowers: map[common.Address]struct{}{}}
+		k.markets[marketId] = market
+	}
+	return market
+}
+
+// refreshBorrowers adds the onBehalf address of every SupplyCollateral and Borrow the
+// indexer stored since the last refresh, per market. It returns how many new borrowers each
+// market gained.
+func (k *LiquidationKeeper) refreshBorrowers(markets []MarketRecord) (map[string]int, error) {
+	added := map[string]int{}
+	for _, record := range markets {
+		k.mu.Lock()
+		cursor := k.market(record.MarketId).cursor
+		k.mu.Unlock()
+		events, err := k.Indexer.MarketEventsAfter(record.MarketId, cursor)
+		if err != nil {
+			return added, err
+		}
+		k.mu.Lock()
+		market := k.market(record.MarketId)
+		for _, event := range events {
+			market.cursor = event.Key
+			if event.Name != "SupplyCollateral" && event.Name != "Borrow" {
+				continue
+			}
+			borrower := common.HexToAddress(event.OnBehalf)
+			if _, known := market.borrowers[borrower]; !known {
+				market.borrowers[borrower] = struct{}{}
+				added[record.MarketId]++
+			}
+		}
+		k.mu.Unlock()
+	}
+	return added, nil
+}
+
+func liquidationIncentiveFactor(lltv *big.Int) *big.Int {
+	lif := wDivDown(wad, new(big.Int).Sub(wad, wMulDown(liquidationCursor, new(big.Int).Sub(wad, lltv))))
+	if lif.Cmp(maxLiquidationIncentiveFactor) > 0 {
+		return new(big.Int).Set(maxLiquidationIncentiveFactor)
+	}
+	return lif
+}
+
+// liquidationAmounts picks the largest liquidation the pool will accept: repay all borrow
+// shares if the seized collateral fits, otherwise seize all collateral. Exactly one of the
+// returned seizedAssets / repaidShares arguments is non-zero, as liquidate requires. Without a
+// price nothing can be valued, so every amount is zero.
+func liquidationAmounts(collateral, borrowShares *big.Int, market MarketPosition, price, lltv *big.Int) (seizedArg, repaidSharesArg, seized, repaidAssets *big.Int) {
+	if price == nil || price.Sign() <= 0 {
+		return big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	}
+	lif := liquidationIncentiveFactor(lltv)
+	debt := toAssetsDown(borrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+	seized = mulDivDown(wMulDown(debt, lif), oraclePriceScale, price)
+	if seized.Cmp(collateral) <= 0 {
+		repaidAssets = toAssetsUp(borrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+		return big.NewInt(0), new(big.Int).Set(borrowShares), seized, repaidAssets
+	}
+	seized = new(big.Int).Set(collateral)
+	repaidShares := toSharesUp(wDivUp(mulDivUp(collateral, price, oraclePriceScale), lif), market.TotalBorrowAssets, market.TotalBorrowShares)
+	repaidAssets = toAssetsUp(repaidShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+	return seized, big.NewInt(0), seized, repaidAssets
+}
+
+// sweep evaluates a market's borrowers at price and liquidates those with health below
+// threshold within gasLeft, returning the gas left for the remaining markets of the tick.
+func (k *LiquidationKeeper) sweep(marketId string, price *big.Int, threshold float64, gasLeft uint64) (uint64, error) {
+	if price == nil || price.Sign() <= 0 {
+		return gasLeft, fmt.Errorf("no oracle price for market %s", marketId)
+	}
+	marketState, err := getMarketState(marketId)
+	if err != nil {
+		return gasLeft, err
+	}
+	market := marketState.Market
+	id, err := marketIdToBytes32(marketId)
+	if err != nil {
+		return gasLeft, err
+	}
+
+	k.mu.Lock()
+	tracked := k.market(marketId)
+	borrowers := make([]common.Address, 0, len(tracked.borrowers))
+	for borrower := range tracked.borrowers {
+		borrowers = append(borrowers, borrower)
+	}
+	k.mu.Unlock()
+
+	now := time.Now().Unix()
+	var candidates []LiquidationCandidate
+	for _, borrower := range borrowers {
+		var position struct {
+			SupplyShares *big.Int
+			BorrowShares *big.Int
+			Collateral   *big.Int
+		}
+		err := callPool("position", &position, id, borrower)
+		if err != nil {
+			fmt.Println("Error getting position for ", borrower.Hex(), ": ", err)
+			continue
+		}
+		if position.BorrowShares.Sign() == 0 {
+			continue
+		}
+		borrowAssets := toAssetsUp(position.BorrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+		health := healthFactor(position.Collateral, borrowAssets, price, marketState.Params.Lltv)
+		if health == nil || *health >= threshold {
+			continue
+		}
+
+		seizedArg, repaidSharesArg, seized, repaidAssets := liquidationAmounts(position.Collateral, position.BorrowShares, market, price, marketState.Params.Lltv)
+		profit := new(big.Int).Sub(mulDivDown(seized, price, oraclePriceScale), repaidAssets)
+		candidates = append(candidates, LiquidationCandidate{
+			MarketId:       strings.ToLower(marketId),
+			Borrower:       borrower.Hex(),
+			Collateral:     position.Collateral,
+			BorrowShares:   position.BorrowShares,
+			BorrowAssets:   borrowAssets,
+			Health:         *health,
+			SeizedAssets:   seizedArg,
+			RepaidShares:   repaidSharesArg,
+			RepaidAssets:   repaidAssets,
+			ExpectedProfit: profit,
+			Profitable:     profit.Sign() > 0 && profit.Cmp(k.MinProfit) >= 0,
+			Status:         "pending",
+			EvaluatedAt:    now,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ExpectedProfit.Cmp(candidates[j].ExpectedProfit) > 0
+	})
+
+	var pending []LiquidationCandidate
+	for _, candidate := range candidates {
+		switch {
+		case !candidate.Profitable:
+			candidate.Status = "unprofitable"
+		case k.DryRun:
+			candidate.Status = "dry-run"
+		case gasLeft < k.GasPerLiquidation:
+			candidate.Status = "over-gas-budget"
+		default:
+			gasLeft -= k.GasPerLiquidation
+			err := k.liquidate(marketState.Params, candidate)
+			if err != nil {
+				fmt.Println("Error liquidating ", candidate.Borrower, ": ", err)
+			}
+			continue
+		}
+		pending = append(pending, candidate)
+	}
+
+	k.mu.Lock()
+	tracked.pending = pending
+	tracked.lastSweep = time.Now()
+	k.mu.Unlock()
+	return gasLeft, nil
+}
+
+func (k *LiquidationKeeper) liquidate(params MarketParams, candidate LiquidationCandidate) error {
+	txId, err := executePool("liquidate", k.GasPerLiquidation,
+		params, common.HexToAddress(candidate.Borrower), candidate.SeizedAssets, candidate.RepaidShares, []byte{})
+
+	candidate.Status = "executed"
+	record := LiquidationRecord{
+		LiquidationCandidate: candidate,
+		TransactionId:        txId,
+		GasLimit:             k.GasPerLiquidation,
+		ExecutedAt:           time.Now().Unix(),
+	}
+	if err != nil {
+		record.Status = "failed"
+		record.Error = err.Error()
+	}
+	marshaledRecord, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	key := fmt.Sprintf("%s%020d:%s", liquidationPrefix, time.Now().UnixNano(), candidate.Borrower)
+	dbErr := k.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), marshaledRecord)
+	})
+	if err != nil {
+		return err
+	}
+	return dbErr
+}
+
+func (k *LiquidationKeeper) executedLiquidations(marketId string) ([]LiquidationRecord, error) {
+	records := []LiquidationRecord{}
+	err := k.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(liquidationPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var record LiquidationRecord
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &record)
+			})
+			if err != nil {
+				return err
+			}
+			if record.MarketId == "" {
+				record.MarketId = strings.ToLower(DefaultMarketId)
+			}
+			if record.MarketId == marketId {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// HandleGetLiquidations reports the keeper's state for {marketId}, or the default market on
+// routes without one.
+func (k *LiquidationKeeper) HandleGetLiquidations(w http.ResponseWriter, r *http.Request) {
+	marketId := chi.URLParam(r, "marketId")
+	if marketId == "" {
+		marketId = DefaultMarketId
+	}
+	if _, err := marketIdToBytes32(marketId); err != nil {
+		http.Error(w, "Invalid market ID", http.StatusBadRequest)
+		return
+	}
+	marketId = strings.ToLower(marketId)
+	executed, err := k.executedLiquidations(marketId)
+	if err != nil {
+		http.Error(w, "Failed to get executed liquidations", http.StatusInternalServerError)
+		return
+	}
+	k.mu.Lock()
+	market := k.market(marketId)
+	report := LiquidationReport{
+		MarketId:  marketId,
+		DryRun:    k.DryRun,
+		MaxGas:    k.MaxGas,
+		Borrowers: len(market.borrowers),
+		LastPrice: market.lastPrice,
+		LastSweep: market.lastSweep.Unix(),
+		Pending:   append([]LiquidationCandidate{}, market.pending...),
+		Executed:  executed,
+	}
+	k.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]LiquidationReport{
+		"liquidations": report,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode liquidations", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestRefreshBorrowersFromIndexer(t *testing.T) {
+	db := newTestDB(t)
+	indexer, err := NewEventIndexer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marketId := "0xab00000000000000000000000000000000000000000000000000000000000000"
+	store := func(events ...ContractEvent) {
+		t.Helper()
+		err := db.Update(func(txn *badger.Txn) error {
+			for _, event := range events {
+				event.MarketId = marketId
+				_, err := putEvent(txn, event)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := "0x00000000000000000000000000000000000000a1"
+	bob := "0x00000000000000000000000000000000000000b0"
+	store(
+		ContractEvent{Key: eventKey(1, 0, 0), Name: "SupplyCollateral", OnBehalf: alice},
+		ContractEvent{Key: eventKey(1, 0, 1), Name: "Borrow", OnBehalf: alice},
+		ContractEvent{Key: eventKey(2, 0, 0), Name: "Supply", OnBehalf: bob},
+	)
+
+	k := NewLiquidationKeeper(db, NewMarketRegistry(db), nil, indexer)
+	markets := []MarketRecord{{MarketId: marketId}}
+	added, err := k.refreshBorrowers(markets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[marketId] != 1 {
+		t.Fatalf("added %d borrowers, want 1 (suppliers are not borrowers)", added[marketId])
+	}
+
+	store(ContractEvent{Key: eventKey(3, 0, 0), Name: "Borrow", OnBehalf: bob})
+	added, err = k.refreshBorrowers(markets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[marketId] != 1 {
+		t.Fatalf("added %d borrowers after a new borrow, want 1", added[marketId])
+	}
+	if n := len(k.market(marketId).borrowers); n != 2 {
+		t.Fatalf("tracking %d borrowers, want 2", n)
+	}
+
+	added, err = k.refreshBorrowers(markets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[marketId] != 0 {
+		t.Fatalf("added %d borrowers without new events, want 0", added[marketId])
+	}
+}
+
+func TestLiquidationAmountsWithoutPrice(t *testing.T) {
+	market := MarketPosition{
+		TotalSupplyAssets: big.NewInt(1000),
+		TotalSupplyShares: big.NewInt(1000e6),
+		TotalBorrowAssets: big.NewInt(500),
+		TotalBorrowShares: big.NewInt(500e6),
+		LastUpdate:        big.NewInt(0),
+		Fee:               big.NewInt(0),
+	}
+	for _, price := range []*big.Int{nil, big.NewInt(0)} {
+		seizedArg, repaidSharesArg, seized, repaidAssets := liquidationAmounts(big.NewInt(100), big.NewInt(50e6), market, price, big.NewInt(8e17))
+		for _, amount := range []*big.Int{seizedArg, repaidSharesArg, seized, repaidAssets} {
+			if amount.Sign() != 0 {
+				t.Fatalf("liquidationAmounts at price %v = %s, want 0", price, amount)
+			}
+		}
+	}
+	k := NewLiquidationKeeper(newTestDB(t), nil, nil, nil)
+	if _, err := k.sweep("0xab", big.NewInt(0), 1, 100); err == nil {
+		t.Fatal("sweep at a zero price succeeded")
+	}
+}
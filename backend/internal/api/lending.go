@@ -0,0 +1,330 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const (
+	LendingPoolContractId = "0.0.6532033"
+	DefaultMarketId       = "0xc6c8d3eb24d61523202abed6d47eb676e7f2fef743503b857f8559390318bb10"
+)
+
+const irmABI = `[
+	{"inputs":[{"internalType":"Id","name":"","type":"bytes32"}],"name":"rateAtTarget","outputs":[{"internalType":"int256","name":"","type":"int256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[
+		{"components":[{"name":"loanToken","type":"address"},{"name":"collateralToken","type":"address"},{"name":"oracle","type":"address"},{"name":"irm","type":"address"},{"name":"lltv","type":"uint256"}],"name":"marketParams","type":"tuple"},
+		{"components":[{"name":"totalSupplyAssets","type":"uint128"},{"name":"totalSupplyShares","type":"uint128"},{"name":"totalBorrowAssets","type":"uint128"},{"name":"totalBorrowShares","type":"uint128"},{"name":"lastUpdate","type":"uint128"},{"name":"fee","type":"uint128"}],"name":"market","type":"tuple"}
+	],"name":"borrowRateView","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// abi.json only carries the functions, the events come from Morpho's EventsLib
+const morphoEventsABI = `[
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":false,"components":[{"name":"loanToken","type":"address"},{"name":"collateralToken","type":"address"},{"name":"oracle","type":"address"},{"name":"irm","type":"address"},{"name":"lltv","type":"uint256"}],"name":"marketParams","type":"tuple"}],"name":"CreateMarket","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":true,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":false,"name":"assets","type":"uint256"},{"indexed":false,"name":"shares","type":"uint256"}],"name":"Supply","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":false,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":true,"name":"receiver","type":"address"},{"indexed":false,"name":"assets","type":"uint256"},{"indexed":false,"name":"shares","type":"uint256"}],"name":"Withdraw","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":false,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":true,"name":"receiver","type":"address"},{"indexed":false,"name":"assets","type":"uint256"},{"indexed":false,"name":"shares","type":"uint256"}],"name":"Borrow","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":true,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":false,"name":"assets","type":"uint256"},{"indexed":false,"name":"shares","type":"uint256"}],"name":"Repay","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":true,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":false,"name":"assets","type":"uint256"}],"name":"SupplyCollateral","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":false,"name":"caller","type":"address"},{"indexed":true,"name":"onBehalf","type":"address"},{"indexed":true,"name":"receiver","type":"address"},{"indexed":false,"name":"assets","type":"uint256"}],"name":"WithdrawCollateral","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":true,"name":"caller","type":"address"},{"indexed":true,"name":"borrower","type":"address"},{"indexed":false,"name":"repaidAssets","type":"uint256"},{"indexed":false,"name":"repaidShares","type":"uint256"},{"indexed":false,"name":"seizedAssets","type":"uint256"},{"indexed":false,"name":"badDebtAssets","type":"uint256"},{"indexed":false,"name":"badDebtShares","type":"uint256"}],"name":"Liquidate","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"},{"indexed":false,"name":"prevBorrowRate","type":"uint256"},{"indexed":false,"name":"interest","type":"uint256"},{"indexed":false,"name":"feeShares","type":"uint256"}],"name":"AccrueInterest","type":"event"}
+]`
+
+const oracleABI = `[{"inputs":[],"name":"price","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+func newOperatorClient() (*hiero.Client, error) {
+	operatorIdStr := os.Getenv("MY_ACCOUNT_ID")
+	operatorKeyStr := os.Getenv("MY_PRIVATE_KEY")
+	if operatorIdStr == "" || operatorKeyStr == "" {
+		return nil, errors.New("must set operator account id and private key")
+	}
+	operatorId, err := hiero.AccountIDFromString(operatorIdStr)
+	if err != nil {
+		return nil, err
+	}
+	operatorKey, err := hiero.PrivateKeyFromStringEd25519(operatorKeyStr)
+	if err != nil {
+		return nil, err
+	}
+	client := hiero.ClientForTestnet()
+	client.SetOperator(operatorId, operatorKey)
+	return client, nil
+}
+
+func loadPoolABI() (abi.ABI, error) {
+	abiBytes, err := os.ReadFile("abi.json")
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(strings.NewReader(string(abiBytes)))
+}
+
+// callContract runs a read-only ContractCallQuery with pre-encoded calldata.
+func callContract(contractId hiero.ContractID, calldata []byte) ([]byte, error) {
+	client, err := newOperatorClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result, err := hiero.NewContractCallQuery().
+		SetContractID(contractId).
+		SetGas(600_000).
+		SetFunctionParameters(calldata).
+		Execute(client)
+	if err != nil {
+		return nil, err
+	}
+	return result.ContractCallResult, nil
+}
+
+// callABI packs `method` with `contractABI`, queries `contractId` and unpacks the result into `out`.
+func callABI(contractABI abi.ABI, contractId hiero.ContractID, method string, out interface{}, args ...interface{}) error {
+	calldata, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return err
+	}
+	result, err := callContract(contractId, calldata)
+	if err != nil {
+		return err
+	}
+	return contractABI.UnpackIntoInterface(out, method, result)
+}
+
+func callPool(method string, out interface{}, args ...interface{}) error {
+	contractABI, err := loadPoolABI()
+	if err != nil {
+		return err
+	}
+	contractId, err := hiero.ContractIDFromString(LendingPoolContractId)
+	if err != nil {
+		return err
+	}
+	return callABI(contractABI, contractId, method, out, args...)
+}
+
+// executePool signs and submits a state-changing call on the lending pool with the operator
+// key and returns the transaction id once it reaches consensus.
+func executePool(method string, gas uint64, args ...interface{}) (string, error) {
+	contractABI, err := loadPoolABI()
+	if err != nil {
+		return "", err
+	}
+	contractId, err := hiero.ContractIDFromString(LendingPoolContractId)
+	if err != nil {
+		return "", err
+	}
+	return executeABI(contractABI, contractId, method, gas, args...)
+}
+
+// executeABI is executePool for any contract.
+func executeABI(contractABI abi.ABI, contractId hiero.ContractID, method string, gas uint64, args ...interface{}) (string, error) {
+	calldata, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return "", err
+	}
+	client, err := newOperatorClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	txResponse, err := hiero.NewContractExecuteTransaction().
+		SetContractID(contractId).
+		SetGas(gas).
+		SetFunctionParameters(calldata).
+		Execute(client)
+	if err != nil {
+		return "", err
+	}
+	receipt, err := txResponse.GetReceipt(client)
+	if err != nil {
+		return txResponse.TransactionID.String(), err
+	}
+	fmt.Printf("The %s transaction consensus status is %v\n", method, receipt.Status)
+	return txResponse.TransactionID.String(), nil
+}
+
+// submitTopicMessage publishes a message to an HCS topic with the operator key and returns
+// its sequence number and transaction id once it reaches consensus.
+func submitTopicMessage(topicId string, memo string, message []byte) (uint64, string, error) {
+	topicID, err := hiero.TopicIDFromString(topicId)
+	if err != nil {
+		return 0, "", err
+	}
+	client, err := newOperatorClient()
+	if err != nil {
+		return 0, "", err
+	}
+	defer client.Close()
+
+	txResponse, err := hiero.NewTopicMessageSubmitTransaction().
+		SetTransactionMemo(memo).
+		SetTopicID(topicID).
+		SetMessage(message).
+		Execute(client)
+	if err != nil {
+		return 0, "", err
+	}
+	receipt, err := txResponse.GetReceipt(client)
+	if err != nil {
+		return 0, txResponse.TransactionID.String(), err
+	}
+	return receipt.TopicSequenceNumber, txResponse.TransactionID.String(), nil
+}
+
+// publishSigned publishes a signed record to an HCS topic and returns its sequence number.
+// The sequence exists only once the signed record is on the topic, so records keep it outside
+// what their signature covers. A record that could not be published is not stored by its
+// caller, so the next run publishes it again.
+func publishSigned(topicId string, memo string, record interface{}) (uint64, error) {
+	signed, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	sequence, _, err := submitTopicMessage(topicId, memo, signed)
+	if err != nil {
+		return 0, fmt.Errorf("publishing %s to topic %s: %w", memo, topicId, err)
+	}
+	return sequence, nil
+}
+
+func marketIdToBytes32(marketId string) ([32]byte, error) {
+	var id [32]byte
+	b := common.FromHex(marketId)
+	if len(b) != 32 {
+		return id, fmt.Errorf("invalid market id %q", marketId)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func evmContractId(address common.Address) (hiero.ContractID, error) {
+	return hiero.ContractIDFromEvmAddress(0, 0, strings.TrimPrefix(address.Hex(), "0x"))
+}
+
+func getMarketParams(marketId string) (MarketParams, error) {
+	id, err := marketIdToBytes32(marketId)
+	if err != nil {
+		return MarketParams{}, err
+	}
+	var params MarketParams
+	err = callPool("idToMarketParams", &params, id)
+	if err != nil {
+		return MarketParams{}, err
+	}
+	return params, nil
+}
+
+// getBorrowRate returns the IRM's current per-second borrow rate for a market. The
+// adaptive curve is evaluated locally from the IRM's stored rateAtTarget; any other IRM
+// is asked directly through borrowRateView.
+func getBorrowRate(marketId string, params MarketParams, market MarketPosition, now int64) (*big.Int, error) {
+	if params.Irm == (common.Address{}) {
+		return nil, nil
+	}
+	irmContractABI, err := abi.JSON(strings.NewReader(irmABI))
+	if err != nil {
+		return nil, err
+	}
+	irmId, err := evmContractId(params.Irm)
+	if err != nil {
+		return nil, err
+	}
+	id, err := marketIdToBytes32(marketId)
+	if err != nil {
+		return nil, err
+	}
+
+	var rateAtTarget *big.Int
+	err = callABI(irmContractABI, irmId, "rateAtTarget", &rateAtTarget, id)
+	if err == nil {
+		rate, _ := adaptiveCurveBorrowRate(rateAtTarget, market, now)
+		return rate, nil
+	}
+	fmt.Println("rateAtTarget unavailable, falling back to borrowRateView: ", err)
+
+	marketTuple := struct {
+		TotalSupplyAssets *big.Int
+		TotalSupplyShares *big.Int
+		TotalBorrowAssets *big.Int
+		TotalBorrowShares *big.Int
+		LastUpdate        *big.Int
+		Fee               *big.Int
+	}{market.TotalSupplyAssets, market.TotalSupplyShares, market.TotalBorrowAssets, market.TotalBorrowShares, market.LastUpdate, market.Fee}
+
+	var rate *big.Int
+	err = callABI(irmContractABI, irmId, "borrowRateView", &rate, params, marketTuple)
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func getOraclePrice(oracle common.Address) (*big.Int, error) {
+	oracleContractABI, err := abi.JSON(strings.NewReader(oracleABI))
+	if err != nil {
+		return nil, err
+	}
+	oracleId, err := evmContractId(oracle)
+	if err != nil {
+		return nil, err
+	}
+	var price *big.Int
+	err = callABI(oracleContractABI, oracleId, "price", &price)
+	if err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// getMarketState reads a market and projects its balances and rates to the current time,
+// so callers see interest accrued since lastUpdate without an accrueInterest transaction.
+func getMarketState(marketId string) (MarketState, error) {
+	params, err := getMarketParams(marketId)
+	if err != nil {
+		return MarketState{}, err
+	}
+	market, err := getMarketPosition(marketId)
+	if err != nil {
+		return MarketState{}, err
+	}
+	now := time.Now().Unix()
+	borrowRate, err := getBorrowRate(marketId, params, market, now)
+	if err != nil {
+		return MarketState{}, err
+	}
+	accrued := expectedMarketBalances(market, borrowRate, now)
+	borrowAPY, supplyAPY := projectAPY(borrowRate, accrued)
+
+	return MarketState{
+		MarketId:   marketId,
+		Params:     params,
+		Market:     accrued,
+		BorrowRate: borrowRate,
+		BorrowAPY:  borrowAPY,
+		SupplyAPY:  supplyAPY,
+		AccruedAt:  now,
+	}, nil
+}
+
+// healthFactor is collateral value * lltv / debt, where anything below 1 can be liquidated.
+// It returns nil when there is no debt.
+func healthFactor(collateral, borrowAssets, price, lltv *big.Int) *float64 {
+	if borrowAssets.Sign() == 0 {
+		return nil
+	}
+	maxBorrow := wMulDown(mulDivDown(collateral, price, oraclePriceScale), lltv)
+	health, _ := new(big.Float).Quo(new(big.Float).SetInt(maxBorrow), new(big.Float).SetInt(borrowAssets)).Float64()
+	return &health
+}
@@ -1,2 +1,102 @@
 package api
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+type LoansHandler struct {
+	DB      *badger.DB
+	Client  *hiero.Client
+	Markets *MarketRegistry
+	Session *MarketSessionTracker
+}
+
+func NewLoansHandler(db *badger.DB, client *hiero.Client, markets *MarketRegistry, session *MarketSessionTracker) *LoansHandler {
+	return &LoansHandler{DB: db, Client: client, Markets: markets, Session: session}
+}
+
+// requestMarket resolves the {marketId} route param against the registry, writing the error
+// response itself. Routes without a {marketId} use the default market.
+func (l *LoansHandler) requestMarket(w http.ResponseWriter, r *http.Request) (MarketRecord, bool) {
+	marketId := chi.URLParam(r, "marketId")
+	if marketId == "" {
+		marketId = DefaultMarketId
+	}
+	if _, err := marketIdToBytes32(marketId); err != nil {
+		http.Error(w, "Invalid market ID", http.StatusBadRequest)
+		return MarketRecord{}, false
+	}
+	market, err := l.Markets.Get(marketId)
+	if errors.Is(err, ErrMarketNotFound) {
+		http.Error(w, "Market not found", http.StatusNotFound)
+		return MarketRecord{}, false
+	}
+	if err != nil {
+		fmt.Println("Error getting market: ", err)
+		http.Error(w, "Failed to get market", http.StatusInternalServerError)
+		return MarketRecord{}, false
+	}
+	return market, true
+}
+
+func (l *LoansHandler) HandleGetMarket(w http.ResponseWriter, r *http.Request) {
+	market, ok := l.requestMarket(w, r)
+	if !ok {
+		return
+	}
+	marketState, err := getMarketState(market.MarketId)
+	if err != nil {
+		fmt.Println("Error getting market state: ", err)
+		http.Error(w, "Failed to get market state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]MarketState{
+		"market": marketState,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode market state", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (l *LoansHandler) HandleGetPosition(w http.ResponseWriter, r *http.Request) {
+	market, ok := l.requestMarket(w, r)
+	if !ok {
+		return
+	}
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	evmAddress, err := resolveEvmAddress(userAccountId)
+	if err != nil {
+		fmt.Println("Error resolving user address: ", err)
+		http.Error(w, "Failed to resolve user address", http.StatusBadRequest)
+		return
+	}
+	position, err := getUserPosition(market.MarketId, evmAddress)
+	if err != nil {
+		fmt.Println("Error getting user position: ", err)
+		http.Error(w, "Failed to get user position", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]UserPosition{
+		"position": position,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode user position", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,465 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const manualHoldingsPrefix = "manual-holdings:"
+
+const (
+	HoldingsPending  = "pending"
+	HoldingsAttested = "attested"
+	HoldingsRejected = "rejected"
+)
+
+var (
+	ErrHoldingsNotFound    = errors.New("no holdings uploaded")
+	ErrHoldingsNotAttested = errors.New("no holdings attested")
+)
+
+type ManualHolding struct {
+	Symbol    string          `json:"symbol"`
+	Qty       decimal.Decimal `json:"qty"`
+	CostBasis decimal.Decimal `json:"costBasis"`
+	Locked    decimal.Decimal `json:"locked"`
+}
+
+// ManualHoldings are shares a user holds outside a connected brokerage, from an uploaded
+// statement. They count as positions only once an operator attests them; uploading again
+// sends them back for attestation, and Attested keeps the last attested holdings in force
+// until the operator reviews the new ones.
+type ManualHoldings struct {
+	UserAccountId string          `json:"userAccountId"`
+	Holdings      []ManualHolding `json:"holdings"`
+	Attested      []ManualHolding `json:"attested"`
+	Status        string          `json:"status"`
+	Statement     string          `json:"statement,omitempty"`
+	UploadedAt    string          `json:"uploadedAt"`
+	AttestedAt    string          `json:"attestedAt,omitempty"`
+}
+
+type AttestHoldingsRequest struct {
+	Status    string `json:"status"`
+	Statement string `json:"statement"`
+}
+
+// ManualBrokerage serves a user's attested manual holdings as a brokerage account. Prices
+// come from MarketData when it is set. It cannot trade, but it can lock shares.
+type ManualBrokerage struct {
+	DB            *badger.DB
+	MarketData    *marketdata.Client
+	UserAccountId string
+}
+
+func NewManualBrokerage(db *badger.DB, marketData *marketdata.Client, userAccountId string) *ManualBrokerage {
+	return &ManualBrokerage{DB: db, MarketData: marketData, UserAccountId: userAccountId}
+}
+
+func getManualHoldings(txn *badger.Txn, userAccountId string) (ManualHoldings, error) {
+	var holdings ManualHoldings
+	item, err := txn.Get([]byte(manualHoldingsPrefix + userAccountId))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return holdings, ErrHoldingsNotFound
+	}
+	if err != nil {
+		return holdings, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &holdings)
+	})
+	return holdings, err
+}
+
+func putManualHoldings(txn *badger.Txn, holdings ManualHoldings) error {
+	marshaledHoldings, err := json.Marshal(holdings)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(manualHoldingsPrefix+holdings.UserAccountId), marshaledHoldings)
+}
+
+// inForce returns the holdings that count as positions, and false if none were ever attested.
+func (h ManualHoldings) inForce() ([]ManualHolding, bool) {
+	if h.Status == HoldingsAttested {
+		return h.Holdings, true
+	}
+	return h.Attested, h.Attested != nil
+}
+
+func (m *ManualBrokerage) holdings() (ManualHoldings, error) {
+	var holdings ManualHoldings
+	err := m.DB.View(func(txn *badger.Txn) error {
+		var err error
+		holdings, err = getManualHoldings(txn, m.UserAccountId)
+		return err
+	})
+	return holdings, err
+}
+
+func (m *ManualBrokerage) Provider() string {
+	return BrokerageManual
+}
+
+func (m *ManualBrokerage) Account() (BrokerageAccount, error) {
+	holdings, err := m.holdings()
+	if err != nil {
+		return BrokerageAccount{}, err
+	}
+	account := BrokerageAccount{
+		Provider:      BrokerageManual,
+		AccountNumber: "manual-" + m.UserAccountId,
+		Status:        strings.ToUpper(holdings.Status),
+		Currency:      "USD",
+	}
+	positions, err := m.Positions()
+	if err != nil {
+		return BrokerageAccount{}, err
+	}
+	for _, position := range positions {
+		account.Equity = account.Equity.Add(position.MarketValue)
+	}
+	account.PortfolioValue = account.Equity
+	return account, nil
+}
+
+// Positions are the holdings in force, valued at the latest trade price when available.
+func (m *ManualBrokerage) Positions() ([]BrokeragePosition, error) {
+	holdings, err := m.holdings()
+	if errors.Is(err, ErrHoldingsNotFound) {
+		return []BrokeragePosition{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	positions := []BrokeragePosition{}
+	inForce, _ := holdings.inForce()
+	for _, holding := range inForce {
+		position := BrokeragePosition{
+			Symbol:       holding.Symbol,
+			Qty:          holding.Qty,
+			QtyAvailable: holding.Qty.Sub(holding.Locked),
+			CostBasis:    holding.CostBasis,
+			Locked:       holding.Locked,
+		}
+		if holding.Qty.IsPositive() {
+			position.AvgEntryPrice = holding.CostBasis.Div(holding.Qty)
+		}
+		if quote, err := latestQuote(m.MarketData, holding.Symbol); err == nil {
+			position.CurrentPrice = decimal.NewFromFloat(quote.LastPrice)
+			position.MarketValue = position.CurrentPrice.Mul(holding.Qty)
+			position.UnrealizedPL = position.MarketValue.Sub(holding.CostBasis)
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// Position fails with ErrHoldingsNotAttested while no holdings are in force, since the user's
+// position is then unknown rather than empty.
+func (m *ManualBrokerage) Position(symbol string) (BrokeragePosition, error) {
+	holdings, err := m.holdings()
+	if errors.Is(err, ErrHoldingsNotFound) {
+		return BrokeragePosition{}, ErrHoldingsNotAttested
+	}
+	if err != nil {
+		return BrokeragePosition{}, err
+	}
+	if _, ok := holdings.inForce(); !ok {
+		return BrokeragePosition{}, ErrHoldingsNotAttested
+	}
+	positions, err := m.Positions()
+	if err != nil {
+		return BrokeragePosition{}, err
+	}
+	for _, position := range positions {
+		if position.Symbol == symbol {
+			return position, nil
+		}
+	}
+	return BrokeragePosition{}, ErrPositionNotFound
+}
+
+func (m *ManualBrokerage) PortfolioHistory(request PortfolioHistoryRequest) (PortfolioHistory, error) {
+	return PortfolioHistory{}, ErrBrokerageUnsupported
+}
+
+func (m *ManualBrokerage) Quote(symbol string) (Quote, error) {
+	return latestQuote(m.MarketData, symbol)
+}
+
+func (m *ManualBrokerage) PlaceOrder(request OrderRequest) (Order, error) {
+	return Order{}, ErrBrokerageUnsupported
+}
+
+// adjustLock adds delta to the locked shares of symbol, keeping them between zero and the
+// quantity in force. Holdings awaiting attestation carry the same locks, so they stay in
+// step when the new holdings are attested.
+func (m *ManualBrokerage) adjustLock(symbol string, delta decimal.Decimal) error {
+	return m.DB.Update(func(txn *badger.Txn) error {
+		holdings, err := getManualHoldings(txn, m.UserAccountId)
+		if err != nil {
+			return err
+		}
+		inForce, _ := holdings.inForce()
+		found := false
+		for j := range inForce {
+			holding := &inForce[j]
+			if holding.Symbol != symbol {
+				continue
+			}
+			locked := holding.Locked.Add(delta)
+			if delta.IsPositive() && locked.GreaterThan(holding.Qty) {
+				return ErrInsufficientShares
+			}
+			if locked.IsNegative() {
+				locked = decimal.Zero
+			}
+			holding.Locked = locked
+			found = true
+		}
+		if !found {
+			if delta.IsPositive() {
+				return ErrInsufficientShares
+			}
+			return ErrPositionNotFound
+		}
+		if holdings.Status != HoldingsAttested {
+			for j := range holdings.Holdings {
+				holding := &holdings.Holdings[j]
+				if holding.Symbol == symbol {
+					holding.Locked = decimal.Max(holding.Locked.Add(delta), decimal.Zero)
+				}
+			}
+		}
+		return putManualHoldings(txn, holdings)
+	})
+}
+
+func (m *ManualBrokerage) LockShares(symbol string, qty decimal.Decimal) error {
+	return m.adjustLock(symbol, qty)
+}
+
+func (m *ManualBrokerage) UnlockShares(symbol string, qty decimal.Decimal) error {
+	return m.adjustLock(symbol, qty.Neg())
+}
+
+// parseHoldingsCSV reads symbol,qty[,cost_basis] rows. A header row is skipped.
+func parseHoldingsCSV(body io.Reader) ([]ManualHolding, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	holdings := []ManualHolding{}
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("row %d: expected symbol,qty[,cost_basis]", i+1)
+		}
+		qty, err := decimal.NewFromString(strings.TrimSpace(row[1]))
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: invalid qty %q", i+1, row[1])
+		}
+		holding := ManualHolding{Symbol: row[0], Qty: qty}
+		if len(row) > 2 && strings.TrimSpace(row[2]) != "" {
+			holding.CostBasis, err = decimal.NewFromString(strings.TrimSpace(row[2]))
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid cost basis %q", i+1, row[2])
+			}
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, nil
+}
+
+// HandleUploadHoldings replaces the user's manual holdings with a CSV (symbol,qty,cost_basis)
+// or JSON ({"holdings": [...]}) statement, pending attestation. Users with a connected
+// brokerage account cannot upload holdings, and a statement cannot drop below locked shares.
+func (u *UserHandler) HandleUploadHoldings(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if _, err := hiero.AccountIDFromString(userAccountId); err != nil {
+		http.Error(w, "Invalid user account ID", http.StatusBadRequest)
+		return
+	}
+	credentials, err := u.Credentials.Get(userAccountId)
+	if err == nil && credentials.Provider != BrokerageManual {
+		http.Error(w, "Disconnect your brokerage account before uploading holdings", http.StatusConflict)
+		return
+	}
+	if err != nil && !errors.Is(err, ErrBrokerageNotLinked) {
+		fmt.Println("Error getting brokerage account: ", err)
+		http.Error(w, "Failed to upload holdings", http.StatusInternalServerError)
+		return
+	}
+
+	var holdings []ManualHolding
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var request ManualHoldings
+		err = json.NewDecoder(r.Body).Decode(&request)
+		holdings = request.Holdings
+	} else {
+		holdings, err = parseHoldingsCSV(r.Body)
+	}
+	if err != nil {
+		http.Error(w, "Invalid holdings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	bySymbol := map[string]ManualHolding{}
+	for _, holding := range holdings {
+		holding.Symbol = normalizeSymbol(holding.Symbol)
+		if holding.Symbol == "" || !holding.Qty.IsPositive() || holding.CostBasis.IsNegative() {
+			http.Error(w, "Holdings need a symbol and a positive quantity", http.StatusBadRequest)
+			return
+		}
+		if _, duplicate := bySymbol[holding.Symbol]; duplicate {
+			http.Error(w, "Duplicate holding for "+holding.Symbol, http.StatusBadRequest)
+			return
+		}
+		holding.Locked = decimal.Zero
+		bySymbol[holding.Symbol] = holding
+	}
+
+	var uploaded ManualHoldings
+	err = u.DB.Update(func(txn *badger.Txn) error {
+		previous, err := getManualHoldings(txn, userAccountId)
+		if err != nil && !errors.Is(err, ErrHoldingsNotFound) {
+			return err
+		}
+		uploaded = ManualHoldings{
+			UserAccountId: userAccountId,
+			Holdings:      []ManualHolding{},
+			Status:        HoldingsPending,
+			UploadedAt:    time.Now().Format(time.RFC3339),
+		}
+		// the holdings in force stay so until the operator attests the new ones
+		uploaded.Attested, _ = previous.inForce()
+		for _, old := range previous.Holdings {
+			holding, ok := bySymbol[old.Symbol]
+			if old.Locked.IsPositive() && (!ok || holding.Qty.LessThan(old.Locked)) {
+				return fmt.Errorf("%w: %s has %s locked shares", ErrInsufficientShares, old.Symbol, old.Locked)
+			}
+			if ok {
+				holding.Locked = old.Locked
+				bySymbol[old.Symbol] = holding
+			}
+		}
+		for _, holding := range holdings {
+			uploaded.Holdings = append(uploaded.Holdings, bySymbol[normalizeSymbol(holding.Symbol)])
+		}
+		return putManualHoldings(txn, uploaded)
+	})
+	if err == nil {
+		err = u.Credentials.LinkManual(userAccountId)
+	}
+	if errors.Is(err, ErrInsufficientShares) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error storing holdings: ", err)
+		http.Error(w, "Failed to upload holdings", http.StatusInternalServerError)
+		return
+	}
+	writeManualHoldings(w, uploaded)
+}
+
+func (u *UserHandler) HandleGetHoldings(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	var holdings ManualHoldings
+	err := u.DB.View(func(txn *badger.Txn) error {
+		var err error
+		holdings, err = getManualHoldings(txn, userAccountId)
+		return err
+	})
+	if errors.Is(err, ErrHoldingsNotFound) {
+		http.Error(w, "No holdings uploaded", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error getting holdings: ", err)
+		http.Error(w, "Failed to get holdings", http.StatusInternalServerError)
+		return
+	}
+	writeManualHoldings(w, holdings)
+}
+
+// HandleAttestHoldings records an operator's review of a user's uploaded statement.
+func (u *UserHandler) HandleAttestHoldings(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	var request AttestHoldingsRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || (request.Status != HoldingsAttested && request.Status != HoldingsRejected) {
+		http.Error(w, "Status must be attested or rejected", http.StatusBadRequest)
+		return
+	}
+	var holdings ManualHoldings
+	err = u.DB.Update(func(txn *badger.Txn) error {
+		holdings, err = getManualHoldings(txn, userAccountId)
+		if err != nil {
+			return err
+		}
+		holdings.Status = request.Status
+		holdings.Statement = request.Statement
+		holdings.AttestedAt = time.Now().Format(time.RFC3339)
+		if request.Status == HoldingsAttested {
+			// shares locked against the old holdings since the upload must still be there
+			for _, old := range holdings.Attested {
+				if !old.Locked.IsPositive() {
+					continue
+				}
+				covered := false
+				for _, holding := range holdings.Holdings {
+					covered = covered || (holding.Symbol == old.Symbol && holding.Qty.GreaterThanOrEqual(old.Locked))
+				}
+				if !covered {
+					return fmt.Errorf("%w: %s has %s locked shares", ErrInsufficientShares, old.Symbol, old.Locked)
+				}
+			}
+			holdings.Attested = nil
+		}
+		return putManualHoldings(txn, holdings)
+	})
+	if errors.Is(err, ErrHoldingsNotFound) {
+		http.Error(w, "No holdings uploaded", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInsufficientShares) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error attesting holdings: ", err)
+		http.Error(w, "Failed to attest holdings", http.StatusInternalServerError)
+		return
+	}
+	writeManualHoldings(w, holdings)
+}
+
+func writeManualHoldings(w http.ResponseWriter, holdings ManualHoldings) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(map[string]ManualHoldings{
+		"holdings": holdings,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode holdings", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+)
+
+func newManualTestRouter(u *UserHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Post("/brokerage/{userAccountId}/holdings", u.HandleUploadHoldings)
+	r.Post("/admin/holdings/{userAccountId}/attest", u.HandleAttestHoldings)
+	return r
+}
+
+func post(t *testing.T, handler http.Handler, target, contentType, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestManualHoldingsStayInForceUntilReattested(t *testing.T) {
+	db := newTestDB(t)
+	u := &UserHandler{DB: db, Credentials: NewBrokerageCredentialStore(db, nil)}
+	router := newManualTestRouter(u)
+	brokerage := NewManualBrokerage(db, nil, "0.0.1001")
+	upload := func(csv string) int {
+		return post(t, router, "/brokerage/0.0.1001/holdings", "text/csv", csv)
+	}
+	attest := func() int {
+		return post(t, router, "/admin/holdings/0.0.1001/attest", "application/json", `{"status": "attested"}`)
+	}
+	qty := func() decimal.Decimal {
+		t.Helper()
+		position, err := brokerage.Position("AAPL")
+		if err != nil {
+			t.Fatalf("position: %v", err)
+		}
+		return position.Qty
+	}
+
+	if status := upload("symbol,qty\nAAPL,10\n"); status != http.StatusOK {
+		t.Fatalf("upload status = %d", status)
+	}
+	if _, err := brokerage.Position("AAPL"); !errors.Is(err, ErrHoldingsNotAttested) {
+		t.Fatalf("position before attestation: error = %v, want %v", err, ErrHoldingsNotAttested)
+	}
+	if status := attest(); status != http.StatusOK {
+		t.Fatalf("attest status = %d", status)
+	}
+	if err := brokerage.LockShares("AAPL", decimal.NewFromInt(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new statement leaves the attested holdings in force while it is reviewed
+	if status := upload("symbol,qty\nAAPL,6\n"); status != http.StatusOK {
+		t.Fatalf("re-upload status = %d", status)
+	}
+	if got := qty(); !got.Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("qty while pending = %s, want 10", got)
+	}
+	// shares can still be locked against the holdings in force, up to their quantity
+	if err := brokerage.LockShares("AAPL", decimal.NewFromInt(3)); err != nil {
+		t.Fatal(err)
+	}
+	// the new statement no longer covers the 7 locked shares
+	if status := attest(); status != http.StatusConflict {
+		t.Fatalf("attest status = %d, want %d", status, http.StatusConflict)
+	}
+	if got := qty(); !got.Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("qty after refused attestation = %s, want 10", got)
+	}
+
+	if status := upload("symbol,qty\nAAPL,8\n"); status != http.StatusOK {
+		t.Fatalf("re-upload status = %d", status)
+	}
+	if status := attest(); status != http.StatusOK {
+		t.Fatalf("attest status = %d", status)
+	}
+	position, err := brokerage.Position("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !position.Qty.Equal(decimal.NewFromInt(8)) || !position.Locked.Equal(decimal.NewFromInt(7)) {
+		t.Fatalf("position = %s with %s locked, want 8 with 7 locked", position.Qty, position.Locked)
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const marketPrefix = "market:"
+
+var ErrMarketNotFound = errors.New("market not found")
+
+type MarketRecord struct {
+	MarketId           string       `json:"marketId"`
+	Name               string       `json:"name"`
+	Params             MarketParams `json:"params"`
+	LoanSymbol         string       `json:"loanSymbol"`
+	CollateralSymbol   string       `json:"collateralSymbol"`
+	LoanDecimals       int          `json:"loanDecimals"`
+	CollateralDecimals int          `json:"collateralDecimals"`
+	TransactionId      string       `json:"transactionId,omitempty"`
+	CreatedAt          string       `json:"createdAt"`
+}
+
+type CreateMarketRequest struct {
+	Name            string `json:"name"`
+	LoanToken       string `json:"loanToken"`
+	CollateralToken string `json:"collateralToken"`
+	Oracle          string `json:"oracle"`
+	Irm             string `json:"irm"`
+	Lltv            string `json:"lltv"`
+}
+
+// MarketRegistry keeps the lending markets the backend serves, keyed by their Morpho id.
+type MarketRegistry struct {
+	DB *badger.DB
+}
+
+func NewMarketRegistry(db *badger.DB) *MarketRegistry {
+	return &MarketRegistry{DB: db}
+}
+
+// computeMarketId is MarketParamsLib.id: keccak256 of the abi-encoded MarketParams.
+func computeMarketId(params MarketParams) (string, error) {
+	addressType, _ := abi.NewType("address", "", nil)
+	uintType, _ := abi.NewType("uint256", "", nil)
+	encoded, err := abi.Arguments{
+		{Type: addressType}, {Type: addressType}, {Type: addressType}, {Type: addressType}, {Type: uintType},
+	}.Pack(params.LoanToken, params.CollateralToken, params.Oracle, params.Irm, params.Lltv)
+	if err != nil {
+		return "", err
+	}
+	return crypto.Keccak256Hash(encoded).Hex(), nil
+}
+
+// parseEvmAddress accepts a 0x EVM address or a Hedera entity id (0.0.x) and returns the
+// address the pool knows it by.
+func parseEvmAddress(value string) (common.Address, error) {
+	if common.IsHexAddress(value) {
+		return common.HexToAddress(value), nil
+	}
+	accountId, err := hiero.AccountIDFromString(value)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid address %q", value)
+	}
+	return common.HexToAddress(accountId.ToSolidityAddress()), nil
+}
+
+func (m *MarketRegistry) put(record MarketRecord) error {
+	marshaledRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return m.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(marketPrefix+record.MarketId), marshaledRecord)
+	})
+}
+
+func newMarketRecord(marketId, name string, params MarketParams) (MarketRecord, error) {
+	loanDecimals, err := tokenDecimals(params.LoanToken)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	collateralDecimals, err := tokenDecimals(params.CollateralToken)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	record := MarketRecord{
+		MarketId:           strings.ToLower(marketId),
+		Name:               name,
+		Params:             params,
+		LoanSymbol:         tokenSymbol(params.LoanToken.Hex()),
+		CollateralSymbol:   tokenSymbol(params.CollateralToken.Hex()),
+		LoanDecimals:       loanDecimals,
+		CollateralDecimals: collateralDecimals,
+		CreatedAt:          time.Now().Format(time.RFC3339),
+	}
+	if record.Name == "" {
+		record.Name = record.CollateralSymbol + "/" + record.LoanSymbol
+	}
+	return record, nil
+}
+
+// Get returns a registered market. Markets created on the pool outside the registry are
+// imported from idToMarketParams the first time they are asked for.
+func (m *MarketRegistry) Get(marketId string) (MarketRecord, error) {
+	if _, err := marketIdToBytes32(marketId); err != nil {
+		return MarketRecord{}, err
+	}
+	marketId = strings.ToLower(marketId)
+	var record MarketRecord
+	err := m.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(marketPrefix + marketId))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+	})
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		return MarketRecord{}, err
+	}
+
+	params, err := getMarketParams(marketId)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	if params.LoanToken == (common.Address{}) {
+		return MarketRecord{}, ErrMarketNotFound
+	}
+	record, err = newMarketRecord(marketId, "", params)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	return record, m.put(record)
+}
+
+func (m *MarketRegistry) List() ([]MarketRecord, error) {
+	records := []MarketRecord{}
+	err := m.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(marketPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var record MarketRecord
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &record)
+			})
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		// the registry always serves the original dAAPL/HASH market
+		record, err := m.Get(DefaultMarketId)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Create enables the IRM and LLTV on the pool if needed, creates the market and registers it.
+// Creating a market that already exists on the pool just registers it.
+func (m *MarketRegistry) Create(name string, params MarketParams) (MarketRecord, error) {
+	marketId, err := computeMarketId(params)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	existing, err := getMarketPosition(marketId)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+
+	var txId string
+	if existing.LastUpdate.Sign() == 0 {
+		var irmEnabled, lltvEnabled bool
+		err = callPool("isIrmEnabled", &irmEnabled, params.Irm)
+		if err != nil {
+			return MarketRecord{}, err
+		}
+		if !irmEnabled {
+			_, err = executePool("enableIrm", 300_000, params.Irm)
+			if err != nil {
+				return MarketRecord{}, err
+			}
+		}
+		err = callPool("isLltvEnabled", &lltvEnabled, params.Lltv)
+		if err != nil {
+			return MarketRecord{}, err
+		}
+		if !lltvEnabled {
+			_, err = executePool("enableLltv", 300_000, params.Lltv)
+			if err != nil {
+				return MarketRecord{}, err
+			}
+		}
+		txId, err = executePool("createMarket", 1_000_000, params)
+		if err != nil {
+			return MarketRecord{}, err
+		}
+	}
+
+	record, err := newMarketRecord(marketId, name, params)
+	if err != nil {
+		return MarketRecord{}, err
+	}
+	record.TransactionId = txId
+	return record, m.put(record)
+}
+
+func (m *MarketRegistry) HandleListMarkets(w http.ResponseWriter, r *http.Request) {
+	markets, err := m.List()
+	if err != nil {
+		fmt.Println("Error listing markets: ", err)
+		http.Error(w, "Failed to list markets", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]MarketRecord{
+		"markets": markets,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode markets", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (m *MarketRegistry) HandleCreateMarket(w http.ResponseWriter, r *http.Request) {
+	var request CreateMarketRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Failed to decode market", http.StatusBadRequest)
+		return
+	}
+	var params MarketParams
+	for _, field := range []struct {
+		value string
+		dest  *common.Address
+	}{
+		{request.LoanToken, &params.LoanToken},
+		{request.CollateralToken, &params.CollateralToken},
+		{request.Oracle, &params.Oracle},
+		{request.Irm, &params.Irm},
+	} {
+		*field.dest, err = parseEvmAddress(field.value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	lltv, ok := new(big.Int).SetString(request.Lltv, 10)
+	if !ok || lltv.Sign() <= 0 || lltv.Cmp(wad) >= 0 {
+		http.Error(w, "LLTV must be a WAD value between 0 and 1e18", http.StatusBadRequest)
+		return
+	}
+	params.Lltv = lltv
+
+	record, err := m.Create(request.Name, params)
+	if err != nil {
+		fmt.Println("Error creating market: ", err)
+		http.Error(w, "Failed to create market", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]MarketRecord{
+		"market": record,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode market", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/imroc/req/v3"
+)
+
+// MirrorNodeURL is a variable so tests can point it at a stub.
+var MirrorNodeURL = "https://testnet.mirrornode.hedera.com"
+
+type MirrorLinks struct {
+	Next string `json:"next"`
+}
+
+type ContractLog struct {
+	Address          string   `json:"address"`
+	ContractId       string   `json:"contract_id"`
+	Data             string   `json:"data"`
+	Index            int64    `json:"index"`
+	Topics           []string `json:"topics"`
+	BlockNumber      int64    `json:"block_number"`
+	TransactionIndex int64    `json:"transaction_index"`
+	Timestamp        string   `json:"timestamp"`
+	TransactionHash  string   `json:"transaction_hash"`
+}
+
+type ContractLogsMNAPIResponse struct {
+	Logs  []ContractLog `json:"logs"`
+	Links MirrorLinks   `json:"links"`
+}
+
+// mirrorGet fetches a mirror node path (with or without the host) and decodes the JSON body.
+func mirrorGet(path string, out interface{}) error {
+	url := path
+	if !strings.HasPrefix(path, "http") {
+		url = MirrorNodeURL + path
+	}
+	httpResp, err := req.R().Get(url)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode >= 400 {
+		return fmt.Errorf("mirror node returned %d for %s", httpResp.StatusCode, url)
+	}
+	return json.Unmarshal(httpResp.Bytes(), out)
+}
+
+// getContractLogs pages through a contract's logs starting at `path`, calling fn for each page
+// until there is no next link or fn returns false.
+func getContractLogs(path string, fn func(page ContractLogsMNAPIResponse) (bool, error)) error {
+	for path != "" {
+		var page ContractLogsMNAPIResponse
+		err := mirrorGet(path, &page)
+		if err != nil {
+			return err
+		}
+		more, err := fn(page)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+		path = page.Links.Next
+	}
+	return nil
+}
+
+type AccountMNAPIResponse struct {
+	Account    string `json:"account"`
+	EvmAddress string `json:"evm_address"`
+	Balance    struct {
+		// in tinybars
+		Balance int64 `json:"balance"`
+	} `json:"balance"`
+	// Key is the account's key: ED25519 or ECDSA_SECP256K1 with the hex encoded public key,
+	// or ProtobufEncoded for threshold and key lists
+	Key struct {
+		Type string `json:"_type"`
+		Key  string `json:"key"`
+	} `json:"key"`
+}
+
+// resolveEvmAddress accepts either an EVM address or a Hedera account id (0.0.x) and returns
+// the account's EVM address as known by the mirror node.
+func resolveEvmAddress(idOrAddress string) (string, error) {
+	if strings.HasPrefix(idOrAddress, "0x") {
+		return strings.ToLower(idOrAddress), nil
+	}
+	var account AccountMNAPIResponse
+	err := mirrorGet("/api/v1/accounts/"+idOrAddress, &account)
+	if err != nil {
+		return "", err
+	}
+	if account.EvmAddress == "" {
+		return "", fmt.Errorf("no evm address for account %s", idOrAddress)
+	}
+	return strings.ToLower(account.EvmAddress), nil
+}
+
+type TokenInfoMNAPIResponse struct {
+	TokenId           string `json:"token_id"`
+	Symbol            string `json:"symbol"`
+	Name              string `json:"name"`
+	Decimals          string `json:"decimals"`
+	TotalSupply       string `json:"total_supply"`
+	TreasuryAccountId string `json:"treasury_account_id"`
+}
+
+func getTokenInfo(tokenId string) (TokenInfoMNAPIResponse, error) {
+	var token TokenInfoMNAPIResponse
+	err := mirrorGet("/api/v1/tokens/"+tokenId, &token)
+	return token, err
+}
+
+// evmTokenId is the token id behind an HTS token's long-zero EVM address.
+func evmTokenId(address common.Address) (string, error) {
+	tokenId, err := hiero.TokenIDFromSolidityAddress(strings.TrimPrefix(address.Hex(), "0x"))
+	if err != nil {
+		return "", err
+	}
+	return tokenId.String(), nil
+}
+
+var tokenDecimalsCache sync.Map
+
+// tokenDecimals returns an HTS token's decimals given its long-zero EVM address.
+func tokenDecimals(address common.Address) (int, error) {
+	if cached, ok := tokenDecimalsCache.Load(address); ok {
+		return cached.(int), nil
+	}
+	tokenId, err := evmTokenId(address)
+	if err != nil {
+		return 0, err
+	}
+	token, err := getTokenInfo(tokenId)
+	if err != nil {
+		return 0, err
+	}
+	decimals, err := strconv.Atoi(token.Decimals)
+	if err != nil {
+		return 0, err
+	}
+	tokenDecimalsCache.Store(address, decimals)
+	return decimals, nil
+}
+
+// TokenRelationship is an account's association with a token. KycStatus is GRANTED, REVOKED,
+// or NOT_APPLICABLE for tokens without a KYC key.
+type TokenRelationship struct {
+	TokenId      string `json:"token_id"`
+	Balance      int64  `json:"balance"`
+	KycStatus    string `json:"kyc_status"`
+	FreezeStatus string `json:"freeze_status"`
+}
+
+type AccountTokensMNAPIResponse struct {
+	Tokens []TokenRelationship `json:"tokens"`
+	Links  MirrorLinks         `json:"links"`
+}
+
+// tokenRelationship returns an account's relationship with a token and whether the account
+// is associated with it.
+func tokenRelationship(accountId string, tokenId string) (TokenRelationship, bool, error) {
+	var tokens AccountTokensMNAPIResponse
+	err := mirrorGet(fmt.Sprintf("/api/v1/accounts/%s/tokens?token.id=%s", accountId, tokenId), &tokens)
+	if err != nil {
+		return TokenRelationship{}, false, err
+	}
+	for _, token := range tokens.Tokens {
+		if token.TokenId == tokenId {
+			return token, true, nil
+		}
+	}
+	return TokenRelationship{}, false, nil
+}
+
+// accountTokens returns every token relationship of an account.
+func accountTokens(accountId string) ([]TokenRelationship, error) {
+	relationships := []TokenRelationship{}
+	path := fmt.Sprintf("/api/v1/accounts/%s/tokens?limit=100", accountId)
+	for path != "" {
+		var tokens AccountTokensMNAPIResponse
+		err := mirrorGet(path, &tokens)
+		if err != nil {
+			return nil, err
+		}
+		relationships = append(relationships, tokens.Tokens...)
+		path = tokens.Links.Next
+	}
+	return relationships, nil
+}
+
+type ExchangeRateMNAPIResponse struct {
+	CurrentRate struct {
+		CentEquivalent int64 `json:"cent_equivalent"`
+		HbarEquivalent int64 `json:"hbar_equivalent"`
+	} `json:"current_rate"`
+}
+
+// hbarUSDPrice is the network's current exchange rate, the one fees are charged at.
+func hbarUSDPrice() (float64, error) {
+	var rate ExchangeRateMNAPIResponse
+	err := mirrorGet("/api/v1/network/exchangerate", &rate)
+	if err != nil {
+		return 0, err
+	}
+	if rate.CurrentRate.HbarEquivalent == 0 {
+		return 0, errors.New("mirror node returned no exchange rate")
+	}
+	return float64(rate.CurrentRate.CentEquivalent) / float64(rate.CurrentRate.HbarEquivalent) / 100, nil
+}
+
+// accountTokenBalance is an account's balance of a token in its smallest unit, 0 when the
+// account is not associated with it.
+func accountTokenBalance(accountId string, tokenId string) (int64, error) {
+	relationship, _, err := tokenRelationship(accountId, tokenId)
+	return relationship.Balance, err
+}
+
+type MirrorTransaction struct {
+	TransactionId      string `json:"transaction_id"`
+	ConsensusTimestamp string `json:"consensus_timestamp"`
+	Result             string `json:"result"`
+	TokenTransfers     []struct {
+		TokenId    string `json:"token_id"`
+		Account    string `json:"account"`
+		Amount     int64  `json:"amount"`
+		IsApproval bool   `json:"is_approval"`
+	} `json:"token_transfers"`
+}
+
+type TransactionsMNAPIResponse struct {
+	Transactions []MirrorTransaction `json:"transactions"`
+}
+
+// mirrorTransactionId converts an SDK transaction id (0.0.x@seconds.nanos) to the form the
+// mirror node uses in paths (0.0.x-seconds-nanos).
+func mirrorTransactionId(transactionId string) string {
+	account, validStart, found := strings.Cut(transactionId, "@")
+	if !found {
+		return transactionId
+	}
+	return account + "-" + strings.Replace(validStart, ".", "-", 1)
+}
+
+// getMirrorTransaction returns a transaction as the mirror node recorded it, and false while
+// it has not ingested it yet.
+func getMirrorTransaction(transactionId string) (MirrorTransaction, bool, error) {
+	var transactions TransactionsMNAPIResponse
+	url := MirrorNodeURL + "/api/v1/transactions/" + mirrorTransactionId(transactionId)
+	httpResp, err := req.R().Get(url)
+	if err != nil {
+		return MirrorTransaction{}, false, err
+	}
+	if httpResp.StatusCode == http.StatusNotFound {
+		return MirrorTransaction{}, false, nil
+	}
+	if httpResp.StatusCode >= 400 {
+		return MirrorTransaction{}, false, fmt.Errorf("mirror node returned %d for %s", httpResp.StatusCode, url)
+	}
+	err = json.Unmarshal(httpResp.Bytes(), &transactions)
+	if err != nil {
+		return MirrorTransaction{}, false, err
+	}
+	if len(transactions.Transactions) == 0 {
+		return MirrorTransaction{}, false, nil
+	}
+	return transactions.Transactions[0], true, nil
+}
+
+// mirrorTransactionResult is the result the mirror node recorded for a transaction, or ""
+// while it has not ingested it yet.
+func mirrorTransactionResult(transactionId string) (string, error) {
+	transaction, _, err := getMirrorTransaction(transactionId)
+	return transaction.Result, err
+}
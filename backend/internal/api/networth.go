@@ -0,0 +1,254 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+)
+
+// Net worth categories. Borrow items carry negative values.
+const (
+	NetWorthBrokerage  = "brokerage"
+	NetWorthHbar       = "hbar"
+	NetWorthTokens     = "tokens"
+	NetWorthTokenized  = "tokenized"
+	NetWorthSupply     = "lendingSupply"
+	NetWorthCollateral = "lendingCollateral"
+	NetWorthBorrow     = "lendingBorrow"
+)
+
+// NetWorthItem is one holding or debt. Amount is in whole tokens or shares. Tokens without a
+// price are listed with Priced false and count for nothing.
+type NetWorthItem struct {
+	Category string  `json:"category"`
+	Asset    string  `json:"asset"`
+	TokenId  string  `json:"tokenId,omitempty"`
+	MarketId string  `json:"marketId,omitempty"`
+	Amount   float64 `json:"amount"`
+	PriceUSD float64 `json:"priceUSD"`
+	ValueUSD float64 `json:"valueUSD"`
+	Priced   bool    `json:"priced"`
+}
+
+// NetWorth is everything a user holds across the brokerage and the network, less what they
+// owe the lending pool.
+type NetWorth struct {
+	Items      []NetWorthItem     `json:"items"`
+	Categories map[string]float64 `json:"categories"`
+	TotalUSD   float64            `json:"totalUSD"`
+}
+
+func (n *NetWorth) add(item NetWorthItem) {
+	n.Items = append(n.Items, item)
+	n.Categories[item.Category] += item.ValueUSD
+	n.TotalUSD += item.ValueUSD
+}
+
+// netWorthPrices looks up and remembers the USD prices a valuation needs.
+type netWorthPrices struct {
+	u      *UserHandler
+	oracle map[string]float64
+}
+
+// stock is the last oracle price of a stock, and false if none has been published.
+func (p *netWorthPrices) stock(symbol string) (float64, bool, error) {
+	if price, ok := p.oracle[symbol]; ok {
+		return price, price > 0, nil
+	}
+	price, ok, err := latestOraclePrice(p.u.DB, symbol)
+	if err != nil {
+		return 0, false, err
+	}
+	p.oracle[symbol] = price.Price
+	return price.Price, ok, nil
+}
+
+func shiftDecimals(amount int64, decimals int) float64 {
+	return float64(amount) / math.Pow10(decimals)
+}
+
+// netWorth values a user's holdings. Shares locked behind tokens are left out of the
+// brokerage value, since the tokens the user holds are counted at oracle prices instead and
+// those they passed on are no longer theirs. A lookup that fails is logged and degrades the
+// items it affects, listed with Priced false, rather than the whole valuation.
+func (u *UserHandler) netWorth(userAccountId string, positions []BrokeragePosition, account BrokerageAccount, shareLocks []ShareLock) NetWorth {
+	netWorth := NetWorth{Items: []NetWorthItem{}, Categories: map[string]float64{}}
+	prices := &netWorthPrices{u: u, oracle: map[string]float64{}}
+
+	brokerageValue := account.PortfolioValue
+	for _, lock := range shareLocks {
+		shares, err := decimal.NewFromString(lock.Shares)
+		if err != nil {
+			fmt.Println("Error reading share lock for ", lock.Symbol, ": ", err)
+			continue
+		}
+		for _, position := range positions {
+			if position.Symbol == lock.Symbol {
+				// a shortfall leaves fewer shares in the position than the lock covers
+				brokerageValue = brokerageValue.Sub(decimal.Min(shares, position.Qty).Mul(position.CurrentPrice))
+			}
+		}
+	}
+	netWorth.add(NetWorthItem{
+		Category: NetWorthBrokerage,
+		Asset:    "USD",
+		Amount:   brokerageValue.InexactFloat64(),
+		PriceUSD: 1,
+		ValueUSD: brokerageValue.InexactFloat64(),
+		Priced:   true,
+	})
+
+	var mirrorAccount AccountMNAPIResponse
+	err := mirrorGet("/api/v1/accounts/"+userAccountId, &mirrorAccount)
+	if err != nil {
+		fmt.Println("Error getting account for net worth: ", err)
+		netWorth.add(NetWorthItem{Category: NetWorthHbar, Asset: "HBAR"})
+	} else {
+		hbars := shiftDecimals(mirrorAccount.Balance.Balance, 8)
+		item := NetWorthItem{Category: NetWorthHbar, Asset: "HBAR", Amount: hbars}
+		hbarPrice, err := hbarUSDPrice()
+		if err != nil {
+			fmt.Println("Error getting HBAR price for net worth: ", err)
+		} else {
+			item.PriceUSD = hbarPrice
+			item.ValueUSD = hbars * hbarPrice
+			item.Priced = true
+		}
+		netWorth.add(item)
+	}
+
+	assets, err := u.Assets.List()
+	if err != nil {
+		fmt.Println("Error listing assets for net worth: ", err)
+	}
+	assetsByToken := map[string]AssetRecord{}
+	for _, asset := range assets {
+		if asset.TokenId != "" {
+			assetsByToken[asset.TokenId] = asset
+		}
+	}
+	markets, err := u.Markets.List()
+	if err != nil {
+		fmt.Println("Error listing markets for net worth: ", err)
+	}
+	// the tokens markets lend are priced like the oracle quotes them
+	loanTokens := map[string]bool{}
+	for _, market := range markets {
+		tokenId, err := evmTokenId(market.Params.LoanToken)
+		if err == nil {
+			loanTokens[tokenId] = true
+		}
+	}
+	quotePrice := oracleQuotePrice()
+
+	relationships, err := accountTokens(userAccountId)
+	if err != nil {
+		fmt.Println("Error getting token balances for net worth: ", err)
+	}
+	for _, relationship := range relationships {
+		if relationship.Balance == 0 {
+			continue
+		}
+		if asset, ok := assetsByToken[relationship.TokenId]; ok {
+			shares := asset.Shares(relationship.Balance).InexactFloat64()
+			item := NetWorthItem{
+				Category: NetWorthTokenized,
+				Asset:    asset.TokenSymbol,
+				TokenId:  asset.TokenId,
+				Amount:   shares,
+			}
+			price, priced, err := prices.stock(asset.Symbol)
+			if err != nil {
+				fmt.Println("Error getting oracle price of ", asset.Symbol, " for net worth: ", err)
+			} else {
+				item.PriceUSD = price
+				item.ValueUSD = shares * price
+				item.Priced = priced
+			}
+			netWorth.add(item)
+			continue
+		}
+		item := NetWorthItem{
+			Category: NetWorthTokens,
+			Asset:    relationship.TokenId,
+			TokenId:  relationship.TokenId,
+			// in the token's smallest unit until its decimals are known
+			Amount: float64(relationship.Balance),
+		}
+		token, err := getTokenInfo(relationship.TokenId)
+		if err == nil {
+			var decimals int
+			decimals, err = strconv.Atoi(token.Decimals)
+			if err == nil {
+				item.Asset = token.Symbol
+				item.Amount = shiftDecimals(relationship.Balance, decimals)
+			}
+		}
+		if err != nil {
+			fmt.Println("Error getting token ", relationship.TokenId, " for net worth: ", err)
+		} else if loanTokens[relationship.TokenId] {
+			item.PriceUSD = quotePrice
+			item.ValueUSD = item.Amount * quotePrice
+			item.Priced = true
+		}
+		netWorth.add(item)
+	}
+
+	if mirrorAccount.EvmAddress == "" {
+		// without the account's address its lending positions cannot be read
+		return netWorth
+	}
+	for _, market := range markets {
+		position, err := getUserPosition(market.MarketId, mirrorAccount.EvmAddress)
+		if err != nil {
+			fmt.Println("Error getting position in market ", market.MarketId, " for net worth: ", err)
+			continue
+		}
+		if position.SupplyShares > 0 {
+			// SupplyShares and BorrowShares hold the assets the shares are worth, in the
+			// loan token's smallest unit
+			supplied := position.SupplyShares / math.Pow10(market.LoanDecimals)
+			netWorth.add(NetWorthItem{
+				Category: NetWorthSupply,
+				Asset:    market.LoanSymbol,
+				MarketId: market.MarketId,
+				Amount:   supplied,
+				PriceUSD: quotePrice,
+				ValueUSD: supplied * quotePrice,
+				Priced:   true,
+			})
+		}
+		if position.Collateral > 0 {
+			item := NetWorthItem{
+				Category: NetWorthCollateral,
+				Asset:    market.CollateralSymbol,
+				MarketId: market.MarketId,
+				Amount:   position.Collateral,
+			}
+			price, priced, err := prices.stock(underlyingSymbol(market.CollateralSymbol))
+			if err != nil {
+				fmt.Println("Error getting oracle price of ", market.CollateralSymbol, " for net worth: ", err)
+			} else {
+				item.PriceUSD = price
+				item.ValueUSD = position.Collateral * price
+				item.Priced = priced
+			}
+			netWorth.add(item)
+		}
+		if position.BorrowShares > 0 {
+			borrowed := position.BorrowShares / math.Pow10(market.LoanDecimals)
+			netWorth.add(NetWorthItem{
+				Category: NetWorthBorrow,
+				Asset:    market.LoanSymbol,
+				MarketId: market.MarketId,
+				Amount:   borrowed,
+				PriceUSD: quotePrice,
+				ValueUSD: -borrowed * quotePrice,
+				Priced:   true,
+			})
+		}
+	}
+	return netWorth
+}
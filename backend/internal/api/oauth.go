@@ -0,0 +1,354 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/imroc/req/v3"
+)
+
+const oauthStatePrefix = "oauth-state:"
+
+var (
+	defaultAlpacaAuthorizeURL = "https://app.alpaca.markets/oauth/authorize"
+	defaultAlpacaTokenURL     = "https://api.alpaca.markets/oauth/token"
+	defaultAlpacaRevokeURL    = "https://api.alpaca.markets/oauth/revoke"
+	defaultOAuthRedirectURI   = "http://localhost:8080/brokerage/alpaca/callback"
+	defaultBrokerageReturnURL = "http://localhost:5173"
+	oauthStateTTL             = 10 * time.Minute
+)
+
+// OAuthState ties an authorization in progress to the Hedera account that started it and
+// the session it was signed in with. It is stored under a random state value, expires after
+// oauthStateTTL and is used once.
+type OAuthState struct {
+	UserAccountId string `json:"userAccountId"`
+	SessionKey    string `json:"sessionKey"`
+	Paper         bool   `json:"paper"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+}
+
+// BrokerageStatus is a user's linked account and whether its credentials still work.
+type BrokerageStatus struct {
+	Linked        bool   `json:"linked"`
+	Provider      string `json:"provider,omitempty"`
+	Method        string `json:"method,omitempty"`
+	AccountNumber string `json:"accountNumber,omitempty"`
+	Paper         bool   `json:"paper"`
+	LinkedAt      string `json:"linkedAt,omitempty"`
+	Valid         bool   `json:"valid"`
+	AccountStatus string `json:"accountStatus,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// AlpacaOAuth links brokerage accounts with Alpaca's OAuth2 authorization-code flow. The
+// endpoints default to Alpaca's and can be pointed at the stub server in scripts. Both ends
+// of the flow need the user's session, so a callback only links the account to the browser
+// that started it.
+type AlpacaOAuth struct {
+	DB           *badger.DB
+	Credentials  *BrokerageCredentialStore
+	Auth         *Authenticator
+	ClientId     string
+	ClientSecret string
+	RedirectURI  string
+	AuthorizeURL string
+	TokenURL     string
+	ReturnURL    string
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func NewAlpacaOAuth(db *badger.DB, credentials *BrokerageCredentialStore, auth *Authenticator) *AlpacaOAuth {
+	return &AlpacaOAuth{
+		DB:           db,
+		Credentials:  credentials,
+		Auth:         auth,
+		ClientId:     os.Getenv("ALPACA_OAUTH_CLIENT_ID"),
+		ClientSecret: os.Getenv("ALPACA_OAUTH_CLIENT_SECRET"),
+		RedirectURI:  envOr("ALPACA_OAUTH_REDIRECT_URI", defaultOAuthRedirectURI),
+		AuthorizeURL: envOr("ALPACA_OAUTH_AUTHORIZE_URL", defaultAlpacaAuthorizeURL),
+		TokenURL:     envOr("ALPACA_OAUTH_TOKEN_URL", defaultAlpacaTokenURL),
+		ReturnURL:    envOr("BROKERAGE_RETURN_URL", defaultBrokerageReturnURL),
+	}
+}
+
+// revokeAlpacaToken revokes an access token at ALPACA_OAUTH_REVOKE_URL, or at Alpaca's.
+func revokeAlpacaToken(token string) error {
+	revokeURL := envOr("ALPACA_OAUTH_REVOKE_URL", defaultAlpacaRevokeURL)
+	httpResp, err := req.R().SetFormData(map[string]string{
+		"token":         token,
+		"client_id":     os.Getenv("ALPACA_OAUTH_CLIENT_ID"),
+		"client_secret": os.Getenv("ALPACA_OAUTH_CLIENT_SECRET"),
+	}).Post(revokeURL)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode >= 400 {
+		return fmt.Errorf("token revocation returned %d: %s", httpResp.StatusCode, httpResp.String())
+	}
+	return nil
+}
+
+func (o *AlpacaOAuth) putState(state string, oauthState OAuthState) error {
+	marshaledState, err := json.Marshal(oauthState)
+	if err != nil {
+		return err
+	}
+	return o.DB.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(oauthStatePrefix+state), marshaledState).WithTTL(oauthStateTTL))
+	})
+}
+
+// takeState returns and deletes the authorization started under state.
+func (o *AlpacaOAuth) takeState(state string) (OAuthState, error) {
+	var oauthState OAuthState
+	err := o.DB.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(oauthStatePrefix + state))
+		if err != nil {
+			return err
+		}
+		err = item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &oauthState)
+		})
+		if err != nil {
+			return err
+		}
+		return txn.Delete([]byte(oauthStatePrefix + state))
+	})
+	return oauthState, err
+}
+
+// exchange trades an authorization code for an access token.
+func (o *AlpacaOAuth) exchange(code string) (OAuthTokenResponse, error) {
+	var token OAuthTokenResponse
+	httpResp, err := req.R().SetFormData(map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"client_id":     o.ClientId,
+		"client_secret": o.ClientSecret,
+		"redirect_uri":  o.RedirectURI,
+	}).Post(o.TokenURL)
+	if err != nil {
+		return token, err
+	}
+	if httpResp.StatusCode >= 400 {
+		return token, fmt.Errorf("token exchange returned %d: %s", httpResp.StatusCode, httpResp.String())
+	}
+	err = json.Unmarshal(httpResp.Bytes(), &token)
+	if err != nil {
+		return token, err
+	}
+	if token.AccessToken == "" {
+		return token, errors.New("token exchange returned no access token")
+	}
+	return token, nil
+}
+
+// redirectBack returns the browser to the frontend with the outcome of the flow.
+func (o *AlpacaOAuth) redirectBack(w http.ResponseWriter, r *http.Request, outcome string) {
+	returnURL, err := url.Parse(o.ReturnURL)
+	if err != nil {
+		http.Error(w, "Invalid brokerage return URL", http.StatusInternalServerError)
+		return
+	}
+	query := returnURL.Query()
+	query.Set("brokerage", outcome)
+	returnURL.RawQuery = query.Encode()
+	http.Redirect(w, r, returnURL.String(), http.StatusFound)
+}
+
+// HandleConnect starts the flow for the signed-in user, redirecting to Alpaca's consent
+// page. Accounts are paper accounts unless ?paper=false.
+func (o *AlpacaOAuth) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	if o.ClientId == "" {
+		http.Error(w, "Alpaca OAuth is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	userAccountId, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		http.Error(w, "Sign in first", http.StatusUnauthorized)
+		return
+	}
+	paper := r.URL.Query().Get("paper") != "false"
+
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		http.Error(w, "Failed to start brokerage connection", http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(nonce)
+	err = o.putState(state, OAuthState{
+		UserAccountId: userAccountId,
+		SessionKey:    string(sessionKey(requestToken(r))),
+		Paper:         paper,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		fmt.Println("Error storing OAuth state: ", err)
+		http.Error(w, "Failed to start brokerage connection", http.StatusInternalServerError)
+		return
+	}
+
+	authorizeURL, err := url.Parse(o.AuthorizeURL)
+	if err != nil {
+		http.Error(w, "Invalid Alpaca authorize URL", http.StatusInternalServerError)
+		return
+	}
+	env := "live"
+	if paper {
+		env = "paper"
+	}
+	query := authorizeURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", o.ClientId)
+	query.Set("redirect_uri", o.RedirectURI)
+	query.Set("state", state)
+	query.Set("scope", "account:write trading data")
+	query.Set("env", env)
+	authorizeURL.RawQuery = query.Encode()
+	http.Redirect(w, r, authorizeURL.String(), http.StatusFound)
+}
+
+// HandleCallback completes the flow: it checks the state against the browser's session,
+// exchanges the code and links the account to the Hedera account that started the flow.
+func (o *AlpacaOAuth) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		http.Error(w, "Missing state", http.StatusBadRequest)
+		return
+	}
+	oauthState, err := o.takeState(state)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		http.Error(w, "Unknown or expired state", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error reading OAuth state: ", err)
+		http.Error(w, "Failed to connect brokerage account", http.StatusInternalServerError)
+		return
+	}
+	session, err := o.Auth.Session(r)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		fmt.Println("Error reading session: ", err)
+		http.Error(w, "Failed to connect brokerage account", http.StatusInternalServerError)
+		return
+	}
+	// a state used from a browser other than the one that started the flow could link an
+	// attacker's brokerage account to the user, or the user's to the attacker
+	if err != nil || session.UserAccountId != oauthState.UserAccountId || string(sessionKey(requestToken(r))) != oauthState.SessionKey {
+		o.redirectBack(w, r, "unauthorized")
+		return
+	}
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		o.redirectBack(w, r, "denied")
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Missing code", http.StatusBadRequest)
+		return
+	}
+
+	token, err := o.exchange(code)
+	if err != nil {
+		fmt.Println("Error exchanging OAuth code: ", err)
+		o.redirectBack(w, r, "error")
+		return
+	}
+	_, err = o.Credentials.Link(oauthState.UserAccountId, BrokerageSecrets{OAuthToken: token.AccessToken}, oauthState.Paper)
+	if errors.Is(err, ErrBrokerageAccountTaken) {
+		o.redirectBack(w, r, "taken")
+		return
+	}
+	if errors.Is(err, ErrInsufficientShares) {
+		o.redirectBack(w, r, "locked")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error linking brokerage account: ", err)
+		o.redirectBack(w, r, "error")
+		return
+	}
+	o.redirectBack(w, r, "connected")
+}
+
+// Status reports the user's linked account, checking its credentials against Alpaca.
+func (o *AlpacaOAuth) Status(userAccountId string) (BrokerageStatus, error) {
+	credentials, err := o.Credentials.Get(userAccountId)
+	if errors.Is(err, ErrBrokerageNotLinked) {
+		return BrokerageStatus{}, nil
+	}
+	if err != nil {
+		return BrokerageStatus{}, err
+	}
+	status := BrokerageStatus{
+		Linked:        true,
+		Provider:      credentials.Provider,
+		Method:        credentials.Method,
+		AccountNumber: credentials.AccountNumber,
+		Paper:         credentials.Paper,
+		LinkedAt:      credentials.LinkedAt,
+	}
+	brokerage, err := o.Credentials.open(credentials)
+	if err != nil {
+		return status, err
+	}
+	account, err := brokerage.Account()
+	var apiErr *alpaca.APIError
+	if errors.As(err, &apiErr) {
+		status.Error = apiErr.Message
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	status.Valid = true
+	status.AccountStatus = account.Status
+	return status, nil
+}
+
+// HandleStatus reports the signed-in user's brokerage account.
+func (o *AlpacaOAuth) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	userAccountId, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		http.Error(w, "Sign in first", http.StatusUnauthorized)
+		return
+	}
+	status, err := o.Status(userAccountId)
+	if err != nil {
+		fmt.Println("Error getting brokerage status: ", err)
+		http.Error(w, "Failed to get brokerage status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]BrokerageStatus{
+		"brokerage": status,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode brokerage status", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/divin3circle/hashrexa/backend/internal/scripts"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+// newStubOAuth points an AlpacaOAuth at the Alpaca OAuth stub.
+func newStubOAuth(t *testing.T, auth *Authenticator) (*AlpacaOAuth, *httptest.Server) {
+	t.Helper()
+	handler, err := scripts.NewAlpacaOAuthStub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := httptest.NewServer(handler)
+	t.Cleanup(stub.Close)
+	t.Setenv("ALPACA_BASE_URL", stub.URL)
+	t.Setenv("ALPACA_OAUTH_REVOKE_URL", stub.URL+"/oauth/revoke")
+	t.Setenv("BROKERAGE_ENCRYPTION_KEY", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	db := newTestDB(t)
+	o := NewAlpacaOAuth(db, NewBrokerageCredentialStore(db, nil), auth)
+	o.ClientId = "stub-client"
+	o.ClientSecret = "stub-secret"
+	o.AuthorizeURL = stub.URL + "/oauth/authorize"
+	o.TokenURL = stub.URL + "/oauth/token"
+	o.RedirectURI = "http://localhost:8080/brokerage/alpaca/callback"
+	o.ReturnURL = "http://localhost:5173"
+	return o, stub
+}
+
+func oauthRouter(o *AlpacaOAuth) http.Handler {
+	r := chi.NewRouter()
+	r.With(o.Auth.RequireUser).Get("/brokerage/alpaca/connect", o.HandleConnect)
+	r.Get("/brokerage/alpaca/callback", o.HandleCallback)
+	return r
+}
+
+// serve makes a request with the session token as a cookie and returns the redirect.
+func serve(t *testing.T, handler http.Handler, target, token string) *url.URL {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("%s: status = %d, want %d: %s", target, rec.Code, http.StatusFound, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// authorize follows the connect redirect through the stub's consent page and returns the
+// callback it redirects to.
+func authorize(t *testing.T, consent *url.URL) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(consent.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Path + "?" + callback.RawQuery
+}
+
+func TestAlpacaOAuthConnect(t *testing.T) {
+	userKey, _ := hiero.PrivateKeyGenerateEd25519()
+	otherKey, _ := hiero.PrivateKeyGenerateEd25519()
+	auth := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": userKey, "0.0.1002": otherKey})
+
+	tests := []struct {
+		name          string
+		callbackToken func(userToken string) string
+		want          string
+	}{
+		{name: "same session", callbackToken: func(userToken string) string { return userToken }, want: "connected"},
+		{name: "no session", callbackToken: func(string) string { return "" }, want: "unauthorized"},
+		{name: "other user", callbackToken: func(string) string { return signIn(t, auth, "0.0.1002", otherKey) }, want: "unauthorized"},
+		{name: "other session", callbackToken: func(string) string { return signIn(t, auth, "0.0.1001", userKey) }, want: "unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := newStubOAuth(t, auth)
+			router := oauthRouter(o)
+			userToken := signIn(t, auth, "0.0.1001", userKey)
+
+			consent := serve(t, router, "/brokerage/alpaca/connect", userToken)
+			callback := authorize(t, consent)
+			outcome := serve(t, router, callback, tt.callbackToken(userToken)).Query().Get("brokerage")
+			if outcome != tt.want {
+				t.Fatalf("outcome = %q, want %q", outcome, tt.want)
+			}
+
+			credentials, err := o.Credentials.Get("0.0.1001")
+			linked := err == nil
+			if linked != (tt.want == "connected") {
+				t.Fatalf("linked = %t, error %v", linked, err)
+			}
+			if linked && credentials.AccountNumber != "PASTUB0001" {
+				t.Fatalf("account number = %q", credentials.AccountNumber)
+			}
+		})
+	}
+}
+
+func TestAlpacaOAuthConnectNeedsSession(t *testing.T) {
+	o, _ := newStubOAuth(t, newTestAuthenticator(t, nil))
+	req := httptest.NewRequest(http.MethodGet, "/brokerage/alpaca/connect", nil)
+	rec := httptest.NewRecorder()
+	oauthRouter(o).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUnlinkRevokesOAuthToken(t *testing.T) {
+	userKey, _ := hiero.PrivateKeyGenerateEd25519()
+	auth := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": userKey})
+	o, _ := newStubOAuth(t, auth)
+	router := oauthRouter(o)
+	userToken := signIn(t, auth, "0.0.1001", userKey)
+	callback := authorize(t, serve(t, router, "/brokerage/alpaca/connect", userToken))
+	serve(t, router, callback, userToken)
+
+	credentials, err := o.Credentials.Get("0.0.1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokerage, err := o.Credentials.open(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Credentials.Unlink("0.0.1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stub forgets revoked tokens, so the account no longer answers to this one
+	_, err = brokerage.Account()
+	if err == nil {
+		t.Fatal("account still reachable with the revoked token")
+	}
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const kycPrefix = "kyc:"
+
+const (
+	KycNone     = "none"
+	KycApproved = "approved"
+	KycRejected = "rejected"
+)
+
+// errAwaitingOnboarding means tokens cannot be transferred to a user yet because their
+// account is not associated with the token, lacks KYC, or is frozen. The tokens stay in the
+// treasury until it is resolved.
+var errAwaitingOnboarding = errors.New("awaiting token association or KYC")
+
+// KycRecord is the outcome of a user's KYC review. Approval lets the backend grant KYC on
+// every token that requires it.
+type KycRecord struct {
+	UserAccountId string `json:"userAccountId"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason,omitempty"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+type UpdateKycRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// TokenOnboarding is whether a user can receive an asset's token. EscrowedUnits are minted
+// for the user and held in the treasury until Ready.
+type TokenOnboarding struct {
+	Symbol        string `json:"symbol"`
+	TokenId       string `json:"tokenId"`
+	Associated    bool   `json:"associated"`
+	KycRequired   bool   `json:"kycRequired"`
+	KycGranted    bool   `json:"kycGranted"`
+	Frozen        bool   `json:"frozen"`
+	Ready         bool   `json:"ready"`
+	EscrowedUnits int64  `json:"escrowedUnits"`
+}
+
+// Onboarding lists what a user still has to do before receiving tokens. AssociateTransaction
+// is a frozen, unsigned TokenAssociateTransaction for the tokens they are not associated
+// with, base64 encoded for the wallet to sign and submit.
+type Onboarding struct {
+	UserAccountId        string            `json:"userAccountId"`
+	Kyc                  string            `json:"kyc"`
+	Tokens               []TokenOnboarding `json:"tokens"`
+	AssociateTransaction string            `json:"associateTransaction,omitempty"`
+	Ready                bool              `json:"ready"`
+}
+
+func (u *UserHandler) getKyc(userAccountId string) (KycRecord, error) {
+	record := KycRecord{UserAccountId: userAccountId, Status: KycNone}
+	err := u.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(kycPrefix + userAccountId))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return record, nil
+	}
+	return record, err
+}
+
+func (u *UserHandler) putKyc(record KycRecord) error {
+	record.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return u.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(kycPrefix+record.UserAccountId), marshaledRecord)
+	})
+}
+
+// tokenOnboarding reads the user's relationship with an asset's token from the mirror node.
+// A token that revoked the user's KYC requires it even when the registry says otherwise.
+func tokenOnboarding(userAccountId string, asset AssetRecord) (TokenOnboarding, error) {
+	onboarding := TokenOnboarding{Symbol: asset.Symbol, TokenId: asset.TokenId}
+	relationship, associated, err := tokenRelationship(userAccountId, asset.TokenId)
+	if err != nil {
+		return onboarding, err
+	}
+	onboarding.Associated = associated
+	onboarding.KycRequired = asset.KycRequired || relationship.KycStatus == "REVOKED"
+	onboarding.KycGranted = relationship.KycStatus == "GRANTED"
+	onboarding.Frozen = relationship.FreezeStatus == "FROZEN"
+	onboarding.Ready = associated && !onboarding.Frozen && (!onboarding.KycRequired || onboarding.KycGranted)
+	return onboarding, nil
+}
+
+// readyForTransfer checks that a user can receive an asset's token, granting KYC on the
+// token when the user passed KYC and the token requires it. A token that freezes new
+// associations by default is unfrozen for the user, unless the share lock monitor froze it.
+func (u *UserHandler) readyForTransfer(userAccountId string, asset AssetRecord) error {
+	onboarding, err := tokenOnboarding(userAccountId, asset)
+	if err != nil {
+		return err
+	}
+	switch {
+	case onboarding.Ready:
+		return nil
+	case !onboarding.Associated:
+		return fmt.Errorf("%w: %s is not associated with %s", errAwaitingOnboarding, userAccountId, asset.TokenId)
+	case onboarding.Frozen:
+		var lock ShareLock
+		err := u.DB.View(func(txn *badger.Txn) error {
+			var err error
+			lock, err = getShareLock(txn, userAccountId, asset)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !asset.FreezeDefault || lock.Status == ShareLockFrozen {
+			return fmt.Errorf("%w: %s is frozen for %s", errAwaitingOnboarding, userAccountId, asset.TokenId)
+		}
+		err = u.unfreeze(userAccountId, asset.TokenId)
+		if err != nil {
+			return err
+		}
+		if !onboarding.KycRequired || onboarding.KycGranted {
+			return nil
+		}
+	}
+	kyc, err := u.getKyc(userAccountId)
+	if err != nil {
+		return err
+	}
+	if kyc.Status != KycApproved {
+		return fmt.Errorf("%w: KYC of %s is %s", errAwaitingOnboarding, userAccountId, kyc.Status)
+	}
+	_, err = u.GrantKyc(userAccountId, asset.TokenId)
+	return err
+}
+
+// associateTransaction builds a TokenAssociateTransaction for the user to pay for and sign.
+func (u *UserHandler) associateTransaction(userAccountId string, tokenIds []string) (string, error) {
+	accountId, err := hiero.AccountIDFromString(userAccountId)
+	if err != nil {
+		return "", err
+	}
+	ids := []hiero.TokenID{}
+	for _, tokenId := range tokenIds {
+		id, err := hiero.TokenIDFromString(tokenId)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	transaction, err := hiero.NewTokenAssociateTransaction().
+		SetTransactionID(hiero.TransactionIDGenerate(accountId)).
+		SetAccountID(accountId).
+		SetTokenIDs(ids...).
+		FreezeWith(u.Client)
+	if err != nil {
+		return "", err
+	}
+	transactionBytes, err := transaction.ToBytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(transactionBytes), nil
+}
+
+func (u *UserHandler) getOnboarding(userAccountId string) (Onboarding, error) {
+	kyc, err := u.getKyc(userAccountId)
+	if err != nil {
+		return Onboarding{}, err
+	}
+	assets, err := u.Assets.List()
+	if err != nil {
+		return Onboarding{}, err
+	}
+	escrowed, err := u.Saga.List(WorkflowEscrowed)
+	if err != nil {
+		return Onboarding{}, err
+	}
+	onboarding := Onboarding{UserAccountId: userAccountId, Kyc: kyc.Status, Tokens: []TokenOnboarding{}, Ready: true}
+	unassociated := []string{}
+	for _, asset := range assets {
+		if !asset.Enabled || asset.TokenId == "" {
+			continue
+		}
+		token, err := tokenOnboarding(userAccountId, asset)
+		if err != nil {
+			return Onboarding{}, err
+		}
+		for _, wf := range escrowed {
+			if wf.UserAccountId == userAccountId && wf.Symbol == asset.Symbol {
+				token.EscrowedUnits += wf.Units
+			}
+		}
+		if !token.Associated {
+			unassociated = append(unassociated, asset.TokenId)
+		}
+		onboarding.Ready = onboarding.Ready && token.Ready
+		onboarding.Tokens = append(onboarding.Tokens, token)
+	}
+	if len(unassociated) > 0 {
+		onboarding.AssociateTransaction, err = u.associateTransaction(userAccountId, unassociated)
+		if err != nil {
+			return Onboarding{}, err
+		}
+	}
+	return onboarding, nil
+}
+
+// HandleGetOnboarding reports whether the user can receive each tokenized asset, with the
+// association transaction to sign for those they cannot.
+func (u *UserHandler) HandleGetOnboarding(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	onboarding, err := u.getOnboarding(userAccountId)
+	if err != nil {
+		fmt.Println("Error getting onboarding: ", err)
+		http.Error(w, "Failed to get onboarding status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]Onboarding{
+		"onboarding": onboarding,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode onboarding status", http.StatusInternalServerError)
+		return
+	}
+}
+
+// revokeKyc revokes the user's KYC on a token.
+func (u *UserHandler) revokeKyc(userAccountId, assetTokenId string) error {
+	tokenId, err := hiero.TokenIDFromString(assetTokenId)
+	if err != nil {
+		return err
+	}
+	accountId, err := hiero.AccountIDFromString(userAccountId)
+	if err != nil {
+		return err
+	}
+	kycKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTokenRevokeKycTransaction().
+		SetTokenID(tokenId).
+		SetAccountID(accountId).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(kycKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	receipt, err := txResponse.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The revoke KYC transaction consensus status is %v\n", receipt.Status)
+	return nil
+}
+
+// HandleUpdateKyc records the outcome of a user's KYC review. Approval grants KYC on the
+// tokens the user is associated with and releases their escrowed tokens; rejection revokes
+// the KYC granted and compensates the escrowed workflows.
+func (u *UserHandler) HandleUpdateKyc(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if _, err := hiero.AccountIDFromString(userAccountId); err != nil {
+		http.Error(w, "Invalid user account ID", http.StatusBadRequest)
+		return
+	}
+	var request UpdateKycRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToLower(request.Status)
+	if status != KycApproved && status != KycRejected {
+		http.Error(w, "Status must be approved or rejected", http.StatusBadRequest)
+		return
+	}
+	err = u.putKyc(KycRecord{UserAccountId: userAccountId, Status: status, Reason: request.Reason})
+	if err != nil {
+		fmt.Println("Error storing KYC: ", err)
+		http.Error(w, "Failed to update KYC", http.StatusInternalServerError)
+		return
+	}
+
+	if status == KycApproved {
+		assets, err := u.Assets.List()
+		if err != nil {
+			fmt.Println("Error listing assets: ", err)
+		}
+		for _, asset := range assets {
+			if !asset.Enabled || asset.TokenId == "" {
+				continue
+			}
+			err := u.readyForTransfer(userAccountId, asset)
+			if err != nil && !errors.Is(err, errAwaitingOnboarding) {
+				fmt.Println("Error granting KYC on ", asset.TokenId, ": ", err)
+			}
+		}
+		err = u.Saga.Release(userAccountId)
+		if err != nil {
+			fmt.Println("Error releasing escrow: ", err)
+		}
+	}
+
+	if status == KycRejected {
+		assets, err := u.Assets.List()
+		if err != nil {
+			fmt.Println("Error listing assets: ", err)
+		}
+		for _, asset := range assets {
+			if asset.TokenId == "" {
+				continue
+			}
+			token, err := tokenOnboarding(userAccountId, asset)
+			if err != nil {
+				fmt.Println("Error getting KYC on ", asset.TokenId, ": ", err)
+				continue
+			}
+			if !token.KycGranted {
+				continue
+			}
+			err = u.revokeKyc(userAccountId, asset.TokenId)
+			if err != nil {
+				fmt.Println("Error revoking KYC on ", asset.TokenId, ": ", err)
+			}
+		}
+		err = u.Saga.Cancel(userAccountId)
+		if err != nil {
+			fmt.Println("Error cancelling escrow: ", err)
+		}
+	}
+
+	onboarding, err := u.getOnboarding(userAccountId)
+	if err != nil {
+		fmt.Println("Error getting onboarding: ", err)
+		http.Error(w, "Failed to get onboarding status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]Onboarding{
+		"onboarding": onboarding,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode onboarding status", http.StatusInternalServerError)
+		return
+	}
+}
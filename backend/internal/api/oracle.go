@@ -0,0 +1,407 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const oraclePricePrefix = "oracle:"
+
+// settableOracleABI is the interface of mock oracles whose price is set by a transaction,
+// such as OracleMock in test deployments. The markets' oracles read Chainlink feeds and have
+// no setPrice, so prices are pushed on-chain only when ORACLE_ONCHAIN is true.
+const settableOracleABI = `[{"inputs":[{"internalType":"uint256","name":"newPrice","type":"uint256"}],"name":"setPrice","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+
+var (
+	defaultOracleInterval             = time.Minute
+	defaultOracleHeartbeat            = time.Hour
+	defaultOracleMaxStaleness         = 15 * time.Minute
+	defaultOracleDeviationBps         = uint64(50)
+	defaultOracleMaxQuoteDeviationBps = uint64(200)
+	oracleSetPriceGas                 = uint64(100_000)
+)
+
+// OraclePrice is one published price. Signature is the operator's ed25519 signature over the
+// record's JSON with Signature and TopicSequence empty: the sequence number is only known once
+// the signed record is on the topic, so verifiers clear both before checking it.
+type OraclePrice struct {
+	Symbol         string            `json:"symbol"`
+	Price          float64           `json:"price"`
+	QuotePrice     float64           `json:"quotePrice"`
+	Bid            float64           `json:"bid"`
+	Ask            float64           `json:"ask"`
+	TradeAt        int64             `json:"tradeAt"`
+	Reason         string            `json:"reason"`
+	OnChainPrices  map[string]string `json:"onChainPrices,omitempty"`
+	TransactionIds []string          `json:"transactionIds,omitempty"`
+	TopicSequence  uint64            `json:"topicSequence,omitempty"`
+	PublishedAt    int64             `json:"publishedAt"`
+	PublicKey      string            `json:"publicKey"`
+	Signature      string            `json:"signature,omitempty"`
+}
+
+// OracleObservation is the last price the publisher read for a symbol, published or not.
+type OracleObservation struct {
+	Price      float64 `json:"price"`
+	TradeAt    int64   `json:"tradeAt"`
+	ObservedAt int64   `json:"observedAt"`
+	Stale      bool    `json:"stale"`
+	Rejected   string  `json:"rejected,omitempty"`
+}
+
+// OraclePublisher publishes Alpaca prices of the tokenized stocks to an HCS price topic when
+// one is configured and, with OnChain, pushes them to settable oracles of the markets that
+// use them as collateral. A price is published when it moves more than DeviationBps from the
+// last published one, or every Heartbeat otherwise.
+type OraclePublisher struct {
+	DB                   *badger.DB
+	MarketData           *marketdata.Client
+	Markets              *MarketRegistry
+	Session              *MarketSessionTracker
+	Assets               *AssetRegistry
+	TopicId              string
+	OnChain              bool
+	QuotePrice           float64
+	Interval             time.Duration
+	Heartbeat            time.Duration
+	MaxStaleness         time.Duration
+	DeviationBps         uint64
+	MaxQuoteDeviationBps uint64
+
+	mu       sync.Mutex
+	last     map[string]OraclePrice
+	observed map[string]OracleObservation
+}
+
+func NewOraclePublisher(db *badger.DB, marketData *marketdata.Client, markets *MarketRegistry, assets *AssetRegistry, session *MarketSessionTracker) *OraclePublisher {
+	o := &OraclePublisher{
+		DB:                   db,
+		MarketData:           marketData,
+		Markets:              markets,
+		Session:              session,
+		Assets:               assets,
+		TopicId:              os.Getenv("ORACLE_TOPIC_ID"),
+		OnChain:              os.Getenv("ORACLE_ONCHAIN") == "true",
+		QuotePrice:           oracleQuotePrice(),
+		Interval:             defaultOracleInterval,
+		Heartbeat:            defaultOracleHeartbeat,
+		MaxStaleness:         defaultOracleMaxStaleness,
+		DeviationBps:         envUint64("ORACLE_DEVIATION_BPS", defaultOracleDeviationBps),
+		MaxQuoteDeviationBps: envUint64("ORACLE_MAX_QUOTE_DEVIATION_BPS", defaultOracleMaxQuoteDeviationBps),
+		last:                 map[string]OraclePrice{},
+		observed:             map[string]OracleObservation{},
+	}
+	if interval, err := time.ParseDuration(os.Getenv("ORACLE_INTERVAL")); err == nil {
+		o.Interval = interval
+	}
+	if heartbeat, err := time.ParseDuration(os.Getenv("ORACLE_HEARTBEAT")); err == nil {
+		o.Heartbeat = heartbeat
+	}
+	if staleness, err := time.ParseDuration(os.Getenv("ORACLE_MAX_STALENESS")); err == nil {
+		o.MaxStaleness = staleness
+	}
+	return o
+}
+
+// oracleQuotePrice is the USD price of the loan token prices are quoted in, 1 unless
+// ORACLE_QUOTE_USD_PRICE says otherwise.
+func oracleQuotePrice() float64 {
+	if quotePrice, err := strconv.ParseFloat(os.Getenv("ORACLE_QUOTE_USD_PRICE"), 64); err == nil && quotePrice > 0 {
+		return quotePrice
+	}
+	return 1
+}
+
+// latestOraclePrice is the last price published for a symbol, and false if none has been.
+func latestOraclePrice(db *badger.DB, symbol string) (OraclePrice, bool, error) {
+	prices, err := oracleHistory(db, symbol, 1)
+	if err != nil || len(prices) == 0 {
+		return OraclePrice{}, false, err
+	}
+	return prices[0], true, nil
+}
+
+// tokenizedSymbol is the HTS symbol a stock is tokenized under.
+func tokenizedSymbol(symbol string) string {
+	return "d" + symbol
+}
+
+func oraclePriceKey(symbol string, publishedAt int64) string {
+	return fmt.Sprintf("%s%s:%020d", oraclePricePrefix, symbol, publishedAt)
+}
+
+// Run publishes the prices of the registry's enabled assets, re-reading them every Interval.
+func (o *OraclePublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	for {
+		symbols, err := tokenizedSymbols(o.Assets)
+		if err != nil {
+			fmt.Println("Error listing oracle symbols: ", err)
+		}
+		for _, symbol := range symbols {
+			err := o.tick(symbol)
+			if err != nil {
+				fmt.Println("Error publishing oracle price for ", symbol, ": ", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func deviationBps(price, reference float64) float64 {
+	if reference == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(price-reference) / reference * 10_000
+}
+
+// observe reads the latest trade and quote and rejects prices that are stale, that come from
+// a closed or halted market, or that disagree with the quote midpoint by more than
+// MaxQuoteDeviationBps.
+func (o *OraclePublisher) observe(symbol string) (marketdata.Trade, marketdata.Quote, error) {
+	trade, err := o.MarketData.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{Feed: marketdata.IEX})
+	if err != nil {
+		return marketdata.Trade{}, marketdata.Quote{}, err
+	}
+	quote, err := o.MarketData.GetLatestQuote(symbol, marketdata.GetLatestQuoteRequest{Feed: marketdata.IEX})
+	if err != nil {
+		return marketdata.Trade{}, marketdata.Quote{}, err
+	}
+
+	observation := OracleObservation{Price: trade.Price, TradeAt: trade.Timestamp.Unix(), ObservedAt: time.Now().Unix()}
+	switch {
+	case trade.Price <= 0:
+		err = errors.New("no trade price")
+	case !o.Session.Trading(symbol):
+		observation.Stale = true
+		err = fmt.Errorf("market is %s", o.Session.SymbolState(symbol))
+	case time.Since(trade.Timestamp) > o.MaxStaleness:
+		observation.Stale = true
+		err = fmt.Errorf("latest trade is %s old", time.Since(trade.Timestamp).Round(time.Second))
+	case quote.BidPrice > 0 && quote.AskPrice > 0:
+		mid := (quote.BidPrice + quote.AskPrice) / 2
+		if deviation := deviationBps(trade.Price, mid); deviation > float64(o.MaxQuoteDeviationBps) {
+			err = fmt.Errorf("trade deviates %.0f bps from quote midpoint", deviation)
+		}
+	}
+	if err != nil {
+		observation.Rejected = err.Error()
+	}
+	o.mu.Lock()
+	o.observed[symbol] = observation
+	o.mu.Unlock()
+	return *trade, *quote, err
+}
+
+func (o *OraclePublisher) tick(symbol string) error {
+	trade, quote, err := o.observe(symbol)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	last, published := o.last[symbol]
+	o.mu.Unlock()
+	if !published {
+		// the last price published before a restart, or before the asset was enabled
+		last, published, err = latestOraclePrice(o.DB, symbol)
+		if err != nil {
+			return err
+		}
+	}
+
+	reason := ""
+	switch {
+	case !published:
+		reason = "initial"
+	case deviationBps(trade.Price, last.Price) >= float64(o.DeviationBps):
+		reason = "deviation"
+	case time.Since(time.Unix(last.PublishedAt, 0)) >= o.Heartbeat:
+		reason = "heartbeat"
+	default:
+		return nil
+	}
+	return o.publish(OraclePrice{
+		Symbol:     symbol,
+		Price:      trade.Price,
+		QuotePrice: o.QuotePrice,
+		Bid:        quote.BidPrice,
+		Ask:        quote.AskPrice,
+		TradeAt:    trade.Timestamp.Unix(),
+		Reason:     reason,
+	})
+}
+
+// morphoOraclePrice scales a USD price into what a Morpho oracle returns: loan token units
+// per collateral token unit, times 1e36.
+func morphoOraclePrice(price, quotePrice float64, collateralDecimals, loanDecimals int) *big.Int {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(36+loanDecimals-collateralDecimals)), nil)
+	scaled := new(big.Float).SetPrec(256).SetFloat64(price / quotePrice)
+	scaled.Mul(scaled, new(big.Float).SetPrec(256).SetInt(scale))
+	result, _ := scaled.Int(nil)
+	return result
+}
+
+func (o *OraclePublisher) publish(price OraclePrice) error {
+	privateKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	price.PublishedAt = time.Now().Unix()
+	price.PublicKey = privateKey.PublicKey().StringRaw()
+
+	if o.OnChain {
+		oracleContractABI, err := abi.JSON(strings.NewReader(settableOracleABI))
+		if err != nil {
+			return err
+		}
+		markets, err := o.Markets.List()
+		if err != nil {
+			return err
+		}
+		price.OnChainPrices = map[string]string{}
+		for _, market := range markets {
+			if market.CollateralSymbol != tokenizedSymbol(price.Symbol) {
+				continue
+			}
+			onChainPrice := morphoOraclePrice(price.Price, price.QuotePrice, market.CollateralDecimals, market.LoanDecimals)
+			oracleId, err := evmContractId(market.Params.Oracle)
+			if err != nil {
+				return err
+			}
+			txId, err := executeABI(oracleContractABI, oracleId, "setPrice", oracleSetPriceGas, onChainPrice)
+			if err != nil {
+				// the price is not published, so the next tick pushes it again
+				return fmt.Errorf("pushing price to oracle of %s: %w", market.MarketId, err)
+			}
+			price.OnChainPrices[market.MarketId] = onChainPrice.String()
+			price.TransactionIds = append(price.TransactionIds, txId)
+		}
+	}
+
+	unsigned, err := json.Marshal(price)
+	if err != nil {
+		return err
+	}
+	price.Signature = hex.EncodeToString(privateKey.Sign(unsigned))
+
+	if o.TopicId != "" {
+		price.TopicSequence, err = publishSigned(o.TopicId, "Oracle price "+price.Symbol, price)
+		if err != nil {
+			return err
+		}
+	}
+
+	marshaledPrice, err := json.Marshal(price)
+	if err != nil {
+		return err
+	}
+	err = o.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(oraclePriceKey(price.Symbol, price.PublishedAt)), marshaledPrice)
+	})
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.last[price.Symbol] = price
+	o.mu.Unlock()
+	return nil
+}
+
+// History returns up to limit published prices for a symbol, newest first.
+func (o *OraclePublisher) History(symbol string, limit int) ([]OraclePrice, error) {
+	return oracleHistory(o.DB, symbol, limit)
+}
+
+func oracleHistory(db *badger.DB, symbol string, limit int) ([]OraclePrice, error) {
+	prices := []OraclePrice{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(oraclePricePrefix + symbol + ":")
+		for it.Seek(append(prefix, 0xff)); it.ValidForPrefix(prefix) && len(prices) < limit; it.Next() {
+			var price OraclePrice
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &price)
+			})
+			if err != nil {
+				return err
+			}
+			prices = append(prices, price)
+		}
+		return nil
+	})
+	return prices, err
+}
+
+func (o *OraclePublisher) HandleGetOraclePrice(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(chi.URLParam(r, "symbol"))
+	symbols, err := tokenizedSymbols(o.Assets)
+	if err != nil {
+		fmt.Println("Error listing oracle symbols: ", err)
+		http.Error(w, "Failed to get oracle prices", http.StatusInternalServerError)
+		return
+	}
+	known := false
+	for _, s := range symbols {
+		known = known || s == symbol
+	}
+	if !known {
+		http.Error(w, "Unknown oracle symbol", http.StatusNotFound)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	history, err := o.History(symbol, limit)
+	if err != nil {
+		http.Error(w, "Failed to get oracle prices", http.StatusInternalServerError)
+		return
+	}
+	o.mu.Lock()
+	observation, observed := o.observed[symbol]
+	o.mu.Unlock()
+
+	response := map[string]interface{}{
+		"symbol":  symbol,
+		"history": history,
+		"session": o.Session.SymbolState(symbol),
+	}
+	if len(history) > 0 {
+		response["latest"] = history[0]
+	}
+	if observed {
+		response["observation"] = observation
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode oracle prices", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const portfolioHistoryPrefix = "portfolio-history:"
+
+var (
+	defaultHistoryPeriod    = "30D"
+	defaultHistoryTimeframe = "1H"
+	historyPeriodPattern    = regexp.MustCompile(`^[1-9][0-9]{0,3}[DWMA]$`)
+	// historyCacheTTL is how long a response is served from cache, by timeframe: about as
+	// long as it takes the series to gain a point
+	historyCacheTTL = map[string]time.Duration{
+		"1Min":  time.Minute,
+		"5Min":  5 * time.Minute,
+		"15Min": 15 * time.Minute,
+		"1H":    time.Hour,
+		"1D":    6 * time.Hour,
+	}
+	// Alpaca reports intraday timeframes for at most 30 days
+	maxIntradayHistory = 30 * 24 * time.Hour
+)
+
+// PortfolioHistoryPoint is the account's equity at T, a unix time in seconds, and its profit
+// since the start of the series.
+type PortfolioHistoryPoint struct {
+	T      int64   `json:"t"`
+	Equity float64 `json:"equity"`
+	PnL    float64 `json:"pnl"`
+	PnLPct float64 `json:"pnl_pct"`
+}
+
+// periodDuration approximates a period such as 30D or 3M.
+func periodDuration(period string) time.Duration {
+	count, _ := strconv.Atoi(period[:len(period)-1])
+	day := 24 * time.Hour
+	switch period[len(period)-1] {
+	case 'W':
+		day *= 7
+	case 'M':
+		day *= 30
+	case 'A':
+		day *= 365
+	}
+	return time.Duration(count) * day
+}
+
+// parseHistoryTime accepts an RFC 3339 time or a date.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// parsePortfolioHistoryRequest reads period, timeframe, start, end and extended_hours. A
+// period and a start cannot both be given; with neither the period defaults to 30D.
+func parsePortfolioHistoryRequest(r *http.Request) (PortfolioHistoryRequest, error) {
+	query := r.URL.Query()
+	request := PortfolioHistoryRequest{
+		Period:    query.Get("period"),
+		Timeframe: query.Get("timeframe"),
+	}
+	if request.Timeframe == "" {
+		request.Timeframe = defaultHistoryTimeframe
+	}
+	if _, ok := historyCacheTTL[request.Timeframe]; !ok {
+		return request, errors.New("timeframe must be one of 1Min, 5Min, 15Min, 1H or 1D")
+	}
+	var err error
+	if start := query.Get("start"); start != "" {
+		request.Start, err = parseHistoryTime(start)
+		if err != nil {
+			return request, errors.New("start must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if end := query.Get("end"); end != "" {
+		request.End, err = parseHistoryTime(end)
+		if err != nil {
+			return request, errors.New("end must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		if request.End.After(time.Now()) {
+			return request, errors.New("end cannot be in the future")
+		}
+	}
+	if extendedHours := query.Get("extended_hours"); extendedHours != "" {
+		request.ExtendedHours, err = strconv.ParseBool(extendedHours)
+		if err != nil {
+			return request, errors.New("extended_hours must be true or false")
+		}
+	}
+
+	var span time.Duration
+	switch {
+	case request.Period != "" && !request.Start.IsZero():
+		return request, errors.New("give either period or start, not both")
+	case !request.Start.IsZero():
+		end := request.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		if !request.Start.Before(end) {
+			return request, errors.New("start must be before end")
+		}
+		span = end.Sub(request.Start)
+	default:
+		if request.Period == "" {
+			request.Period = defaultHistoryPeriod
+		}
+		if !historyPeriodPattern.MatchString(request.Period) {
+			return request, errors.New("period must be a number followed by D, W, M or A, such as 30D")
+		}
+		span = periodDuration(request.Period)
+	}
+	if request.Timeframe != "1D" && span > maxIntradayHistory {
+		return request, errors.New("intraday timeframes cover at most 30 days")
+	}
+	return request, nil
+}
+
+func portfolioHistoryKey(userAccountId string, request PortfolioHistoryRequest) string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return fmt.Sprintf("%s%s:%s:%s:%s:%s:%t", portfolioHistoryPrefix, userAccountId, request.Timeframe, request.Period, format(request.Start), format(request.End), request.ExtendedHours)
+}
+
+// portfolioHistory returns the user's history as points, from the cache while it is fresh.
+func (u *UserHandler) portfolioHistory(userAccountId string, request PortfolioHistoryRequest) ([]PortfolioHistoryPoint, error) {
+	key := portfolioHistoryKey(userAccountId, request)
+	var points []PortfolioHistoryPoint
+	cached, err := getCached(u.DB, key, &points)
+	if err != nil || cached {
+		return points, err
+	}
+
+	brokerage, err := u.brokerage(userAccountId)
+	if err != nil {
+		return nil, err
+	}
+	history, err := brokerage.PortfolioHistory(request)
+	if err != nil {
+		return nil, err
+	}
+	points = []PortfolioHistoryPoint{}
+	for j, timestamp := range history.Timestamps {
+		points = append(points, PortfolioHistoryPoint{
+			T:      timestamp,
+			Equity: history.Equity[j].InexactFloat64(),
+			PnL:    history.ProfitLoss[j].InexactFloat64(),
+			PnLPct: history.ProfitLossPct[j].InexactFloat64(),
+		})
+	}
+	setCached(u.DB, key, points, historyCacheTTL[request.Timeframe])
+	return points, nil
+}
+
+// HandlePortfolioHistory returns the equity of the user's brokerage account over time. See
+// parsePortfolioHistoryRequest for the query parameters.
+func (u *UserHandler) HandlePortfolioHistory(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	historyRequest, err := parsePortfolioHistoryRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := u.portfolioHistory(userAccountId, historyRequest)
+	if errors.Is(err, ErrBrokerageUnsupported) {
+		http.Error(w, "Your brokerage does not report portfolio history", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeBrokerageError(w, err, "get portfolio history")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]PortfolioHistoryPoint{
+		"history": history,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode portfolio history", http.StatusInternalServerError)
+		return
+	}
+}
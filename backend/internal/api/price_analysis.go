@@ -0,0 +1,290 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	MarketTopicId           = "0.0.6514924"
+	priceAnalysisPrefix     = "price-analysis:"
+	priceAnalysisCursorKey  = "price-analysis-cursor"
+	defaultAnalysisInterval = time.Hour
+	defaultAnalysisWindow   = 24 * time.Hour
+)
+
+// priceAnalysisMu serialises appends so two updates cannot both extend the same latest point.
+var priceAnalysisMu sync.Mutex
+
+type OHLC struct {
+	Open  float64 `json:"open"`
+	High  float64 `json:"high"`
+	Low   float64 `json:"low"`
+	Close float64 `json:"close"`
+}
+
+type PriceAnalysisBucket struct {
+	Start      int64 `json:"start"`
+	End        int64 `json:"end"`
+	Collateral OHLC  `json:"collateral"`
+	Hash       OHLC  `json:"hash"`
+	Points     int   `json:"points"`
+}
+
+// priceAnalysisKey orders points by timestamp. Points read from the cumulative documents
+// the topic used to carry have sequence 0, so re-reading a document is idempotent.
+func priceAnalysisKey(timestamp int64, sequence int64) string {
+	return fmt.Sprintf("%s%012d:%06d", priceAnalysisPrefix, timestamp, sequence)
+}
+
+func (u *UserHandler) putPricePoints(txn *badger.Txn, sequence int64, points ...MarketMessages) error {
+	for _, point := range points {
+		marshaledPoint, err := json.Marshal(point)
+		if err != nil {
+			return err
+		}
+		err = txn.Set([]byte(priceAnalysisKey(point.Timestamp, sequence)), marshaledPoint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncPriceAnalysis copies the market topic's messages since the last synced sequence
+// number into badger. Each message is one MarketMessages point; older messages that carry
+// the whole MarketTopic document contribute all of their points.
+func (u *UserHandler) SyncPriceAnalysis() error {
+	var cursor int64
+	err := u.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(priceAnalysisCursorKey))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			cursor, err = strconv.ParseInt(string(val), 10, 64)
+			return err
+		})
+	})
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/v1/topics/%s/messages?encoding=base64&order=asc&limit=100&sequencenumber=gt:%d", MarketTopicId, cursor)
+	for path != "" {
+		var page TopicMessagesMNAPIResponse
+		err := mirrorGet(path, &page)
+		if err != nil {
+			return err
+		}
+		err = u.DB.Update(func(txn *badger.Txn) error {
+			for _, message := range page.Messages {
+				cursor = message.SequenceNumber
+				decoded, err := base64.StdEncoding.DecodeString(message.Message)
+				if err != nil {
+					fmt.Println("Error decoding market topic message ", message.SequenceNumber, ": ", err)
+					continue
+				}
+				var document MarketTopic
+				if json.Unmarshal(decoded, &document) == nil && len(document.Messages) > 0 {
+					err = u.putPricePoints(txn, 0, document.Messages...)
+				} else {
+					var point MarketMessages
+					if json.Unmarshal(decoded, &point) != nil || point.Timestamp == 0 {
+						fmt.Println("Skipping malformed market topic message ", message.SequenceNumber)
+						continue
+					}
+					err = u.putPricePoints(txn, message.SequenceNumber, point)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return txn.Set([]byte(priceAnalysisCursorKey), []byte(strconv.FormatInt(cursor, 10)))
+		})
+		if err != nil {
+			return err
+		}
+		path = page.Links.Next
+	}
+	return nil
+}
+
+// PricePoints returns the stored points with from <= timestamp < to, oldest first.
+func (u *UserHandler) PricePoints(from, to int64) ([]MarketMessages, error) {
+	points := []MarketMessages{}
+	err := u.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		end := []byte(priceAnalysisKey(to, 0))
+		for it.Seek([]byte(priceAnalysisKey(from, 0))); it.ValidForPrefix([]byte(priceAnalysisPrefix)); it.Next() {
+			if string(it.Item().Key()) >= string(end) {
+				break
+			}
+			var point MarketMessages
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &point)
+			})
+			if err != nil {
+				return err
+			}
+			points = append(points, point)
+		}
+		return nil
+	})
+	return points, err
+}
+
+// latestPricePoint is the newest stored point, or the zero point when nothing is stored.
+func (u *UserHandler) latestPricePoint() (MarketMessages, error) {
+	var point MarketMessages
+	err := u.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(priceAnalysisPrefix)
+		it.Seek(append(prefix, 0xff))
+		if !it.ValidForPrefix(prefix) {
+			return nil
+		}
+		return it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &point)
+		})
+	})
+	return point, err
+}
+
+// UpdatePriceAnalysis appends one point to the market topic: the latest collateral and HASH
+// levels moved by the amounts just transacted.
+func (u *UserHandler) UpdatePriceAnalysis(collateralTransacted, hashTransacted float64) (MarketMessages, error) {
+	return u.appendPricePoint(collateralTransacted, hashTransacted, time.Now().Unix())
+}
+
+func (u *UserHandler) appendPricePoint(collateralTransacted, hashTransacted float64, timestamp int64) (MarketMessages, error) {
+	priceAnalysisMu.Lock()
+	defer priceAnalysisMu.Unlock()
+
+	err := u.SyncPriceAnalysis()
+	if err != nil {
+		return MarketMessages{}, err
+	}
+	latest, err := u.latestPricePoint()
+	if err != nil {
+		return MarketMessages{}, err
+	}
+	point := MarketMessages{
+		Collateral: latest.Collateral + collateralTransacted,
+		Hash:       latest.Hash + hashTransacted,
+		Timestamp:  timestamp,
+	}
+	marshaledPoint, err := json.Marshal(point)
+	if err != nil {
+		return MarketMessages{}, err
+	}
+	sequence, _, err := submitTopicMessage(MarketTopicId, "Market price analysis updated", marshaledPoint)
+	if err != nil {
+		return MarketMessages{}, err
+	}
+	err = u.DB.Update(func(txn *badger.Txn) error {
+		return u.putPricePoints(txn, int64(sequence), point)
+	})
+	return point, err
+}
+
+// bucketPricePoints aggregates points into OHLC buckets aligned to interval. Empty buckets
+// are left out.
+func bucketPricePoints(points []MarketMessages, interval time.Duration) []PriceAnalysisBucket {
+	buckets := []PriceAnalysisBucket{}
+	width := int64(interval / time.Second)
+	for _, point := range points {
+		start := point.Timestamp - point.Timestamp%width
+		n := len(buckets)
+		if n == 0 || buckets[n-1].Start != start {
+			buckets = append(buckets, PriceAnalysisBucket{
+				Start:      start,
+				End:        start + width,
+				Collateral: OHLC{Open: point.Collateral, High: point.Collateral, Low: point.Collateral, Close: point.Collateral},
+				Hash:       OHLC{Open: point.Hash, High: point.Hash, Low: point.Hash, Close: point.Hash},
+			})
+			n++
+		}
+		bucket := &buckets[n-1]
+		bucket.Points++
+		for _, series := range []struct {
+			ohlc  *OHLC
+			value float64
+		}{{&bucket.Collateral, point.Collateral}, {&bucket.Hash, point.Hash}} {
+			series.ohlc.High = max(series.ohlc.High, series.value)
+			series.ohlc.Low = min(series.ohlc.Low, series.value)
+			series.ohlc.Close = series.value
+		}
+	}
+	return buckets
+}
+
+// parseTimeParam accepts unix seconds or RFC3339.
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (u *UserHandler) HandleGetMarketPriceAnalysis(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to, err := parseTimeParam(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, "Invalid to", http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(query.Get("from"), to.Add(-defaultAnalysisWindow))
+	if err != nil || !from.Before(to) {
+		http.Error(w, "Invalid from", http.StatusBadRequest)
+		return
+	}
+	interval := defaultAnalysisInterval
+	if value := query.Get("interval"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval < time.Second {
+			http.Error(w, "Invalid interval", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = u.SyncPriceAnalysis()
+	if err != nil {
+		fmt.Println("Error syncing price analysis: ", err)
+	}
+	points, err := u.PricePoints(from.Unix(), to.Unix())
+	if err != nil {
+		http.Error(w, "Failed to get price analysis", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":        from.Unix(),
+		"to":          to.Unix(),
+		"interval":    interval.String(),
+		"buckets":     bucketPricePoints(points, interval),
+		"marketTopic": MarketTopic{Messages: points},
+		"session":     u.Session.State(),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode price analysis", http.StatusInternalServerError)
+		return
+	}
+}
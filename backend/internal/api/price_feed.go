@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const priceFeedCursorKey = "price-analysis-event-cursor"
+
+// PriceAnalysisFeed keeps the market topic's collateral and HASH levels in step with the
+// lending pool: every indexed transaction that moves collateral or debt on a registered
+// market appends one point, timestamped with the transaction's consensus time.
+type PriceAnalysisFeed struct {
+	Users   *UserHandler
+	Indexer *EventIndexer
+	Markets *MarketRegistry
+}
+
+func NewPriceAnalysisFeed(users *UserHandler, indexer *EventIndexer, markets *MarketRegistry) *PriceAnalysisFeed {
+	return &PriceAnalysisFeed{Users: users, Indexer: indexer, Markets: markets}
+}
+
+type priceDelta struct {
+	key        string
+	timestamp  int64
+	collateral float64
+	hash       float64
+}
+
+func tokenUnits(amount *big.Int, decimals int) float64 {
+	if amount == nil {
+		return 0
+	}
+	units, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))).Float64()
+	return units
+}
+
+// deltas folds the registered markets' events after cursor into one delta per transaction,
+// in chain order. Collateral is what borrowers have posted, HASH what they owe.
+func (f *PriceAnalysisFeed) deltas(cursor string) ([]priceDelta, error) {
+	markets, err := f.Markets.List()
+	if err != nil {
+		return nil, err
+	}
+	byId := map[string]MarketRecord{}
+	var events []ContractEvent
+	for _, market := range markets {
+		byId[strings.ToLower(market.MarketId)] = market
+		marketEvents, err := f.Indexer.MarketEventsAfter(market.MarketId, cursor)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, marketEvents...)
+	}
+	sort.Slice(events, func(a, b int) bool { return events[a].Key < events[b].Key })
+
+	var deltas []priceDelta
+	for _, event := range events {
+		market := byId[strings.ToLower(event.MarketId)]
+		var collateral, hash float64
+		switch event.Name {
+		case "SupplyCollateral":
+			collateral = tokenUnits(event.Assets, market.CollateralDecimals)
+		case "WithdrawCollateral":
+			collateral = -tokenUnits(event.Assets, market.CollateralDecimals)
+		case "Borrow":
+			hash = tokenUnits(event.Assets, market.LoanDecimals)
+		case "Repay":
+			hash = -tokenUnits(event.Assets, market.LoanDecimals)
+		case "Liquidate":
+			collateral = -tokenUnits(event.SeizedAssets, market.CollateralDecimals)
+			hash = -tokenUnits(event.RepaidAssets, market.LoanDecimals) - tokenUnits(event.BadDebtAssets, market.LoanDecimals)
+		default:
+			continue
+		}
+		seconds, _, _ := strings.Cut(event.Timestamp, ".")
+		timestamp, err := strconv.ParseInt(seconds, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		// keys start with block:transactionIndex, so events of one transaction share a prefix
+		if n := len(deltas); n > 0 && strings.HasPrefix(deltas[n-1].key, event.Key[:19]) {
+			deltas[n-1].key = event.Key
+			deltas[n-1].collateral += collateral
+			deltas[n-1].hash += hash
+			continue
+		}
+		deltas = append(deltas, priceDelta{key: event.Key, timestamp: timestamp, collateral: collateral, hash: hash})
+	}
+	return deltas, nil
+}
+
+func (f *PriceAnalysisFeed) cursor() (string, bool, error) {
+	var cursor string
+	err := f.Users.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(priceFeedCursorKey))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		cursor = string(value)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", false, nil
+	}
+	return cursor, err == nil, err
+}
+
+func (f *PriceAnalysisFeed) setCursor(key string) error {
+	return f.Users.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(priceFeedCursorKey), []byte(key))
+	})
+}
+
+// Apply publishes a point for every transaction indexed since the last one applied. A feed
+// that has never run is backfilled instead, so history is not replayed onto the topic.
+func (f *PriceAnalysisFeed) Apply() error {
+	cursor, found, err := f.cursor()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return f.Backfill()
+	}
+	deltas, err := f.deltas(cursor)
+	if err != nil {
+		return err
+	}
+	for _, delta := range deltas {
+		_, err := f.Users.appendPricePoint(delta.collateral, delta.hash, delta.timestamp)
+		if err != nil {
+			return err
+		}
+		err = f.setCursor(delta.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestTopicSequence is the sequence number of the market topic's newest message, or 0 when
+// it has none.
+func latestTopicSequence() (int64, error) {
+	var page TopicMessagesMNAPIResponse
+	err := mirrorGet(fmt.Sprintf("/api/v1/topics/%s/messages?order=desc&limit=1", MarketTopicId), &page)
+	if err != nil || len(page.Messages) == 0 {
+		return 0, err
+	}
+	return page.Messages[0].SequenceNumber, nil
+}
+
+// Backfill replaces the local series with one recomputed from the pool's full history: the
+// running totals after each transaction. The topic's messages so far are skipped rather than
+// synced, since the recomputed series already covers what they recorded; running it again
+// yields the same series.
+func (f *PriceAnalysisFeed) Backfill() error {
+	for {
+		indexed, err := f.Indexer.Sync()
+		if err != nil {
+			return err
+		}
+		if len(indexed) == 0 {
+			break
+		}
+	}
+	deltas, err := f.deltas("")
+	if err != nil {
+		return err
+	}
+
+	priceAnalysisMu.Lock()
+	defer priceAnalysisMu.Unlock()
+	sequence, err := latestTopicSequence()
+	if err != nil {
+		return err
+	}
+	return f.Users.DB.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		prefix := []byte(priceAnalysisPrefix)
+		var stale [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			stale = append(stale, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		for _, key := range stale {
+			err := txn.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+
+		var point MarketMessages
+		for j, delta := range deltas {
+			point = MarketMessages{
+				Collateral: point.Collateral + delta.collateral,
+				Hash:       point.Hash + delta.hash,
+				Timestamp:  delta.timestamp,
+			}
+			err := f.Users.putPricePoints(txn, int64(j+1), point)
+			if err != nil {
+				return err
+			}
+		}
+		cursor := ""
+		if n := len(deltas); n > 0 {
+			cursor = deltas[n-1].key
+		}
+		err := txn.Set([]byte(priceFeedCursorKey), []byte(cursor))
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte(priceAnalysisCursorKey), []byte(strconv.FormatInt(sequence, 10)))
+	})
+}
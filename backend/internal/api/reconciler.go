@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+// loanStatusTolerance is how far (relative) a client-reported amount may drift from chain
+// state, to absorb interest accrued between the client's read and ours.
+const loanStatusTolerance = 0.01
+
+var loanEvents = map[string]bool{
+	"Borrow":             true,
+	"Repay":              true,
+	"SupplyCollateral":   true,
+	"WithdrawCollateral": true,
+	"Liquidate":          true,
+}
+
+// LoanReconciler derives a user's LoanStatus from their on-chain position and the indexed
+// pool events instead of trusting what the client reports.
+type LoanReconciler struct {
+	Users   *UserHandler
+	Indexer *EventIndexer
+}
+
+func NewLoanReconciler(users *UserHandler, indexer *EventIndexer) *LoanReconciler {
+	return &LoanReconciler{Users: users, Indexer: indexer}
+}
+
+// tokenSymbol resolves an HTS token's symbol from its long-zero EVM address.
+func tokenSymbol(address string) string {
+	tokenId, err := hiero.TokenIDFromSolidityAddress(strings.TrimPrefix(address, "0x"))
+	if err != nil {
+		return address
+	}
+	token, err := getTokenInfo(tokenId.String())
+	if err != nil || token.Symbol == "" {
+		return tokenId.String()
+	}
+	return token.Symbol
+}
+
+// deriveLoanStatus builds the loan status justified by chain state: amounts from the current
+// position and the transaction of the latest loan event touching the user.
+func (l *LoanReconciler) deriveLoanStatus(userAccountId, marketId string) (LoanStatus, error) {
+	evmAddress, err := resolveEvmAddress(userAccountId)
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	_, err = l.Indexer.Sync()
+	if err != nil {
+		fmt.Println("Error syncing indexer before reconcile: ", err)
+	}
+	position, err := getUserPosition(marketId, evmAddress)
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	marketState, err := getMarketState(marketId)
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	events, err := l.Indexer.UserEvents(evmAddress)
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	var transactionHash string
+	for j := len(events) - 1; j >= 0; j-- {
+		event := events[j]
+		if loanEvents[event.Name] && event.MarketId == strings.ToLower(marketId) && event.Account() == evmAddress {
+			transactionHash = event.TransactionHash
+			break
+		}
+	}
+
+	return LoanStatus{
+		CollateralToken:  tokenSymbol(marketState.Params.CollateralToken.Hex()),
+		CollateralAmount: position.Collateral,
+		BorrowedToken:    tokenSymbol(marketState.Params.LoanToken.Hex()),
+		BorrowedAmount:   position.BorrowShares,
+		APY:              marketState.BorrowAPY,
+		MarketId:         strings.ToLower(marketId),
+		TransactionHash:  transactionHash,
+		UpdatedAt:        time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+func withinTolerance(claimed, actual float64) bool {
+	if actual == 0 {
+		return claimed == 0
+	}
+	return math.Abs(claimed-actual)/math.Abs(actual) <= loanStatusTolerance
+}
+
+// HandleReconcileUserLoanStatus records the chain-derived loan status on the user's profile.
+// Routes without a {marketId} reconcile the default market.
+// A client may still post the status it believes in, which is rejected if it disagrees with
+// chain state. Nothing is recorded unless a new pool transaction justifies the change.
+func (l *LoanReconciler) HandleReconcileUserLoanStatus(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	marketId := chi.URLParam(r, "marketId")
+	if marketId == "" {
+		marketId = DefaultMarketId
+	}
+	if _, err := marketIdToBytes32(marketId); err != nil {
+		http.Error(w, "Invalid market ID", http.StatusBadRequest)
+		return
+	}
+	topicId, err := l.Users.getUserTopicId(userAccountId)
+	if err != nil {
+		http.Error(w, "Failed to get user topic ID", http.StatusInternalServerError)
+		return
+	}
+	derived, err := l.deriveLoanStatus(userAccountId, marketId)
+	if err != nil {
+		fmt.Println("Error deriving loan status: ", err)
+		http.Error(w, "Failed to derive loan status from chain", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Body != nil && r.ContentLength > 0 {
+		var claimed LoanStatus
+		err = json.NewDecoder(r.Body).Decode(&claimed)
+		if err != nil {
+			http.Error(w, "Failed to decode loan status", http.StatusBadRequest)
+			return
+		}
+		if !withinTolerance(claimed.CollateralAmount, derived.CollateralAmount) || !withinTolerance(claimed.BorrowedAmount, derived.BorrowedAmount) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":    false,
+				"message":    "Loan status does not match on-chain position",
+				"loanStatus": derived,
+			})
+			return
+		}
+	}
+
+	userData, err := l.Users.getLatestMessageFromTopic(topicId)
+	if err != nil {
+		http.Error(w, "Failed to get user data from topic", http.StatusInternalServerError)
+		return
+	}
+	var user User
+	err = json.Unmarshal([]byte(userData), &user)
+	if err != nil {
+		http.Error(w, "Failed to unmarshal user data", http.StatusInternalServerError)
+		return
+	}
+
+	changed := derived.TransactionHash != ""
+	for j := len(user.LoanStatus) - 1; j >= 0; j-- {
+		entry := user.LoanStatus[j]
+		// entries recorded before markets were tracked belong to the default market
+		if entry.MarketId == derived.MarketId || (entry.MarketId == "" && derived.MarketId == strings.ToLower(DefaultMarketId)) {
+			changed = changed && entry.TransactionHash != derived.TransactionHash
+			break
+		}
+	}
+	if changed {
+		user.LoanStatus = append(user.LoanStatus, derived)
+		err = l.Users.publishUserProfile(topicId, user, "User loan status reconciled")
+		if err != nil {
+			fmt.Println("Error publishing user profile: ", err)
+			http.Error(w, "Failed to record loan status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"changed":    changed,
+		"loanStatus": derived,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode loan status", http.StatusInternalServerError)
+		return
+	}
+}
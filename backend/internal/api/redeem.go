@@ -0,0 +1,570 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const redemptionPrefix = "redemption:"
+
+// A redemption moves through received → verified → burned → recorded → completed. A transfer
+// that does not match the request is rejected, and the units the user did send to the
+// treasury are refunded; tokens received whose burn settled as failed are refunded too.
+const (
+	RedemptionReceived = "received"
+	RedemptionVerified = "verified"
+	RedemptionBurned   = "burned"
+	RedemptionRecorded = "recorded"
+	RedemptionComplete = "completed"
+	RedemptionRejected = "rejected"
+	RedemptionRefunded = "refunded"
+)
+
+const StepPull = "pull"
+
+var (
+	errTransferNotIngested = errors.New("transfer not yet visible on the mirror node")
+	errTransferMismatch    = errors.New("transfer does not match the redemption")
+)
+
+// RedeemRequest redeems shares of symbol. TransactionId is the user's transfer of the tokens
+// to the treasury; without one the backend pulls them using the allowance the user granted
+// the operator, and the request needs an Idempotency-Key header and a signed-in session
+// instead.
+type RedeemRequest struct {
+	Symbol        string `json:"symbol"`
+	Shares        string `json:"shares"`
+	TransactionId string `json:"transactionId"`
+	Sell          bool   `json:"sell"`
+}
+
+type Redemption struct {
+	Id            string        `json:"id"`
+	UserAccountId string        `json:"userAccountId"`
+	Symbol        string        `json:"symbol"`
+	TokenId       string        `json:"tokenId"`
+	Shares        string        `json:"shares"`
+	Units         int64         `json:"units"`
+	Sell          bool          `json:"sell"`
+	State         string        `json:"state"`
+	TransferTxId  string        `json:"transferTxId,omitempty"`
+	BurnTxId      string        `json:"burnTxId,omitempty"`
+	RefundTxId    string        `json:"refundTxId,omitempty"`
+	RecordTxId    string        `json:"recordTxId,omitempty"`
+	RefundUnits   int64         `json:"refundUnits,omitempty"`
+	Pull          *WorkflowStep `json:"pull,omitempty"`
+	Burn          *WorkflowStep `json:"burn,omitempty"`
+	Refund        *WorkflowStep `json:"refund,omitempty"`
+	Record        *WorkflowStep `json:"record,omitempty"`
+	OrderId       string        `json:"orderId,omitempty"`
+	SellError     string        `json:"sellError,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	History       []string      `json:"history"`
+	CreatedAt     string        `json:"createdAt"`
+	UpdatedAt     string        `json:"updatedAt"`
+}
+
+func redemptionKey(userAccountId, id string) string {
+	return redemptionPrefix + userAccountId + ":" + id
+}
+
+func (u *UserHandler) getRedemption(userAccountId, id string) (Redemption, bool, error) {
+	var redemption Redemption
+	err := u.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(redemptionKey(userAccountId, id)))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &redemption)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return Redemption{}, false, nil
+	}
+	return redemption, err == nil, err
+}
+
+func (u *UserHandler) putRedemption(redemption Redemption) error {
+	if redemption.Pull != nil {
+		redemption.TransferTxId = redemption.Pull.TransactionId
+	}
+	if redemption.Burn != nil {
+		redemption.BurnTxId = redemption.Burn.TransactionId
+	}
+	if redemption.Refund != nil {
+		redemption.RefundTxId = redemption.Refund.TransactionId
+	}
+	if redemption.Record != nil {
+		redemption.RecordTxId = redemption.Record.TransactionId
+	}
+	redemption.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledRedemption, err := json.Marshal(redemption)
+	if err != nil {
+		return err
+	}
+	return u.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(redemptionKey(redemption.UserAccountId, redemption.Id)), marshaledRedemption)
+	})
+}
+
+func (u *UserHandler) Redemptions(userAccountId string) ([]Redemption, error) {
+	redemptions := []Redemption{}
+	err := u.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(redemptionPrefix + userAccountId + ":")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var redemption Redemption
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &redemption)
+			})
+			if err != nil {
+				return err
+			}
+			redemptions = append(redemptions, redemption)
+		}
+		return nil
+	})
+	return redemptions, err
+}
+
+// transition moves the redemption to state and persists it, so a crash resumes from the
+// last completed step.
+func (u *UserHandler) transition(redemption *Redemption, state string) error {
+	redemption.State = state
+	redemption.Error = ""
+	redemption.History = append(redemption.History, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), state))
+	return u.putRedemption(*redemption)
+}
+
+// releaseShares moves a redemption whose tokens were burned to burned and unlocks the shares
+// they were backed by, in one write.
+func (u *UserHandler) releaseShares(redemption *Redemption, asset AssetRecord) error {
+	redemption.State = RedemptionBurned
+	redemption.Error = ""
+	redemption.History = append(redemption.History, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), RedemptionBurned))
+	redemption.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledRedemption, err := json.Marshal(redemption)
+	if err != nil {
+		return err
+	}
+	return u.DB.Update(func(txn *badger.Txn) error {
+		err := adjustShareLock(txn, redemption.UserAccountId, asset, -redemption.Units)
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte(redemptionKey(redemption.UserAccountId, redemption.Id)), marshaledRedemption)
+	})
+}
+
+// verifyRedemptionTransfer checks that the mirror node recorded the transfer as moving exactly
+// the redeemed units from the user to the treasury. On a mismatch it also returns how many of
+// the user's units reached the treasury, which are refunded.
+func verifyRedemptionTransfer(redemption Redemption, treasury string) (int64, error) {
+	transaction, found, err := getMirrorTransaction(redemption.TransferTxId)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errTransferNotIngested
+	}
+	if transaction.Result != "SUCCESS" {
+		return 0, fmt.Errorf("%w: %s failed with %s", errTransferMismatch, redemption.TransferTxId, transaction.Result)
+	}
+	var sent, received int64
+	for _, transfer := range transaction.TokenTransfers {
+		if transfer.TokenId != redemption.TokenId {
+			continue
+		}
+		switch transfer.Account {
+		case redemption.UserAccountId:
+			sent -= transfer.Amount
+		case treasury:
+			received += transfer.Amount
+		}
+	}
+	if sent != redemption.Units || received != redemption.Units {
+		return max(min(sent, received), 0), fmt.Errorf("%w: %s moved %d units from %s and %d to the treasury, expected %d",
+			errTransferMismatch, redemption.TransferTxId, sent, redemption.UserAccountId, received, redemption.Units)
+	}
+	return 0, nil
+}
+
+// pullRedemptionTokens moves the redeemed units to the treasury under transactionId, with the
+// allowance the user granted the operator.
+func (u *UserHandler) pullRedemptionTokens(redemption Redemption, treasury string, transactionId hiero.TransactionID) error {
+	tokenId, err := hiero.TokenIDFromString(redemption.TokenId)
+	if err != nil {
+		return err
+	}
+	owner, err := hiero.AccountIDFromString(redemption.UserAccountId)
+	if err != nil {
+		return err
+	}
+	treasuryId, err := hiero.AccountIDFromString(treasury)
+	if err != nil {
+		return err
+	}
+	operatorKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTransferTransaction().
+		SetTransactionID(transactionId).
+		AddApprovedTokenTransfer(tokenId, owner, -redemption.Units, true).
+		AddTokenTransfer(tokenId, treasuryId, redemption.Units).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(operatorKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	_, err = txResponse.GetReceipt(u.Client)
+	return err
+}
+
+// burn burns units of a token from the treasury under transactionId.
+func (u *UserHandler) burn(tokenIdStr string, units int64, transactionId hiero.TransactionID) error {
+	tokenId, err := hiero.TokenIDFromString(tokenIdStr)
+	if err != nil {
+		return err
+	}
+	supplyKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTokenBurnTransaction().
+		SetTransactionID(transactionId).
+		SetTokenID(tokenId).
+		SetAmount(uint64(units)).
+		SetMaxTransactionFee(hiero.HbarFrom(20, hiero.HbarUnits.Hbar)).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(supplyKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	receipt, err := txResponse.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The burn transaction consensus status is %v\n", receipt.Status)
+	return nil
+}
+
+// burnFailed settles the redemption's burn. It reports whether the burn failed for good: it
+// reached consensus and failed, or never reached consensus within its validity window. A
+// burn whose outcome is unknown, such as one whose receipt timed out, is left to settle on
+// the next call.
+func (u *UserHandler) burnFailed(redemption *Redemption, put func() error) (bool, error) {
+	burn := redemption.Burn
+	switch {
+	case burn == nil || burn.TransactionId == "":
+		if burn == nil {
+			redemption.Burn = &WorkflowStep{Name: StepBurn, Status: StepPending}
+		}
+		err := runStep(redemption.Burn, put, func(transactionId hiero.TransactionID) error {
+			return u.burn(redemption.TokenId, redemption.Units, transactionId)
+		})
+		return redemption.Burn.Status == StepPending && redemption.Burn.TransactionId != "", err
+	case burn.Status == StepSubmitted:
+		succeeded, err := settle(burn)
+		if err != nil {
+			return false, err
+		}
+		if succeeded {
+			burn.Status = StepDone
+			burn.Error = ""
+			burn.CompletedAt = time.Now().Format(time.RFC3339)
+			return false, nil
+		}
+		burn.Status = StepPending
+		return true, put()
+	default:
+		return burn.Status == StepPending, nil
+	}
+}
+
+// advanceRedemption runs the redemption from its current state until it completes or a step
+// fails. Failed steps leave the state where it was so the next call retries or settles them;
+// tokens that reached the treasury are sent back to the user only once their burn settled as
+// failed, or when the transfer that brought them was rejected.
+func (u *UserHandler) advanceRedemption(redemption *Redemption) error {
+	asset, err := u.Assets.Get(redemption.Symbol)
+	if err != nil {
+		return err
+	}
+	token, err := getTokenInfo(redemption.TokenId)
+	if err != nil {
+		return err
+	}
+	treasury := token.TreasuryAccountId
+	put := func() error {
+		return u.putRedemption(*redemption)
+	}
+
+	for {
+		switch redemption.State {
+		case RedemptionReceived:
+			if redemption.Pull == nil && redemption.TransferTxId == "" {
+				redemption.Pull = &WorkflowStep{Name: StepPull, Status: StepPending}
+			}
+			if redemption.Pull != nil {
+				// a pull that failed is submitted again; one in flight is settled first
+				err = runStep(redemption.Pull, put, func(transactionId hiero.TransactionID) error {
+					return u.pullRedemptionTokens(*redemption, treasury, transactionId)
+				})
+				if err != nil {
+					return err
+				}
+			} else {
+				var received int64
+				received, err = verifyRedemptionTransfer(*redemption, treasury)
+				if errors.Is(err, errTransferMismatch) {
+					if received > 0 {
+						redemption.Refund = &WorkflowStep{Name: StepTransfer, Status: StepPending}
+						redemption.RefundUnits = received
+					}
+					reason := err.Error()
+					err = u.transition(redemption, RedemptionRejected)
+					if err != nil {
+						return err
+					}
+					redemption.Error = reason
+					err = put()
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+			err = u.transition(redemption, RedemptionVerified)
+
+		case RedemptionRejected:
+			// units the user sent with a transfer that did not match are sent back, so a
+			// corrected redemption starts from a new transfer
+			if redemption.Refund != nil {
+				err = runStep(redemption.Refund, put, func(transactionId hiero.TransactionID) error {
+					return u.transfer(redemption.UserAccountId, redemption.TokenId, redemption.RefundUnits, transactionId)
+				})
+				if err != nil {
+					return fmt.Errorf("refunding %d units of %s: %w", redemption.RefundUnits, redemption.TransferTxId, err)
+				}
+			}
+			return fmt.Errorf("%w: %s", errTransferMismatch, redemption.TransferTxId)
+
+		case RedemptionVerified:
+			var failed bool
+			failed, err = u.burnFailed(redemption, put)
+			if !failed {
+				if err != nil {
+					return err
+				}
+				err = u.releaseShares(redemption, asset)
+				break
+			}
+			burnErr := fmt.Errorf("burn %s failed: %s", redemption.Burn.TransactionId, redemption.Burn.Error)
+			if redemption.Refund == nil {
+				redemption.Refund = &WorkflowStep{Name: StepTransfer, Status: StepPending}
+			}
+			err = runStep(redemption.Refund, put, func(transactionId hiero.TransactionID) error {
+				return u.transfer(redemption.UserAccountId, redemption.TokenId, redemption.Units, transactionId)
+			})
+			if err != nil {
+				return fmt.Errorf("%v; refund failed: %w", burnErr, err)
+			}
+			redemption.Error = burnErr.Error()
+			_ = u.transition(redemption, RedemptionRefunded)
+			return burnErr
+
+		case RedemptionBurned:
+			if redemption.Record == nil {
+				redemption.Record = &WorkflowStep{Name: StepRecord, Status: StepPending}
+			}
+			shares := asset.Shares(redemption.Units)
+			err = runStep(redemption.Record, put, func(transactionId hiero.TransactionID) error {
+				return u.recordTokenizedAsset(redemption.UserAccountId, asset, shares.Neg(), -redemption.Units, "Tokenized asset redeemed", transactionId)
+			})
+			if err != nil {
+				return err
+			}
+			err = u.transition(redemption, RedemptionRecorded)
+
+		case RedemptionRecorded:
+			// the shares were released when the tokens were burned
+			if redemption.Sell && redemption.OrderId == "" && redemption.SellError == "" {
+				var order Order
+				brokerage, err := u.brokerage(redemption.UserAccountId)
+				if err == nil {
+					order, err = brokerage.PlaceOrder(OrderRequest{
+						Symbol:        redemption.Symbol,
+						Qty:           asset.Shares(redemption.Units),
+						Side:          OrderSideSell,
+						ClientOrderId: "redeem-" + redemption.Id,
+					})
+				}
+				if err != nil {
+					// the shares stay in the brokerage account, which is where the user's
+					// value is once the tokens are gone
+					fmt.Println("Error placing redemption sell order: ", err)
+					redemption.SellError = err.Error()
+				} else {
+					redemption.OrderId = order.Id
+				}
+			}
+			err = u.transition(redemption, RedemptionComplete)
+
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HandleRedeem burns tokens the user returned to the treasury and releases the shares behind
+// them. Repeating a request resumes the redemption it started rather than starting another.
+func (u *UserHandler) HandleRedeem(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	var request RedeemRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Failed to decode redemption", http.StatusBadRequest)
+		return
+	}
+	asset, ok, err := u.Assets.Eligible(request.Symbol)
+	if err != nil {
+		fmt.Println("Error getting asset: ", err)
+		http.Error(w, "Failed to redeem", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Asset cannot be redeemed", http.StatusBadRequest)
+		return
+	}
+	shares, err := decimal.NewFromString(request.Shares)
+	if err != nil || !shares.IsPositive() {
+		http.Error(w, "Invalid shares", http.StatusBadRequest)
+		return
+	}
+	shares, units, err := asset.Units(shares)
+	if err != nil || units == 0 {
+		http.Error(w, "Invalid shares", http.StatusBadRequest)
+		return
+	}
+
+	id := mirrorTransactionId(request.TransactionId)
+	if request.TransactionId == "" {
+		key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if key == "" {
+			http.Error(w, "Missing transactionId or Idempotency-Key header", http.StatusBadRequest)
+			return
+		}
+		// pulling tokens spends the user's allowance, so only the signed-in owner may ask
+		if signedIn, ok := AuthenticatedUser(r.Context()); !ok || signedIn != userAccountId {
+			http.Error(w, "Sign in to redeem without a transfer", http.StatusUnauthorized)
+			return
+		}
+		id = "allowance-" + key
+	}
+
+	tokenizeMu.Lock()
+	defer tokenizeMu.Unlock()
+
+	redemption, found, err := u.getRedemption(userAccountId, id)
+	if err != nil {
+		fmt.Println("Error getting redemption: ", err)
+		http.Error(w, "Failed to redeem", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		redemption = Redemption{
+			Id:            id,
+			UserAccountId: userAccountId,
+			Symbol:        asset.Symbol,
+			TokenId:       asset.TokenId,
+			Shares:        shares.String(),
+			Units:         units,
+			Sell:          request.Sell,
+			TransferTxId:  request.TransactionId,
+			History:       []string{},
+			CreatedAt:     time.Now().Format(time.RFC3339),
+		}
+		err = u.transition(&redemption, RedemptionReceived)
+		if err != nil {
+			fmt.Println("Error storing redemption: ", err)
+			http.Error(w, "Failed to redeem", http.StatusInternalServerError)
+			return
+		}
+	} else if redemption.Units != units || redemption.Symbol != asset.Symbol {
+		http.Error(w, "Redemption already exists with different parameters", http.StatusConflict)
+		return
+	}
+
+	status := http.StatusOK
+	err = u.advanceRedemption(&redemption)
+	switch {
+	case errors.Is(err, errTransferNotIngested):
+		status = http.StatusAccepted
+	case errors.Is(err, errTransferMismatch), err != nil && redemption.State == RedemptionRefunded:
+		status = http.StatusUnprocessableEntity
+	case err != nil:
+		fmt.Println("Error redeeming: ", err)
+		redemption.Error = err.Error()
+		_ = u.putRedemption(redemption)
+		status = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(map[string]Redemption{
+		"redemption": redemption,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode redemption", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserHandler) HandleGetRedemptions(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	redemptions, err := u.Redemptions(userAccountId)
+	if err != nil {
+		fmt.Println("Error getting redemptions: ", err)
+		http.Error(w, "Failed to get redemptions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]Redemption{
+		"redemptions": redemptions,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode redemptions", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const reservesPrefix = "reserves:"
+
+var defaultReservesInterval = 15 * time.Minute
+
+// AssetReserves compares the shares held at the brokerage for a symbol with the tokens in
+// circulation, that is the total supply less what sits in the treasury. Ratio is nil when
+// nothing circulates.
+type AssetReserves struct {
+	Symbol            string   `json:"symbol"`
+	TokenId           string   `json:"tokenId"`
+	BrokerageShares   string   `json:"brokerageShares"`
+	BrokerageUnits    int64    `json:"brokerageUnits"`
+	TotalSupply       int64    `json:"totalSupply"`
+	TreasuryBalance   int64    `json:"treasuryBalance"`
+	CirculatingUnits  int64    `json:"circulatingUnits"`
+	CirculatingShares string   `json:"circulatingShares"`
+	Ratio             *float64 `json:"ratio"`
+	Backed            bool     `json:"backed"`
+}
+
+// ReserveAttestation is one reconciliation of every tokenized asset. Signature is the
+// operator's ed25519 signature over the record's JSON with Signature and TopicSequence empty,
+// since the sequence number is assigned after signing.
+type ReserveAttestation struct {
+	Assets        []AssetReserves `json:"assets"`
+	Ratio         *float64        `json:"ratio"`
+	Alert         bool            `json:"alert"`
+	AlertSince    int64           `json:"alertSince,omitempty"`
+	Errors        []string        `json:"errors,omitempty"`
+	TopicSequence uint64          `json:"topicSequence,omitempty"`
+	AttestedAt    int64           `json:"attestedAt"`
+	PublicKey     string          `json:"publicKey"`
+	Signature     string          `json:"signature,omitempty"`
+}
+
+// ReserveAttestor periodically reconciles the brokerage positions backing the tokenized
+// stocks with their HTS supply and publishes the result to an HCS reserves topic when one
+// is configured. Backing below 100% for any asset puts the attestation in alert. The shares
+// are those of the platform account and of every linked user account.
+type ReserveAttestor struct {
+	DB          *badger.DB
+	Platform    Brokerage
+	Assets      *AssetRegistry
+	Credentials *BrokerageCredentialStore
+	TopicId     string
+	Interval    time.Duration
+
+	mu     sync.Mutex
+	latest *ReserveAttestation
+}
+
+func NewReserveAttestor(db *badger.DB, platform Brokerage, assets *AssetRegistry, credentials *BrokerageCredentialStore) *ReserveAttestor {
+	r := &ReserveAttestor{
+		DB:          db,
+		Platform:    platform,
+		Assets:      assets,
+		Credentials: credentials,
+		TopicId:     os.Getenv("RESERVES_TOPIC_ID"),
+		Interval:    defaultReservesInterval,
+	}
+	if interval, err := time.ParseDuration(os.Getenv("RESERVES_INTERVAL")); err == nil {
+		r.Interval = interval
+	}
+	return r
+}
+
+func reservesKey(attestedAt int64) string {
+	return fmt.Sprintf("%s%020d", reservesPrefix, attestedAt)
+}
+
+func (r *ReserveAttestor) Run(ctx context.Context) {
+	latest, err := r.History(1)
+	if err != nil {
+		fmt.Println("Error loading last reserve attestation: ", err)
+	} else if len(latest) > 0 {
+		r.latest = &latest[0]
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		attestation, err := r.Attest()
+		if err != nil {
+			fmt.Println("Error attesting reserves: ", err)
+		} else if attestation.Alert {
+			fmt.Println("Reserves alert: tokenized supply is not fully backed since ", time.Unix(attestation.AlertSince, 0).UTC())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heldShares sums the shares per symbol across the platform account and the linked user
+// accounts, counting an account linked by several users once. An account that cannot be read
+// is left out and reported in the returned errors, so one user's broken link does not stop
+// the others from being counted.
+func (r *ReserveAttestor) heldShares() (map[string]decimal.Decimal, []string, error) {
+	linked, err := r.Credentials.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	held := map[string]decimal.Decimal{}
+	accountErrors := []string{}
+	seen := map[string]bool{}
+	count := func(brokerage Brokerage) error {
+		account, err := brokerage.Account()
+		if err != nil {
+			return err
+		}
+		key := account.Provider + ":" + account.AccountNumber
+		if seen[key] {
+			return nil
+		}
+		positions, err := brokerage.Positions()
+		if err != nil {
+			return err
+		}
+		seen[key] = true
+		for _, position := range positions {
+			held[position.Symbol] = held[position.Symbol].Add(position.Qty)
+		}
+		return nil
+	}
+
+	err = count(r.Platform)
+	if err != nil {
+		accountErrors = append(accountErrors, fmt.Sprintf("platform brokerage account: %v", err))
+	}
+	for _, credentials := range linked {
+		brokerage, err := r.Credentials.open(credentials)
+		if err == nil {
+			err = count(brokerage)
+		}
+		if err != nil {
+			accountErrors = append(accountErrors, fmt.Sprintf("brokerage account of %s: %v", credentials.UserAccountId, err))
+		}
+	}
+	return held, accountErrors, nil
+}
+
+// reconcile compares one asset's brokerage position with its circulating supply.
+func reconcile(asset AssetRecord, brokerageShares decimal.Decimal) (AssetReserves, error) {
+	reserves := AssetReserves{Symbol: asset.Symbol, TokenId: asset.TokenId, Backed: true}
+	_, brokerageUnits, err := asset.Units(brokerageShares)
+	if err != nil {
+		return reserves, err
+	}
+	reserves.BrokerageShares = brokerageShares.String()
+	reserves.BrokerageUnits = brokerageUnits
+
+	token, err := getTokenInfo(asset.TokenId)
+	if err != nil {
+		return reserves, err
+	}
+	reserves.TotalSupply, err = strconv.ParseInt(token.TotalSupply, 10, 64)
+	if err != nil {
+		return reserves, err
+	}
+	reserves.TreasuryBalance, err = accountTokenBalance(token.TreasuryAccountId, asset.TokenId)
+	if err != nil {
+		return reserves, err
+	}
+	reserves.CirculatingUnits = reserves.TotalSupply - reserves.TreasuryBalance
+	reserves.CirculatingShares = asset.Shares(reserves.CirculatingUnits).String()
+	if reserves.CirculatingUnits > 0 {
+		ratio := float64(reserves.BrokerageUnits) / float64(reserves.CirculatingUnits)
+		reserves.Ratio = &ratio
+		reserves.Backed = reserves.BrokerageUnits >= reserves.CirculatingUnits
+	}
+	return reserves, nil
+}
+
+// Attest reconciles every registered asset, then signs, publishes and stores the result. An
+// asset or brokerage account that cannot be reconciled is reported in Errors and puts the
+// attestation in alert, since the backing is then unknown.
+func (r *ReserveAttestor) Attest() (ReserveAttestation, error) {
+	privateKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return ReserveAttestation{}, err
+	}
+	assets, err := r.Assets.List()
+	if err != nil {
+		return ReserveAttestation{}, err
+	}
+	held, accountErrors, err := r.heldShares()
+	if err != nil {
+		return ReserveAttestation{}, err
+	}
+
+	attestation := ReserveAttestation{
+		Assets:     []AssetReserves{},
+		AttestedAt: time.Now().Unix(),
+		PublicKey:  privateKey.PublicKey().StringRaw(),
+	}
+	if len(accountErrors) > 0 {
+		// shares in the accounts that could not be read are missing from the totals
+		attestation.Alert = true
+		attestation.Errors = accountErrors
+	}
+	for _, asset := range assets {
+		if asset.TokenId == "" {
+			continue
+		}
+		reserves, err := reconcile(asset, held[asset.Symbol])
+		if err != nil {
+			attestation.Alert = true
+			attestation.Errors = append(attestation.Errors, fmt.Sprintf("%s: %v", asset.Symbol, err))
+			continue
+		}
+		attestation.Assets = append(attestation.Assets, reserves)
+		attestation.Alert = attestation.Alert || !reserves.Backed
+		if reserves.Ratio != nil && (attestation.Ratio == nil || *reserves.Ratio < *attestation.Ratio) {
+			attestation.Ratio = reserves.Ratio
+		}
+	}
+	if attestation.Alert {
+		attestation.AlertSince = attestation.AttestedAt
+		r.mu.Lock()
+		if r.latest != nil && r.latest.Alert {
+			attestation.AlertSince = r.latest.AlertSince
+		}
+		r.mu.Unlock()
+	}
+
+	unsigned, err := json.Marshal(attestation)
+	if err != nil {
+		return attestation, err
+	}
+	attestation.Signature = hex.EncodeToString(privateKey.Sign(unsigned))
+
+	if r.TopicId != "" {
+		attestation.TopicSequence, err = publishSigned(r.TopicId, "Reserve attestation", attestation)
+		if err != nil {
+			return attestation, err
+		}
+	}
+
+	marshaledAttestation, err := json.Marshal(attestation)
+	if err != nil {
+		return attestation, err
+	}
+	err = r.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(reservesKey(attestation.AttestedAt)), marshaledAttestation)
+	})
+	if err != nil {
+		return attestation, err
+	}
+	r.mu.Lock()
+	r.latest = &attestation
+	r.mu.Unlock()
+	return attestation, nil
+}
+
+// History returns up to limit attestations, newest first.
+func (r *ReserveAttestor) History(limit int) ([]ReserveAttestation, error) {
+	attestations := []ReserveAttestation{}
+	err := r.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(reservesPrefix)
+		for it.Seek(append(prefix, 0xff)); it.ValidForPrefix(prefix) && len(attestations) < limit; it.Next() {
+			var attestation ReserveAttestation
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &attestation)
+			})
+			if err != nil {
+				return err
+			}
+			attestations = append(attestations, attestation)
+		}
+		return nil
+	})
+	return attestations, err
+}
+
+func (r *ReserveAttestor) HandleGetReserves(w http.ResponseWriter, req *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(req.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	history, err := r.History(limit)
+	if err != nil {
+		fmt.Println("Error getting reserve attestations: ", err)
+		http.Error(w, "Failed to get reserve attestations", http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"history": history,
+		"alert":   false,
+	}
+	if len(history) > 0 {
+		response["latest"] = history[0]
+		response["ratio"] = history[0].Ratio
+		response["alert"] = history[0].Alert
+		if history[0].Alert {
+			response["alertSince"] = history[0].AlertSince
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode reserve attestations", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/shopspring/decimal"
+)
+
+func putAttestedHoldings(t *testing.T, db *badger.DB, userAccountId string, holdings ...ManualHolding) {
+	t.Helper()
+	err := db.Update(func(txn *badger.Txn) error {
+		return putManualHoldings(txn, ManualHoldings{UserAccountId: userAccountId, Holdings: holdings, Status: HoldingsAttested})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeldSharesSkipsAccountsThatCannotBeRead(t *testing.T) {
+	db := newTestDB(t)
+	credentials := NewBrokerageCredentialStore(db, nil)
+	putAttestedHoldings(t, db, "platform", ManualHolding{Symbol: "AAPL", Qty: decimal.NewFromInt(5)})
+	putAttestedHoldings(t, db, "0.0.1001", ManualHolding{Symbol: "AAPL", Qty: decimal.NewFromInt(3)})
+	if err := credentials.LinkManual("0.0.1001"); err != nil {
+		t.Fatal(err)
+	}
+	// secrets that no longer decrypt
+	err := credentials.put(BrokerageCredentials{UserAccountId: "0.0.1002", Provider: BrokerageAlpaca, AccountNumber: "PA2", Secrets: []byte("garbage")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &ReserveAttestor{DB: db, Platform: NewManualBrokerage(db, nil, "platform"), Credentials: credentials}
+	held, accountErrors, err := r.heldShares()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !held["AAPL"].Equal(decimal.NewFromInt(8)) {
+		t.Fatalf("held AAPL = %s, want 8", held["AAPL"])
+	}
+	if len(accountErrors) != 1 || !strings.Contains(accountErrors[0], "0.0.1002") {
+		t.Fatalf("account errors = %q, want one for 0.0.1002", accountErrors)
+	}
+}
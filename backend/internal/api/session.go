@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+)
+
+const (
+	SessionOpen    = "open"
+	SessionClosed  = "closed"
+	SessionHalted  = "halted"
+	SessionUnknown = "unknown"
+)
+
+var (
+	defaultSessionInterval         = time.Minute
+	defaultClosedBorrowBufferBps   = uint64(1000)
+	defaultClosedLiquidationBuffer = uint64(500)
+)
+
+// MarketSession is the state of the US equity market the tokenized stocks trade on.
+type MarketSession struct {
+	IsOpen        bool              `json:"isOpen"`
+	TradingDay    bool              `json:"tradingDay"`
+	SessionOpen   string            `json:"sessionOpen,omitempty"`
+	SessionClose  string            `json:"sessionClose,omitempty"`
+	NextOpen      int64             `json:"nextOpen"`
+	NextClose     int64             `json:"nextClose"`
+	Symbols       map[string]string `json:"symbols"`
+	BorrowsPaused bool              `json:"borrowsPaused"`
+	CheckedAt     int64             `json:"checkedAt"`
+}
+
+// MarketSessionTracker polls Alpaca's clock, calendar and asset status so the oracle and the
+// lending subsystems can tell when a tokenized stock's price cannot move. While a symbol's
+// market is closed or halted its prices are marked stale, new borrows need
+// ClosedBorrowBufferBps of extra health (or are paused with PauseBorrows), and the keeper
+// only liquidates below 1 - ClosedLiquidationBufferBps. The stocks tracked are the assets of
+// the registry, re-read on every refresh; any other collateral trades around the clock.
+type MarketSessionTracker struct {
+	Alpaca                     *alpaca.Client
+	Assets                     *AssetRegistry
+	Interval                   time.Duration
+	PauseBorrows               bool
+	ClosedBorrowBufferBps      uint64
+	ClosedLiquidationBufferBps uint64
+
+	mu      sync.Mutex
+	session MarketSession
+}
+
+// tokenizedSymbols lists the stocks the backend tokenizes and prices: the registry's enabled
+// assets.
+func tokenizedSymbols(assets *AssetRegistry) ([]string, error) {
+	records, err := assets.List()
+	if err != nil {
+		return nil, err
+	}
+	symbols := []string{}
+	for _, asset := range records {
+		if asset.Enabled {
+			symbols = append(symbols, asset.Symbol)
+		}
+	}
+	return symbols, nil
+}
+
+// registryStock returns the registry stock symbol stands for, either as the stock itself or
+// as its token, and whether there is one.
+func registryStock(assets *AssetRegistry, symbol string) (string, bool, error) {
+	records, err := assets.List()
+	if err != nil {
+		return "", false, err
+	}
+	for _, asset := range records {
+		if asset.Symbol == normalizeSymbol(underlyingSymbol(symbol)) || (asset.TokenSymbol != "" && asset.TokenSymbol == symbol) {
+			return asset.Symbol, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// underlyingSymbol is the stock behind a tokenized symbol.
+func underlyingSymbol(tokenSymbol string) string {
+	return strings.TrimPrefix(tokenSymbol, "d")
+}
+
+func NewMarketSessionTracker(alpacaClient *alpaca.Client, assets *AssetRegistry) *MarketSessionTracker {
+	s := &MarketSessionTracker{
+		Alpaca:                     alpacaClient,
+		Assets:                     assets,
+		Interval:                   defaultSessionInterval,
+		PauseBorrows:               os.Getenv("SESSION_PAUSE_BORROWS") == "true",
+		ClosedBorrowBufferBps:      envUint64("SESSION_CLOSED_BORROW_BUFFER_BPS", defaultClosedBorrowBufferBps),
+		ClosedLiquidationBufferBps: envUint64("SESSION_CLOSED_LIQUIDATION_BUFFER_BPS", defaultClosedLiquidationBuffer),
+		session:                    MarketSession{Symbols: map[string]string{}},
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SESSION_INTERVAL")); err == nil {
+		s.Interval = interval
+	}
+	return s
+}
+
+func (s *MarketSessionTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		err := s.Refresh()
+		if err != nil {
+			fmt.Println("Error refreshing market session: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *MarketSessionTracker) Refresh() error {
+	assets, err := s.Assets.List()
+	if err != nil {
+		return err
+	}
+	clock, err := s.Alpaca.GetClock()
+	if err != nil {
+		return err
+	}
+	session := MarketSession{
+		IsOpen:    clock.IsOpen,
+		NextOpen:  clock.NextOpen.Unix(),
+		NextClose: clock.NextClose.Unix(),
+		Symbols:   map[string]string{},
+		CheckedAt: time.Now().Unix(),
+	}
+	today := clock.Timestamp
+	days, err := s.Alpaca.GetCalendar(alpaca.GetCalendarRequest{Start: today, End: today})
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if day.Date == today.Format("2006-01-02") {
+			session.TradingDay = true
+			session.SessionOpen = day.Open
+			session.SessionClose = day.Close
+		}
+	}
+
+	for _, record := range assets {
+		symbol := record.Symbol
+		state := SessionClosed
+		if clock.IsOpen {
+			state = SessionOpen
+		}
+		asset, err := s.Alpaca.GetAsset(symbol)
+		switch {
+		case err != nil:
+			fmt.Println("Error getting asset status for ", symbol, ": ", err)
+			state = SessionUnknown
+		case asset.Status != alpaca.AssetActive || !asset.Tradable:
+			state = SessionHalted
+		}
+		session.Symbols[symbol] = state
+	}
+	session.BorrowsPaused = s.PauseBorrows && !clock.IsOpen
+
+	s.mu.Lock()
+	s.session = session
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MarketSessionTracker) State() MarketSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.session
+	session.Symbols = make(map[string]string, len(s.session.Symbols))
+	for symbol, state := range s.session.Symbols {
+		session.Symbols[symbol] = state
+	}
+	return session
+}
+
+// SymbolState is the session of a stock or of its tokenized symbol. Stocks the tracker has
+// not checked yet, or could not check, are unknown.
+func (s *MarketSessionTracker) SymbolState(symbol string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.session.Symbols[underlyingSymbol(symbol)]
+	if !ok {
+		return SessionUnknown
+	}
+	return state
+}
+
+// Trading reports whether symbol's market is open. Only collateral backed by a registry stock
+// follows the stock market, and an unknown session for it counts as closed, so borrows and
+// liquidations keep their closed-market buffers until the tracker knows better. Any other
+// symbol is always trading.
+func (s *MarketSessionTracker) Trading(symbol string) bool {
+	stock, ok, err := registryStock(s.Assets, symbol)
+	if err != nil {
+		fmt.Println("Error looking up the stock behind ", symbol, ": ", err)
+		return false
+	}
+	if !ok {
+		return true
+	}
+	return s.SymbolState(stock) == SessionOpen
+}
+
+// BorrowBufferBps is the health margin above 1 new borrows against symbol must keep, and
+// whether borrows against it are paused altogether.
+func (s *MarketSessionTracker) BorrowBufferBps(symbol string) (uint64, bool) {
+	if s.Trading(symbol) {
+		return 0, false
+	}
+	return s.ClosedBorrowBufferBps, s.PauseBorrows
+}
+
+// LiquidationBufferBps is how far below 1 a position backed by symbol must fall before the
+// keeper liquidates it.
+func (s *MarketSessionTracker) LiquidationBufferBps(symbol string) uint64 {
+	if s.Trading(symbol) {
+		return 0
+	}
+	return s.ClosedLiquidationBufferBps
+}
@@ -0,0 +1,44 @@
+package api
+
+import "testing"
+
+func TestUnknownSessionIsClosed(t *testing.T) {
+	assets := NewAssetRegistry(newTestDB(t))
+	for _, symbol := range []string{"MSFT", "TSLA"} {
+		err := assets.put(AssetRecord{Symbol: symbol, TokenSymbol: "d" + symbol, Decimals: 2, Enabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &MarketSessionTracker{Assets: assets, ClosedBorrowBufferBps: 500, ClosedLiquidationBufferBps: 300, PauseBorrows: true}
+	s.session.Symbols = map[string]string{"AAPL": SessionOpen, "MSFT": SessionUnknown}
+
+	tests := []struct {
+		symbol      string
+		trading     bool
+		borrowBps   uint64
+		paused      bool
+		liquidation uint64
+	}{
+		{symbol: "AAPL", trading: true},
+		{symbol: "dAAPL", trading: true},
+		{symbol: "MSFT", borrowBps: 500, paused: true, liquidation: 300},
+		// never refreshed
+		{symbol: "dTSLA", borrowBps: 500, paused: true, liquidation: 300},
+		// not backed by a registry stock
+		{symbol: "USDC", trading: true},
+		{symbol: "dNVDA", trading: true},
+	}
+	for _, tt := range tests {
+		if got := s.Trading(tt.symbol); got != tt.trading {
+			t.Errorf("Trading(%s) = %v, want %v", tt.symbol, got, tt.trading)
+		}
+		bps, paused := s.BorrowBufferBps(tt.symbol)
+		if bps != tt.borrowBps || paused != tt.paused {
+			t.Errorf("BorrowBufferBps(%s) = %d, %v, want %d, %v", tt.symbol, bps, paused, tt.borrowBps, tt.paused)
+		}
+		if got := s.LiquidationBufferBps(tt.symbol); got != tt.liquidation {
+			t.Errorf("LiquidationBufferBps(%s) = %d, want %d", tt.symbol, got, tt.liquidation)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const shareLockPrefix = "share-lock:"
+
+// A lock is ok while the brokerage position covers it. A shortfall flags it; one that lasts
+// FreezeAfter freezes the user's tokens and one that lasts WipeAfter wipes the unbacked units.
+const (
+	ShareLockOk      = "ok"
+	ShareLockFlagged = "flagged"
+	ShareLockFrozen  = "frozen"
+)
+
+var (
+	defaultShareLockInterval    = 5 * time.Minute
+	defaultShareLockFreezeAfter = time.Hour
+	defaultShareLockWipeAfter   = 24 * time.Hour
+)
+
+// errPositionUnknown means the user's brokerage position cannot be read, as opposed to
+// holding no shares.
+var errPositionUnknown = errors.New("brokerage position unknown")
+
+// ShareLock is the part of a user's brokerage position in symbol that backs tokens: the units
+// minted to the user and not yet redeemed. Wipe is the wipe in flight and Record the profile
+// debit that follows it, both stored before submission like workflow steps.
+type ShareLock struct {
+	UserAccountId   string        `json:"userAccountId"`
+	Symbol          string        `json:"symbol"`
+	TokenId         string        `json:"tokenId"`
+	Units           int64         `json:"units"`
+	Shares          string        `json:"shares"`
+	HeldShares      string        `json:"heldShares,omitempty"`
+	ShortfallShares string        `json:"shortfallShares,omitempty"`
+	Status          string        `json:"status"`
+	ShortfallSince  int64         `json:"shortfallSince,omitempty"`
+	Wipe            *WorkflowStep `json:"wipe,omitempty"`
+	Record          *WorkflowStep `json:"record,omitempty"`
+	WipeUnits       int64         `json:"wipeUnits,omitempty"`
+	WipedUnits      int64         `json:"wipedUnits,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	CheckedAt       int64         `json:"checkedAt,omitempty"`
+	UpdatedAt       string        `json:"updatedAt"`
+}
+
+func shareLockKey(userAccountId, symbol string) string {
+	return shareLockPrefix + userAccountId + ":" + symbol
+}
+
+func getShareLock(txn *badger.Txn, userAccountId string, asset AssetRecord) (ShareLock, error) {
+	lock := ShareLock{
+		UserAccountId: userAccountId,
+		Symbol:        asset.Symbol,
+		TokenId:       asset.TokenId,
+		Shares:        "0",
+		Status:        ShareLockOk,
+	}
+	item, err := txn.Get([]byte(shareLockKey(userAccountId, asset.Symbol)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return lock, nil
+	}
+	if err != nil {
+		return lock, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &lock)
+	})
+	return lock, err
+}
+
+func putShareLock(txn *badger.Txn, lock ShareLock) error {
+	lock.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledLock, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(shareLockKey(lock.UserAccountId, lock.Symbol)), marshaledLock)
+}
+
+// adjustShareLock adds units to the user's lock on asset. Callers pair it with the write that
+// records why, in the same transaction, so a retried step cannot apply it twice.
+func adjustShareLock(txn *badger.Txn, userAccountId string, asset AssetRecord, units int64) error {
+	lock, err := getShareLock(txn, userAccountId, asset)
+	if err != nil {
+		return err
+	}
+	// tokens minted before locks existed are released without ever being locked
+	lock.Units = max(lock.Units+units, 0)
+	lock.Shares = asset.Shares(lock.Units).String()
+	return putShareLock(txn, lock)
+}
+
+func listShareLocks(db *badger.DB, prefix string) ([]ShareLock, error) {
+	locks := []ShareLock{}
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			var lock ShareLock
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &lock)
+			})
+			if err != nil {
+				return err
+			}
+			locks = append(locks, lock)
+		}
+		return nil
+	})
+	return locks, err
+}
+
+// ShareLocks returns the user's locks, one per symbol ever tokenized.
+func (u *UserHandler) ShareLocks(userAccountId string) ([]ShareLock, error) {
+	return listShareLocks(u.DB, shareLockPrefix+userAccountId+":")
+}
+
+// lockedSymbols returns the symbols in which the user has shares backing tokens.
+func lockedSymbols(db *badger.DB, userAccountId string) ([]string, error) {
+	locks, err := listShareLocks(db, shareLockPrefix+userAccountId+":")
+	if err != nil {
+		return nil, err
+	}
+	symbols := []string{}
+	for _, lock := range locks {
+		if lock.Units > 0 {
+			symbols = append(symbols, lock.Symbol)
+		}
+	}
+	return symbols, nil
+}
+
+// ShareLockMonitor checks every Interval that each user's brokerage position still covers the
+// shares locked behind their tokens, and escalates shortfalls. Brokerages that can lock
+// shares natively are kept in step with the locks.
+type ShareLockMonitor struct {
+	Users       *UserHandler
+	Interval    time.Duration
+	FreezeAfter time.Duration
+	WipeAfter   time.Duration
+}
+
+func NewShareLockMonitor(users *UserHandler) *ShareLockMonitor {
+	m := &ShareLockMonitor{
+		Users:       users,
+		Interval:    defaultShareLockInterval,
+		FreezeAfter: defaultShareLockFreezeAfter,
+		WipeAfter:   defaultShareLockWipeAfter,
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SHARE_LOCK_INTERVAL")); err == nil {
+		m.Interval = interval
+	}
+	if freezeAfter, err := time.ParseDuration(os.Getenv("SHARE_LOCK_FREEZE_AFTER")); err == nil {
+		m.FreezeAfter = freezeAfter
+	}
+	if wipeAfter, err := time.ParseDuration(os.Getenv("SHARE_LOCK_WIPE_AFTER")); err == nil {
+		m.WipeAfter = wipeAfter
+	}
+	return m
+}
+
+// heldShares returns the shares of symbol in the user's brokerage account. Without a linked
+// account or attested holdings the position is unknown rather than empty, so it is an error
+// instead of a shortfall that would freeze and wipe the user's tokens.
+func (m *ShareLockMonitor) heldShares(lock ShareLock) (decimal.Decimal, error) {
+	brokerage, err := m.Users.brokerage(lock.UserAccountId)
+	if errors.Is(err, ErrBrokerageNotLinked) {
+		return decimal.Zero, fmt.Errorf("%w: %v", errPositionUnknown, err)
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+	position, err := brokerage.Position(lock.Symbol)
+	if errors.Is(err, ErrHoldingsNotAttested) {
+		return decimal.Zero, fmt.Errorf("%w: %v", errPositionUnknown, err)
+	}
+	if errors.Is(err, ErrPositionNotFound) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+	locked, _ := decimal.NewFromString(lock.Shares)
+	err = syncNativeLock(brokerage, position, decimal.Min(locked, position.Qty))
+	if err != nil {
+		fmt.Println("Error syncing share lock of ", lock.UserAccountId, " ", lock.Symbol, ": ", err)
+	}
+	return position.Qty, nil
+}
+
+// syncNativeLock sets the shares the brokerage itself locks to shares.
+func syncNativeLock(brokerage Brokerage, position BrokeragePosition, shares decimal.Decimal) error {
+	var err error
+	switch delta := shares.Sub(position.Locked); {
+	case delta.IsPositive():
+		err = brokerage.LockShares(position.Symbol, delta)
+	case delta.IsNegative():
+		err = brokerage.UnlockShares(position.Symbol, delta.Neg())
+	}
+	if errors.Is(err, ErrBrokerageUnsupported) {
+		return nil
+	}
+	return err
+}
+
+func (m *ShareLockMonitor) put(lock ShareLock) error {
+	return m.Users.DB.Update(func(txn *badger.Txn) error {
+		return putShareLock(txn, lock)
+	})
+}
+
+// Check compares one lock with the brokerage position and escalates or clears a shortfall.
+func (m *ShareLockMonitor) Check(lock *ShareLock) error {
+	asset, err := m.Users.Assets.Get(lock.Symbol)
+	if err != nil {
+		return err
+	}
+	if lock.Wipe != nil {
+		return m.settleWipe(lock, asset)
+	}
+	held, err := m.heldShares(*lock)
+	if errors.Is(err, errPositionUnknown) {
+		// the lock stays as it was until the position is known again
+		lock.Error = err.Error()
+		_ = m.put(*lock)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	lock.HeldShares = held.String()
+	lock.CheckedAt = now.Unix()
+	lock.Error = ""
+	shortfall := asset.Shares(lock.Units).Sub(held)
+	if !shortfall.IsPositive() {
+		if lock.Status == ShareLockFrozen {
+			err = m.Users.unfreeze(lock.UserAccountId, lock.TokenId)
+			if err != nil {
+				return err
+			}
+		}
+		lock.Status = ShareLockOk
+		lock.ShortfallShares = ""
+		lock.ShortfallSince = 0
+		return m.put(*lock)
+	}
+
+	lock.ShortfallShares = shortfall.String()
+	if lock.Status == ShareLockOk {
+		fmt.Printf("Share lock alert: %s holds %s of %s locked shares of %s\n", lock.UserAccountId, held, lock.Shares, lock.Symbol)
+		lock.Status = ShareLockFlagged
+		lock.ShortfallSince = now.Unix()
+	}
+	since := now.Sub(time.Unix(lock.ShortfallSince, 0))
+	if lock.Status == ShareLockFlagged && since >= m.FreezeAfter {
+		err = m.Users.freeze(lock.UserAccountId, lock.TokenId)
+		if err != nil {
+			return err
+		}
+		lock.Status = ShareLockFrozen
+	}
+	if lock.Status == ShareLockFrozen && since >= m.WipeAfter {
+		return m.wipeShortfall(lock, asset, shortfall)
+	}
+	return m.put(*lock)
+}
+
+// wipeShortfall wipes the units the shortfall leaves unbacked from the user's wallet. Units
+// the user has moved elsewhere, such as lending collateral, stay frozen.
+func (m *ShareLockMonitor) wipeShortfall(lock *ShareLock, asset AssetRecord, shortfall decimal.Decimal) error {
+	balance, err := accountTokenBalance(lock.UserAccountId, lock.TokenId)
+	if err != nil {
+		return err
+	}
+	units := min(shortfall.Shift(int32(asset.Decimals)).Ceil().IntPart(), balance, lock.Units)
+	if units <= 0 {
+		return m.put(*lock)
+	}
+	lock.Wipe = &WorkflowStep{Name: StepWipe, Status: StepPending}
+	lock.WipeUnits = units
+	err = m.put(*lock)
+	if err != nil {
+		return err
+	}
+	return m.settleWipe(lock, asset)
+}
+
+// settleWipe runs the wipe in flight to its end. Hedera refuses to wipe a frozen account, so
+// the account is unfrozen right before the wipe is submitted and frozen again if the wipe
+// fails, to be tried again on the next check; it stays unfrozen only once the wipe settled.
+// A wipe that succeeded comes off the lock and the user's profile, and the lock is flagged
+// again so a remaining shortfall is frozen on the next check.
+func (m *ShareLockMonitor) settleWipe(lock *ShareLock, asset AssetRecord) error {
+	put := func() error {
+		return m.put(*lock)
+	}
+	wipe := lock.Wipe
+	switch wipe.Status {
+	case StepPending:
+		err := m.Users.unfreeze(lock.UserAccountId, lock.TokenId)
+		if err != nil {
+			return err
+		}
+		err = runStep(wipe, put, func(transactionId hiero.TransactionID) error {
+			return m.Users.wipe(lock.UserAccountId, lock.TokenId, lock.WipeUnits, transactionId)
+		})
+		if err != nil && wipe.Status == StepSubmitted {
+			// the wipe may still reach consensus, so the next check settles it
+			lock.Error = err.Error()
+			_ = put()
+			return err
+		}
+	case StepSubmitted:
+		succeeded, err := settle(wipe)
+		if err != nil {
+			return err
+		}
+		wipe.Status = StepPending
+		if succeeded {
+			wipe.Status = StepDone
+			wipe.CompletedAt = time.Now().Format(time.RFC3339)
+		}
+	}
+	if wipe.Status != StepDone {
+		err := m.Users.freeze(lock.UserAccountId, lock.TokenId)
+		if err != nil {
+			return err
+		}
+		lock.Error = "wipe " + wipe.TransactionId + " failed: " + wipe.Error
+		lock.Wipe = nil
+		lock.WipeUnits = 0
+		lock.Status = ShareLockFrozen
+		return put()
+	}
+
+	if lock.Record == nil {
+		lock.Units -= lock.WipeUnits
+		lock.Shares = asset.Shares(lock.Units).String()
+		lock.WipedUnits += lock.WipeUnits
+		lock.Status = ShareLockFlagged
+		lock.Error = ""
+		lock.Record = &WorkflowStep{Name: StepRecord, Status: StepPending}
+		fmt.Printf("Wiped %d units of %s from %s for unbacked shares\n", lock.WipeUnits, lock.Symbol, lock.UserAccountId)
+	}
+	units := lock.WipeUnits
+	err := runStep(lock.Record, put, func(transactionId hiero.TransactionID) error {
+		return m.Users.recordTokenizedAsset(lock.UserAccountId, asset, asset.Shares(units).Neg(), -units, "Tokenized asset wiped for unbacked shares", transactionId)
+	})
+	if err != nil {
+		lock.Error = err.Error()
+		_ = put()
+		return err
+	}
+	lock.Wipe = nil
+	lock.WipeUnits = 0
+	lock.Record = nil
+	return put()
+}
+
+// CheckPosition checks the user's lock on symbol now, as when their position has changed.
+func (m *ShareLockMonitor) CheckPosition(userAccountId, symbol string) error {
+	asset, err := m.Users.Assets.Get(symbol)
+	if err != nil {
+		return err
+	}
+	tokenizeMu.Lock()
+	defer tokenizeMu.Unlock()
+	var lock ShareLock
+	err = m.Users.DB.View(func(txn *badger.Txn) error {
+		lock, err = getShareLock(txn, userAccountId, asset)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if lock.Units == 0 && lock.Status == ShareLockOk && lock.Wipe == nil {
+		return nil
+	}
+	return m.Check(&lock)
+}
+
+// CheckAll checks every lock that backs tokens or has a shortfall to resolve.
+func (m *ShareLockMonitor) CheckAll() error {
+	locks, err := listShareLocks(m.Users.DB, shareLockPrefix)
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		if lock.Units == 0 && lock.Status == ShareLockOk && lock.Wipe == nil {
+			continue
+		}
+		tokenizeMu.Lock()
+		err := m.Check(&lock)
+		tokenizeMu.Unlock()
+		if err != nil && !errors.Is(err, errStepInFlight) {
+			fmt.Println("Error checking share lock of ", lock.UserAccountId, " ", lock.Symbol, ": ", err)
+		}
+	}
+	return nil
+}
+
+func (m *ShareLockMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		err := m.CheckAll()
+		if err != nil {
+			fmt.Println("Error checking share locks: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleListShareLocks lists every lock, or those in ?status=.
+func (m *ShareLockMonitor) HandleListShareLocks(w http.ResponseWriter, r *http.Request) {
+	locks, err := listShareLocks(m.Users.DB, shareLockPrefix)
+	if err != nil {
+		fmt.Println("Error listing share locks: ", err)
+		http.Error(w, "Failed to list share locks", http.StatusInternalServerError)
+		return
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filtered := []ShareLock{}
+		for _, lock := range locks {
+			if lock.Status == status {
+				filtered = append(filtered, lock)
+			}
+		}
+		locks = filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]ShareLock{
+		"shareLocks": locks,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode share locks", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserHandler) freeze(userAccountId, assetTokenId string) error {
+	tokenId, err := hiero.TokenIDFromString(assetTokenId)
+	if err != nil {
+		return err
+	}
+	accountId, err := hiero.AccountIDFromString(userAccountId)
+	if err != nil {
+		return err
+	}
+	freezeKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTokenFreezeTransaction().
+		SetTokenID(tokenId).
+		SetAccountID(accountId).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(freezeKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	receipt, err := txResponse.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The freeze transaction consensus status is %v\n", receipt.Status)
+	return nil
+}
+
+func (u *UserHandler) unfreeze(userAccountId, assetTokenId string) error {
+	tokenId, err := hiero.TokenIDFromString(assetTokenId)
+	if err != nil {
+		return err
+	}
+	accountId, err := hiero.AccountIDFromString(userAccountId)
+	if err != nil {
+		return err
+	}
+	freezeKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTokenUnfreezeTransaction().
+		SetTokenID(tokenId).
+		SetAccountID(accountId).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(freezeKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	receipt, err := txResponse.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The unfreeze transaction consensus status is %v\n", receipt.Status)
+	return nil
+}
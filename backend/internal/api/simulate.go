@@ -0,0 +1,379 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+const simulationDryRunGas = 1_000_000
+
+// errNoOraclePrice means the market's oracle reports no price, so no collateral value or
+// health can be computed.
+var errNoOraclePrice = errors.New("oracle reports no price for the collateral")
+
+type SimulationRequest struct {
+	Action        string `json:"action"`
+	Amount        string `json:"amount"`
+	UserAccountId string `json:"userAccountId"`
+	DryRun        bool   `json:"dryRun"`
+}
+
+type SimulationDryRun struct {
+	Success bool   `json:"success"`
+	GasUsed uint64 `json:"gasUsed"`
+	Error   string `json:"error,omitempty"`
+}
+
+type SimulationResult struct {
+	MarketId         string            `json:"marketId"`
+	Action           string            `json:"action"`
+	Amount           *big.Int          `json:"amount"`
+	Before           UserPosition      `json:"before"`
+	After            UserPosition      `json:"after"`
+	MaxSafeAmount    *big.Int          `json:"maxSafeAmount,omitempty"`
+	RevertsLLTV      bool              `json:"revertsLltv"`
+	RevertsLiquidity bool              `json:"revertsLiquidity"`
+	RevertReason     string            `json:"revertReason,omitempty"`
+	Session          string            `json:"session"`
+	SessionBufferBps uint64            `json:"sessionBufferBps,omitempty"`
+	BorrowsPaused    bool              `json:"borrowsPaused,omitempty"`
+	DryRun           *SimulationDryRun `json:"dryRun,omitempty"`
+	AccruedAt        int64             `json:"accruedAt"`
+}
+
+// rawPosition is a position as the pool stores it.
+type rawPosition struct {
+	SupplyShares *big.Int
+	BorrowShares *big.Int
+	Collateral   *big.Int
+}
+
+// parseTokenAmount converts a human-readable amount into the token's smallest unit,
+// truncating anything past its decimals.
+func parseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	value, ok := new(big.Float).SetPrec(256).SetString(amount)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	scale := new(big.Float).SetPrec(256).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	raw, _ := value.Mul(value, scale).Int(nil)
+	if raw.Sign() == 0 {
+		return nil, fmt.Errorf("amount %q is below the token's precision", amount)
+	}
+	return raw, nil
+}
+
+// isHealthy mirrors Morpho's _isHealthy: the debt must fit under collateral value * lltv.
+func isHealthy(position rawPosition, market MarketPosition, price, lltv *big.Int) bool {
+	if position.BorrowShares.Sign() == 0 {
+		return true
+	}
+	borrowed := toAssetsUp(position.BorrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+	maxBorrow := wMulDown(mulDivDown(position.Collateral, price, oraclePriceScale), lltv)
+	return maxBorrow.Cmp(borrowed) >= 0
+}
+
+func minBig(x, y *big.Int) *big.Int {
+	if x.Cmp(y) < 0 {
+		return new(big.Int).Set(x)
+	}
+	return new(big.Int).Set(y)
+}
+
+func nonNegative(x *big.Int) *big.Int {
+	if x.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return x
+}
+
+// simulateAction applies an action to a copy of the position and the accrued market the way
+// the pool would, filling in the resulting position, the revert flags and the largest safe
+// amount of the action. supply adds loan assets to the market; supplyCollateral posts
+// collateral. balance is the user's wallet balance of the token supply, supplyCollateral and
+// repay spend, which caps their safe amounts. The safe amounts for borrow and
+// withdrawCollateral keep SessionBufferBps of health above what the LLTV requires. The
+// revert reason is the first check the action fails, as the pool would revert on it.
+func simulateAction(result *SimulationResult, position rawPosition, market MarketPosition, price, lltv, balance *big.Int) (rawPosition, MarketPosition, error) {
+	if price == nil || price.Sign() <= 0 {
+		return rawPosition{}, MarketPosition{}, errNoOraclePrice
+	}
+	after := rawPosition{
+		SupplyShares: new(big.Int).Set(position.SupplyShares),
+		BorrowShares: new(big.Int).Set(position.BorrowShares),
+		Collateral:   new(big.Int).Set(position.Collateral),
+	}
+	next := MarketPosition{
+		TotalSupplyAssets: new(big.Int).Set(market.TotalSupplyAssets),
+		TotalSupplyShares: new(big.Int).Set(market.TotalSupplyShares),
+		TotalBorrowAssets: new(big.Int).Set(market.TotalBorrowAssets),
+		TotalBorrowShares: new(big.Int).Set(market.TotalBorrowShares),
+		LastUpdate:        market.LastUpdate,
+		Fee:               market.Fee,
+	}
+	amount := result.Amount
+	debt := toAssetsUp(position.BorrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
+	safeLltv := mulDivDown(lltv, big.NewInt(int64(10_000-result.SessionBufferBps)), big.NewInt(10_000))
+	maxBorrow := wMulDown(mulDivDown(position.Collateral, price, oraclePriceScale), safeLltv)
+	liquidity := new(big.Int).Sub(market.TotalSupplyAssets, market.TotalBorrowAssets)
+	revert := func(reason string) {
+		if result.RevertReason == "" {
+			result.RevertReason = reason
+		}
+	}
+
+	switch result.Action {
+	case "supply":
+		result.MaxSafeAmount = new(big.Int).Set(balance)
+		if amount.Cmp(balance) > 0 {
+			revert("insufficient balance")
+		}
+		shares := toSharesDown(amount, market.TotalSupplyAssets, market.TotalSupplyShares)
+		after.SupplyShares.Add(after.SupplyShares, shares)
+		next.TotalSupplyShares.Add(next.TotalSupplyShares, shares)
+		next.TotalSupplyAssets.Add(next.TotalSupplyAssets, amount)
+	case "supplyCollateral":
+		result.MaxSafeAmount = new(big.Int).Set(balance)
+		if amount.Cmp(balance) > 0 {
+			revert("insufficient balance")
+		}
+		after.Collateral.Add(after.Collateral, amount)
+	case "borrow":
+		shares := toSharesUp(amount, market.TotalBorrowAssets, market.TotalBorrowShares)
+		after.BorrowShares.Add(after.BorrowShares, shares)
+		next.TotalBorrowShares.Add(next.TotalBorrowShares, shares)
+		next.TotalBorrowAssets.Add(next.TotalBorrowAssets, amount)
+		result.MaxSafeAmount = nonNegative(minBig(new(big.Int).Sub(maxBorrow, debt), liquidity))
+		if result.BorrowsPaused {
+			result.MaxSafeAmount = big.NewInt(0)
+			revert("borrows are paused while the collateral's market is closed")
+		}
+		if !isHealthy(after, next, price, lltv) {
+			result.RevertsLLTV = true
+			revert("insufficient collateral")
+		}
+		if next.TotalBorrowAssets.Cmp(next.TotalSupplyAssets) > 0 {
+			result.RevertsLiquidity = true
+			revert("insufficient liquidity")
+		}
+	case "repay":
+		shares := toSharesDown(amount, market.TotalBorrowAssets, market.TotalBorrowShares)
+		result.MaxSafeAmount = minBig(debt, balance)
+		if shares.Cmp(position.BorrowShares) > 0 {
+			revert("repay exceeds debt")
+			break
+		}
+		if amount.Cmp(balance) > 0 {
+			revert("insufficient balance")
+		}
+		after.BorrowShares.Sub(after.BorrowShares, shares)
+		next.TotalBorrowShares.Sub(next.TotalBorrowShares, shares)
+		next.TotalBorrowAssets = nonNegative(next.TotalBorrowAssets.Sub(next.TotalBorrowAssets, amount))
+	case "withdrawCollateral":
+		result.MaxSafeAmount = new(big.Int).Set(position.Collateral)
+		if debt.Sign() > 0 {
+			required := mulDivUp(wDivUp(debt, safeLltv), oraclePriceScale, price)
+			result.MaxSafeAmount = nonNegative(new(big.Int).Sub(position.Collateral, required))
+		}
+		if amount.Cmp(position.Collateral) > 0 {
+			revert("withdrawal exceeds collateral")
+			break
+		}
+		after.Collateral.Sub(after.Collateral, amount)
+		if !isHealthy(after, next, price, lltv) {
+			result.RevertsLLTV = true
+			revert("insufficient collateral")
+		}
+	default:
+		return rawPosition{}, MarketPosition{}, fmt.Errorf("unknown action %q", result.Action)
+	}
+	return after, next, nil
+}
+
+// dryRunPool runs a state-changing pool call as a ContractCallQuery from the user's account,
+// so the node executes it against current state without submitting a transaction.
+func dryRunPool(sender hiero.AccountID, method string, args ...interface{}) SimulationDryRun {
+	contractABI, err := loadPoolABI()
+	if err != nil {
+		return SimulationDryRun{Error: err.Error()}
+	}
+	calldata, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return SimulationDryRun{Error: err.Error()}
+	}
+	contractId, err := hiero.ContractIDFromString(LendingPoolContractId)
+	if err != nil {
+		return SimulationDryRun{Error: err.Error()}
+	}
+	client, err := newOperatorClient()
+	if err != nil {
+		return SimulationDryRun{Error: err.Error()}
+	}
+	defer client.Close()
+
+	result, err := hiero.NewContractCallQuery().
+		SetContractID(contractId).
+		SetSenderID(sender).
+		SetGas(simulationDryRunGas).
+		SetFunctionParameters(calldata).
+		Execute(client)
+	if err != nil {
+		return SimulationDryRun{GasUsed: result.GasUsed, Error: err.Error()}
+	}
+	if result.ErrorMessage != "" {
+		return SimulationDryRun{GasUsed: result.GasUsed, Error: result.ErrorMessage}
+	}
+	return SimulationDryRun{Success: true, GasUsed: result.GasUsed}
+}
+
+// walletBalance is an account's balance of an HTS token, in its smallest unit.
+func walletBalance(accountId string, token common.Address) (*big.Int, error) {
+	tokenId, err := evmTokenId(token)
+	if err != nil {
+		return nil, err
+	}
+	relationship, _, err := tokenRelationship(accountId, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(relationship.Balance), nil
+}
+
+func senderAccountId(userAccountId, evmAddress string) (hiero.AccountID, error) {
+	if !strings.HasPrefix(userAccountId, "0x") {
+		return hiero.AccountIDFromString(userAccountId)
+	}
+	return hiero.AccountIDFromEvmAddress(0, 0, strings.TrimPrefix(evmAddress, "0x"))
+}
+
+// HandleSimulate answers what an action would do to the user's position before they sign it.
+func (l *LoansHandler) HandleSimulate(w http.ResponseWriter, r *http.Request) {
+	record, ok := l.requestMarket(w, r)
+	if !ok {
+		return
+	}
+	var request SimulationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Failed to decode simulation request", http.StatusBadRequest)
+		return
+	}
+	if request.UserAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	decimals := record.LoanDecimals
+	if request.Action == "supplyCollateral" || request.Action == "withdrawCollateral" {
+		decimals = record.CollateralDecimals
+	}
+	amount, err := parseTokenAmount(request.Amount, decimals)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	evmAddress, err := resolveEvmAddress(request.UserAccountId)
+	if err != nil {
+		fmt.Println("Error resolving user address: ", err)
+		http.Error(w, "Failed to resolve user address", http.StatusBadRequest)
+		return
+	}
+
+	marketState, err := getMarketState(record.MarketId)
+	if err != nil {
+		fmt.Println("Error getting market state: ", err)
+		http.Error(w, "Failed to get market state", http.StatusInternalServerError)
+		return
+	}
+	id, err := marketIdToBytes32(record.MarketId)
+	if err != nil {
+		http.Error(w, "Invalid market ID", http.StatusBadRequest)
+		return
+	}
+	user := common.HexToAddress(evmAddress)
+	var position rawPosition
+	err = callPool("position", &position, id, user)
+	if err != nil {
+		fmt.Println("Error getting user position: ", err)
+		http.Error(w, "Failed to get user position", http.StatusInternalServerError)
+		return
+	}
+	price, err := getOraclePrice(marketState.Params.Oracle)
+	if err != nil {
+		fmt.Println("Error getting oracle price: ", err)
+		http.Error(w, "Failed to get oracle price", http.StatusInternalServerError)
+		return
+	}
+
+	result := SimulationResult{
+		MarketId:  record.MarketId,
+		Action:    request.Action,
+		Amount:    amount,
+		Session:   l.Session.SymbolState(record.CollateralSymbol),
+		AccruedAt: marketState.AccruedAt,
+	}
+	result.SessionBufferBps, result.BorrowsPaused = l.Session.BorrowBufferBps(record.CollateralSymbol)
+	balance := big.NewInt(0)
+	switch request.Action {
+	case "supply", "repay":
+		balance, err = walletBalance(request.UserAccountId, marketState.Params.LoanToken)
+	case "supplyCollateral":
+		balance, err = walletBalance(request.UserAccountId, marketState.Params.CollateralToken)
+	}
+	if err != nil {
+		fmt.Println("Error getting wallet balance: ", err)
+		http.Error(w, "Failed to get wallet balance", http.StatusInternalServerError)
+		return
+	}
+	after, nextMarket, err := simulateAction(&result, position, marketState.Market, price, marketState.Params.Lltv, balance)
+	if errors.Is(err, errNoOraclePrice) {
+		http.Error(w, "Oracle reports no price for the collateral", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result.Before = newUserPosition(position.SupplyShares, position.BorrowShares, position.Collateral, marketState, price, record.CollateralDecimals)
+	nextState := marketState
+	nextState.Market = nextMarket
+	result.After = newUserPosition(after.SupplyShares, after.BorrowShares, after.Collateral, nextState, price, record.CollateralDecimals)
+
+	if request.DryRun {
+		sender, err := senderAccountId(request.UserAccountId, evmAddress)
+		if err != nil {
+			http.Error(w, "Failed to resolve user account", http.StatusBadRequest)
+			return
+		}
+		var dryRun SimulationDryRun
+		switch request.Action {
+		case "supply":
+			dryRun = dryRunPool(sender, "supply", marketState.Params, amount, big.NewInt(0), user, []byte{})
+		case "supplyCollateral":
+			dryRun = dryRunPool(sender, "supplyCollateral", marketState.Params, amount, user, []byte{})
+		case "borrow":
+			dryRun = dryRunPool(sender, "borrow", marketState.Params, amount, big.NewInt(0), user, user)
+		case "repay":
+			dryRun = dryRunPool(sender, "repay", marketState.Params, amount, big.NewInt(0), user, []byte{})
+		case "withdrawCollateral":
+			dryRun = dryRunPool(sender, "withdrawCollateral", marketState.Params, amount, user, user)
+		}
+		result.DryRun = &dryRun
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]SimulationResult{
+		"simulation": result,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode simulation", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestSimulateAction(t *testing.T) {
+	// one collateral unit is worth one loan unit
+	price := new(big.Int).Set(oraclePriceScale)
+	lltv := big.NewInt(8e17)
+	market := func() MarketPosition {
+		return MarketPosition{
+			TotalSupplyAssets: big.NewInt(1000),
+			TotalSupplyShares: big.NewInt(1000 * 1e6),
+			TotalBorrowAssets: big.NewInt(0),
+			TotalBorrowShares: big.NewInt(0),
+			LastUpdate:        big.NewInt(0),
+			Fee:               big.NewInt(0),
+		}
+	}
+	position := func(collateral int64) rawPosition {
+		return rawPosition{SupplyShares: big.NewInt(0), BorrowShares: big.NewInt(0), Collateral: big.NewInt(collateral)}
+	}
+
+	tests := []struct {
+		name          string
+		result        SimulationResult
+		collateral    int64
+		balance       int64
+		wantReason    string
+		wantMaxSafe   int64
+		wantLltv      bool
+		wantLiquidity bool
+	}{
+		{
+			name:        "supply within balance",
+			result:      SimulationResult{Action: "supply", Amount: big.NewInt(20)},
+			balance:     30,
+			wantMaxSafe: 30,
+		},
+		{
+			name:        "supply beyond balance",
+			result:      SimulationResult{Action: "supply", Amount: big.NewInt(50)},
+			balance:     30,
+			wantReason:  "insufficient balance",
+			wantMaxSafe: 30,
+		},
+		{
+			name:        "supplyCollateral beyond balance",
+			result:      SimulationResult{Action: "supplyCollateral", Amount: big.NewInt(50)},
+			balance:     10,
+			wantReason:  "insufficient balance",
+			wantMaxSafe: 10,
+		},
+		{
+			name:        "paused borrow keeps the first reason",
+			result:      SimulationResult{Action: "borrow", Amount: big.NewInt(500), BorrowsPaused: true},
+			collateral:  100,
+			wantReason:  "borrows are paused while the collateral's market is closed",
+			wantMaxSafe: 0,
+			wantLltv:    true,
+		},
+		{
+			name:          "unhealthy and illiquid borrow",
+			result:        SimulationResult{Action: "borrow", Amount: big.NewInt(2000)},
+			collateral:    100,
+			wantReason:    "insufficient collateral",
+			wantMaxSafe:   80,
+			wantLltv:      true,
+			wantLiquidity: true,
+		},
+		{
+			name:          "illiquid borrow",
+			result:        SimulationResult{Action: "borrow", Amount: big.NewInt(2000)},
+			collateral:    10000,
+			wantReason:    "insufficient liquidity",
+			wantMaxSafe:   1000,
+			wantLiquidity: true,
+		},
+		{
+			name:        "withdraw without debt",
+			result:      SimulationResult{Action: "withdrawCollateral", Amount: big.NewInt(40)},
+			collateral:  100,
+			wantMaxSafe: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			_, _, err := simulateAction(&result, position(tt.collateral), market(), price, lltv, big.NewInt(tt.balance))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.RevertReason != tt.wantReason {
+				t.Errorf("RevertReason = %q, want %q", result.RevertReason, tt.wantReason)
+			}
+			if result.MaxSafeAmount == nil || result.MaxSafeAmount.Int64() != tt.wantMaxSafe {
+				t.Errorf("MaxSafeAmount = %v, want %d", result.MaxSafeAmount, tt.wantMaxSafe)
+			}
+			if result.RevertsLLTV != tt.wantLltv || result.RevertsLiquidity != tt.wantLiquidity {
+				t.Errorf("reverts LLTV %v, liquidity %v, want %v, %v", result.RevertsLLTV, result.RevertsLiquidity, tt.wantLltv, tt.wantLiquidity)
+			}
+		})
+	}
+}
+
+func TestSimulateActionWithoutPrice(t *testing.T) {
+	position := rawPosition{SupplyShares: big.NewInt(0), BorrowShares: big.NewInt(1e6), Collateral: big.NewInt(100)}
+	market := MarketPosition{
+		TotalSupplyAssets: big.NewInt(1000),
+		TotalSupplyShares: big.NewInt(1000 * 1e6),
+		TotalBorrowAssets: big.NewInt(1),
+		TotalBorrowShares: big.NewInt(1e6),
+		LastUpdate:        big.NewInt(0),
+		Fee:               big.NewInt(0),
+	}
+	for _, price := range []*big.Int{nil, big.NewInt(0)} {
+		result := SimulationResult{Action: "withdrawCollateral", Amount: big.NewInt(10)}
+		_, _, err := simulateAction(&result, position, market, price, big.NewInt(8e17), big.NewInt(0))
+		if !errors.Is(err, errNoOraclePrice) {
+			t.Errorf("price %v: err = %v, want errNoOraclePrice", price, err)
+		}
+	}
+}
@@ -1 +1,352 @@
-package api
\ No newline at end of file
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+)
+
+const stocksCachePrefix = "stocks:"
+
+var (
+	defaultStocksCatalogTTL = time.Hour
+	defaultStocksQuoteTTL   = 15 * time.Second
+	stockSymbolPattern      = regexp.MustCompile(`^[A-Z]{1,5}(\.[A-Z]{1,2})?$`)
+	barTimeframes           = map[string]marketdata.TimeFrame{
+		"1Min":  marketdata.OneMin,
+		"5Min":  marketdata.NewTimeFrame(5, marketdata.Min),
+		"15Min": marketdata.NewTimeFrame(15, marketdata.Min),
+		"1H":    marketdata.OneHour,
+		"1D":    marketdata.OneDay,
+	}
+	// the window bars cover when no start is given
+	defaultBarsSpan = map[string]time.Duration{
+		"1Min":  24 * time.Hour,
+		"5Min":  5 * 24 * time.Hour,
+		"15Min": 10 * 24 * time.Hour,
+		"1H":    30 * 24 * time.Hour,
+		"1D":    365 * 24 * time.Hour,
+	}
+)
+
+// StockListing is a stock the backend tokenizes, as Alpaca lists it.
+type StockListing struct {
+	Symbol       string `json:"symbol"`
+	Name         string `json:"name"`
+	Exchange     string `json:"exchange"`
+	Fractionable bool   `json:"fractionable"`
+	TokenId      string `json:"tokenId"`
+	TokenSymbol  string `json:"tokenSymbol"`
+}
+
+// StockBar is one IEX bar starting at T, a unix time in seconds.
+type StockBar struct {
+	T      int64   `json:"t"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume uint64  `json:"volume"`
+}
+
+// StocksHandler serves the catalog, quotes and bars of the stocks open for tokenization.
+// Responses are cached in badger: the catalog for CatalogTTL, quotes for QuoteTTL and bars
+// for as long as their timeframe takes to gain a bar.
+type StocksHandler struct {
+	DB         *badger.DB
+	Alpaca     *alpaca.Client
+	MarketData *marketdata.Client
+	Assets     *AssetRegistry
+	CatalogTTL time.Duration
+	QuoteTTL   time.Duration
+}
+
+func NewStocksHandler(db *badger.DB, alpacaClient *alpaca.Client, marketData *marketdata.Client, assets *AssetRegistry) *StocksHandler {
+	s := &StocksHandler{
+		DB:         db,
+		Alpaca:     alpacaClient,
+		MarketData: marketData,
+		Assets:     assets,
+		CatalogTTL: defaultStocksCatalogTTL,
+		QuoteTTL:   defaultStocksQuoteTTL,
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("STOCKS_CATALOG_TTL")); err == nil {
+		s.CatalogTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("STOCKS_QUOTE_TTL")); err == nil {
+		s.QuoteTTL = ttl
+	}
+	return s
+}
+
+// allowedStocks are the assets open for tokenization, keyed by symbol.
+func (s *StocksHandler) allowedStocks() (map[string]AssetRecord, error) {
+	assets, err := s.Assets.List()
+	if err != nil {
+		return nil, err
+	}
+	allowed := map[string]AssetRecord{}
+	for _, asset := range assets {
+		if asset.Enabled && asset.TokenId != "" {
+			allowed[asset.Symbol] = asset
+		}
+	}
+	return allowed, nil
+}
+
+// Catalog lists the allowed stocks Alpaca has active and tradable. It is cached per set of
+// allowed symbols, so enabling an asset shows up without waiting for the cache to expire.
+func (s *StocksHandler) Catalog() ([]StockListing, error) {
+	allowed, err := s.allowedStocks()
+	if err != nil {
+		return nil, err
+	}
+	symbols := []string{}
+	for symbol := range allowed {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+	key := stocksCachePrefix + "catalog:" + strings.Join(symbols, ",")
+	var listings []StockListing
+	cached, err := getCached(s.DB, key, &listings)
+	if err != nil || cached {
+		return listings, err
+	}
+
+	alpacaAssets, err := s.Alpaca.GetAssets(alpaca.GetAssetsRequest{
+		Status:     string(alpaca.AssetActive),
+		AssetClass: string(alpaca.USEquity),
+	})
+	if err != nil {
+		return nil, err
+	}
+	listings = []StockListing{}
+	for _, alpacaAsset := range alpacaAssets {
+		asset, ok := allowed[alpacaAsset.Symbol]
+		if !ok || !alpacaAsset.Tradable {
+			continue
+		}
+		listings = append(listings, StockListing{
+			Symbol:       alpacaAsset.Symbol,
+			Name:         alpacaAsset.Name,
+			Exchange:     alpacaAsset.Exchange,
+			Fractionable: alpacaAsset.Fractionable,
+			TokenId:      asset.TokenId,
+			TokenSymbol:  asset.TokenSymbol,
+		})
+	}
+	slices.SortFunc(listings, func(a, b StockListing) int {
+		return strings.Compare(a.Symbol, b.Symbol)
+	})
+	setCached(s.DB, key, listings, s.CatalogTTL)
+	return listings, nil
+}
+
+// requestSymbol reads the symbol path parameter, writing the error response and returning
+// false when it is malformed or not open for tokenization.
+func (s *StocksHandler) requestSymbol(w http.ResponseWriter, r *http.Request) (string, bool) {
+	symbol := normalizeSymbol(chi.URLParam(r, "symbol"))
+	if !stockSymbolPattern.MatchString(symbol) {
+		http.Error(w, "Invalid stock symbol", http.StatusBadRequest)
+		return "", false
+	}
+	allowed, err := s.allowedStocks()
+	if err != nil {
+		fmt.Println("Error listing assets: ", err)
+		http.Error(w, "Failed to list assets", http.StatusInternalServerError)
+		return "", false
+	}
+	if _, ok := allowed[symbol]; !ok {
+		http.Error(w, "Stock not available", http.StatusNotFound)
+		return "", false
+	}
+	return symbol, true
+}
+
+// Quote is the latest quote of symbol.
+func (s *StocksHandler) Quote(symbol string) (Quote, error) {
+	key := stocksCachePrefix + "quote:" + symbol
+	var quote Quote
+	cached, err := getCached(s.DB, key, &quote)
+	if err != nil || cached {
+		return quote, err
+	}
+	quote, err = latestQuote(s.MarketData, symbol)
+	if err != nil {
+		return Quote{}, err
+	}
+	setCached(s.DB, key, quote, s.QuoteTTL)
+	return quote, nil
+}
+
+// BarsRequest covers Start to End, and the timeframe's default span up to now when both are
+// zero.
+type BarsRequest struct {
+	Timeframe string
+	Start     time.Time
+	End       time.Time
+}
+
+// parseBarsRequest reads timeframe, start and end. Intraday timeframes cover at most 30 days.
+func parseBarsRequest(r *http.Request) (BarsRequest, error) {
+	query := r.URL.Query()
+	request := BarsRequest{Timeframe: query.Get("timeframe")}
+	if request.Timeframe == "" {
+		request.Timeframe = "1D"
+	}
+	if _, ok := barTimeframes[request.Timeframe]; !ok {
+		return request, errors.New("timeframe must be one of 1Min, 5Min, 15Min, 1H or 1D")
+	}
+	var err error
+	if start := query.Get("start"); start != "" {
+		request.Start, err = parseHistoryTime(start)
+		if err != nil {
+			return request, errors.New("start must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if end := query.Get("end"); end != "" {
+		request.End, err = parseHistoryTime(end)
+		if err != nil {
+			return request, errors.New("end must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		if request.Start.IsZero() {
+			return request, errors.New("end needs a start")
+		}
+	}
+	if request.Start.IsZero() {
+		return request, nil
+	}
+	end := request.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if !request.Start.Before(end) {
+		return request, errors.New("start must be before end")
+	}
+	if request.Timeframe != "1D" && end.Sub(request.Start) > maxIntradayHistory {
+		return request, errors.New("intraday timeframes cover at most 30 days")
+	}
+	return request, nil
+}
+
+// Bars returns the IEX bars of symbol.
+func (s *StocksHandler) Bars(symbol string, request BarsRequest) ([]StockBar, error) {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return fmt.Sprint(t.Unix())
+	}
+	key := fmt.Sprintf("%sbars:%s:%s:%s:%s", stocksCachePrefix, symbol, request.Timeframe, format(request.Start), format(request.End))
+	var bars []StockBar
+	cached, err := getCached(s.DB, key, &bars)
+	if err != nil || cached {
+		return bars, err
+	}
+
+	start := request.Start
+	if start.IsZero() {
+		start = time.Now().Add(-defaultBarsSpan[request.Timeframe])
+	}
+	alpacaBars, err := s.MarketData.GetBars(symbol, marketdata.GetBarsRequest{
+		TimeFrame: barTimeframes[request.Timeframe],
+		Start:     start,
+		End:       request.End,
+		Feed:      marketdata.IEX,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bars = []StockBar{}
+	for _, bar := range alpacaBars {
+		bars = append(bars, StockBar{
+			T:      bar.Timestamp.Unix(),
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+		})
+	}
+	setCached(s.DB, key, bars, historyCacheTTL[request.Timeframe])
+	return bars, nil
+}
+
+func (s *StocksHandler) HandleListStocks(w http.ResponseWriter, r *http.Request) {
+	stocks, err := s.Catalog()
+	if err != nil {
+		fmt.Println("Error listing stocks: ", err)
+		http.Error(w, "Failed to list stocks", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]StockListing{
+		"stocks": stocks,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode stocks", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *StocksHandler) HandleGetQuote(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.requestSymbol(w, r)
+	if !ok {
+		return
+	}
+	quote, err := s.Quote(symbol)
+	if err != nil {
+		fmt.Println("Error getting quote: ", err)
+		http.Error(w, "Failed to get quote", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]Quote{
+		"quote": quote,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode quote", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetBars returns a stock's bars. See parseBarsRequest for the query parameters.
+func (s *StocksHandler) HandleGetBars(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.requestSymbol(w, r)
+	if !ok {
+		return
+	}
+	barsRequest, err := parseBarsRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bars, err := s.Bars(symbol, barsRequest)
+	if err != nil {
+		fmt.Println("Error getting bars: ", err)
+		http.Error(w, "Failed to get bars", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]StockBar{
+		"bars": bars,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode bars", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,429 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+)
+
+const (
+	StreamEventPrice       = "price"
+	StreamEventTradeUpdate = "trade_update"
+)
+
+var (
+	defaultStreamBackoff    = time.Second
+	defaultStreamMaxBackoff = time.Minute
+	defaultStreamRefresh    = time.Minute
+	streamHeartbeat         = 15 * time.Second
+	streamSubscriberBuffer  = 64
+	// streamed prices older than this are left to the REST API, so a dead stream is not
+	// mistaken for a quiet market
+	livePriceMaxAge = time.Minute
+)
+
+type livePriceEntry struct {
+	quote      Quote
+	receivedAt time.Time
+}
+
+// livePrices holds the latest streamed quote and trade of each symbol.
+var livePrices sync.Map
+
+func livePrice(symbol string) (Quote, bool) {
+	cached, ok := livePrices.Load(symbol)
+	if !ok {
+		return Quote{}, false
+	}
+	entry := cached.(livePriceEntry)
+	if entry.quote.LastPrice == 0 || time.Since(entry.receivedAt) > livePriceMaxAge {
+		return Quote{}, false
+	}
+	return entry.quote, true
+}
+
+func updateLivePrice(symbol string, update func(quote *Quote)) Quote {
+	entry := livePriceEntry{quote: Quote{Symbol: symbol}}
+	if cached, ok := livePrices.Load(symbol); ok {
+		entry = cached.(livePriceEntry)
+	}
+	update(&entry.quote)
+	entry.receivedAt = time.Now()
+	livePrices.Store(symbol, entry)
+	return entry.quote
+}
+
+// StreamEvent is a message fanned out to stream subscribers. Trade updates carry the user
+// whose account they belong to and reach only that user; prices reach everyone.
+type StreamEvent struct {
+	Type          string      `json:"type"`
+	UserAccountId string      `json:"userAccountId,omitempty"`
+	Symbol        string      `json:"symbol"`
+	Data          interface{} `json:"data"`
+	At            time.Time   `json:"at"`
+}
+
+type streamSubscriber struct {
+	userAccountId string
+	symbols       []string
+	events        chan StreamEvent
+}
+
+// StreamHub fans events out to subscribers. A subscriber that falls behind misses events
+// rather than holding up the others.
+type StreamHub struct {
+	Auth        *Authenticator
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]bool
+}
+
+func NewStreamHub(auth *Authenticator) *StreamHub {
+	return &StreamHub{Auth: auth, subscribers: map[*streamSubscriber]bool{}}
+}
+
+// Subscribe returns the events for userAccountId in symbols, every symbol when symbols is
+// empty, and a function that ends the subscription.
+func (h *StreamHub) Subscribe(userAccountId string, symbols []string) (<-chan StreamEvent, func()) {
+	subscriber := &streamSubscriber{
+		userAccountId: userAccountId,
+		symbols:       symbols,
+		events:        make(chan StreamEvent, streamSubscriberBuffer),
+	}
+	h.mu.Lock()
+	h.subscribers[subscriber] = true
+	h.mu.Unlock()
+	return subscriber.events, func() {
+		h.mu.Lock()
+		delete(h.subscribers, subscriber)
+		h.mu.Unlock()
+	}
+}
+
+func (h *StreamHub) Publish(event StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscriber := range h.subscribers {
+		if event.UserAccountId != "" && event.UserAccountId != subscriber.userAccountId {
+			continue
+		}
+		if len(subscriber.symbols) > 0 && !slices.Contains(subscriber.symbols, event.Symbol) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+		}
+	}
+}
+
+// HandleStream serves events over server-sent events: prices of ?symbols= (a comma-separated
+// list, every tokenized symbol when absent) and, for a signed-in user, their trade updates.
+// A ?userAccountId= must be the signed-in user. It starts with the latest price of each
+// symbol it has.
+func (h *StreamHub) HandleStream(w http.ResponseWriter, r *http.Request) {
+	userAccountId, err := h.Auth.SessionUser(r)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		fmt.Println("Error reading session: ", err)
+		http.Error(w, "Failed to read session", http.StatusInternalServerError)
+		return
+	}
+	if requested := r.URL.Query().Get("userAccountId"); requested != "" {
+		if userAccountId == "" {
+			http.Error(w, "Sign in first", http.StatusUnauthorized)
+			return
+		}
+		if requested != userAccountId {
+			http.Error(w, "Signed in as a different account", http.StatusForbidden)
+			return
+		}
+	}
+	var symbols []string
+	if list := r.URL.Query().Get("symbols"); list != "" {
+		for _, symbol := range strings.Split(list, ",") {
+			symbols = append(symbols, normalizeSymbol(symbol))
+		}
+	}
+	events, unsubscribe := h.Subscribe(userAccountId, symbols)
+	defer unsubscribe()
+
+	controller := http.NewResponseController(w)
+	// the stream outlives the server's write timeout
+	_ = controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	// send the headers now, so the client knows it is subscribed before the first event
+	_ = controller.Flush()
+
+	write := func(event StreamEvent) error {
+		marshaledEvent, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, marshaledEvent)
+		if err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+	livePrices.Range(func(key, value interface{}) bool {
+		symbol := key.(string)
+		if len(symbols) > 0 && !slices.Contains(symbols, symbol) {
+			return true
+		}
+		entry := value.(livePriceEntry)
+		return write(StreamEvent{Type: StreamEventPrice, Symbol: symbol, Data: entry.quote, At: entry.receivedAt}) == nil
+	})
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			err = write(event)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			if err == nil {
+				err = controller.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// AlpacaStream consumes Alpaca's market data stream for the tokenized symbols and the trade
+// updates of every linked account that can stream them. Prices go to the live price cache
+// and the hub; fills check the user's share locks straight away and go to the hub. Dropped
+// connections are retried after Backoff, doubling up to MaxBackoff, and trade updates resume
+// from the last one received. Linked accounts and symbols are re-read every Refresh.
+// ALPACA_STREAM_URL points the market data stream elsewhere, such as the replay stub in
+// scripts.
+type AlpacaStream struct {
+	Credentials *BrokerageCredentialStore
+	Assets      *AssetRegistry
+	Locks       *ShareLockMonitor
+	Hub         *StreamHub
+	APIKey      string
+	APISecret   string
+	Feed        marketdata.Feed
+	DataURL     string
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Refresh     time.Duration
+
+	mu          sync.Mutex
+	accounts    map[string]context.CancelFunc
+	symbols     []string
+	stopSymbols context.CancelFunc
+}
+
+func NewAlpacaStream(credentials *BrokerageCredentialStore, assets *AssetRegistry, locks *ShareLockMonitor, hub *StreamHub) *AlpacaStream {
+	s := &AlpacaStream{
+		Credentials: credentials,
+		Assets:      assets,
+		Locks:       locks,
+		Hub:         hub,
+		APIKey:      os.Getenv("ALPACA_API_KEY"),
+		APISecret:   os.Getenv("ALPACA_API_SECRET"),
+		Feed:        marketdata.IEX,
+		DataURL:     os.Getenv("ALPACA_STREAM_URL"),
+		Backoff:     defaultStreamBackoff,
+		MaxBackoff:  defaultStreamMaxBackoff,
+		Refresh:     defaultStreamRefresh,
+		accounts:    map[string]context.CancelFunc{},
+	}
+	if backoff, err := time.ParseDuration(os.Getenv("STREAM_BACKOFF")); err == nil {
+		s.Backoff = backoff
+	}
+	if maxBackoff, err := time.ParseDuration(os.Getenv("STREAM_MAX_BACKOFF")); err == nil {
+		s.MaxBackoff = maxBackoff
+	}
+	return s
+}
+
+// withBackoff runs connect until ctx ends or the stream is unsupported. A connection that
+// stayed up longer than MaxBackoff starts the wait over from Backoff.
+func (s *AlpacaStream) withBackoff(ctx context.Context, name string, connect func(context.Context) error) {
+	wait := s.Backoff
+	for {
+		connectedAt := time.Now()
+		err := connect(ctx)
+		if ctx.Err() != nil || errors.Is(err, ErrBrokerageUnsupported) {
+			return
+		}
+		if time.Since(connectedAt) > s.MaxBackoff {
+			wait = s.Backoff
+		}
+		fmt.Println("Stream ", name, " disconnected: ", err, "; reconnecting in ", wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, s.MaxBackoff)
+	}
+}
+
+func (s *AlpacaStream) onTrade(trade stream.Trade) {
+	quote := updateLivePrice(trade.Symbol, func(quote *Quote) {
+		quote.LastPrice = trade.Price
+		quote.Timestamp = trade.Timestamp
+	})
+	s.Hub.Publish(StreamEvent{Type: StreamEventPrice, Symbol: trade.Symbol, Data: quote, At: time.Now()})
+}
+
+func (s *AlpacaStream) onQuote(streamQuote stream.Quote) {
+	updateLivePrice(streamQuote.Symbol, func(quote *Quote) {
+		quote.BidPrice = streamQuote.BidPrice
+		quote.AskPrice = streamQuote.AskPrice
+	})
+}
+
+// streamMarketData holds one market data connection until it terminates. The client's own
+// reconnection is limited to one attempt so that withBackoff paces the rest.
+func (s *AlpacaStream) streamMarketData(ctx context.Context, symbols []string) error {
+	options := []stream.StockOption{
+		stream.WithCredentials(s.APIKey, s.APISecret),
+		stream.WithReconnectSettings(1, 0),
+		stream.WithTrades(s.onTrade, symbols...),
+		stream.WithQuotes(s.onQuote, symbols...),
+	}
+	if s.DataURL != "" {
+		options = append(options, stream.WithBaseURL(s.DataURL))
+	}
+	client := stream.NewStocksClient(s.Feed, options...)
+	err := client.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-client.Terminated():
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (s *AlpacaStream) onTradeUpdate(userAccountId string, update TradeUpdate) {
+	s.Hub.Publish(StreamEvent{Type: StreamEventTradeUpdate, UserAccountId: userAccountId, Symbol: update.Symbol, Data: update, At: update.At})
+	if update.Event != "fill" && update.Event != "partial_fill" {
+		return
+	}
+	err := s.Locks.CheckPosition(userAccountId, update.Symbol)
+	if err != nil && !errors.Is(err, errStepInFlight) {
+		fmt.Println("Error checking share lock of ", userAccountId, " ", update.Symbol, ": ", err)
+	}
+}
+
+func (s *AlpacaStream) streamTradeUpdates(ctx context.Context, userAccountId string) {
+	var since time.Time
+	s.withBackoff(ctx, "trade updates of "+userAccountId, func(ctx context.Context) error {
+		brokerage, err := s.Credentials.Brokerage(userAccountId)
+		if err != nil {
+			return err
+		}
+		streamer, ok := brokerage.(TradeUpdateStreamer)
+		if !ok {
+			return ErrBrokerageUnsupported
+		}
+		err = streamer.StreamTradeUpdates(ctx, since, func(update TradeUpdate) {
+			since = update.At
+			s.onTradeUpdate(userAccountId, update)
+		})
+		if err == nil {
+			err = errors.New("stream ended")
+		}
+		return err
+	})
+}
+
+// sync starts streams for newly linked accounts and symbols and stops those that are gone.
+func (s *AlpacaStream) sync(ctx context.Context) error {
+	linked, err := s.Credentials.List()
+	if err != nil {
+		return err
+	}
+	assets, err := s.Assets.List()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := map[string]bool{}
+	for _, credentials := range linked {
+		if credentials.Provider != BrokerageAlpaca {
+			continue
+		}
+		current[credentials.UserAccountId] = true
+		if _, running := s.accounts[credentials.UserAccountId]; running {
+			continue
+		}
+		accountCtx, cancel := context.WithCancel(ctx)
+		s.accounts[credentials.UserAccountId] = cancel
+		go s.streamTradeUpdates(accountCtx, credentials.UserAccountId)
+	}
+	for userAccountId, cancel := range s.accounts {
+		if !current[userAccountId] {
+			cancel()
+			delete(s.accounts, userAccountId)
+		}
+	}
+
+	symbols := []string{}
+	for _, asset := range assets {
+		if asset.Enabled {
+			symbols = append(symbols, asset.Symbol)
+		}
+	}
+	slices.Sort(symbols)
+	if slices.Equal(symbols, s.symbols) && s.stopSymbols != nil {
+		return nil
+	}
+	if s.stopSymbols != nil {
+		s.stopSymbols()
+		s.stopSymbols = nil
+	}
+	s.symbols = symbols
+	if len(symbols) == 0 {
+		return nil
+	}
+	symbolsCtx, cancel := context.WithCancel(ctx)
+	s.stopSymbols = cancel
+	go s.withBackoff(symbolsCtx, "market data", func(ctx context.Context) error {
+		return s.streamMarketData(ctx, symbols)
+	})
+	return nil
+}
+
+func (s *AlpacaStream) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Refresh)
+	defer ticker.Stop()
+	for {
+		err := s.sync(ctx)
+		if err != nil {
+			fmt.Println("Error syncing streams: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
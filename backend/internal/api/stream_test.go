@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+// streamClient reads the events of one /stream connection.
+type streamClient struct {
+	events chan StreamEvent
+}
+
+func openStream(t *testing.T, server *httptest.Server, query, token string) (*streamClient, int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: token})
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, resp.StatusCode
+	}
+	client := &streamClient{events: make(chan StreamEvent, 16)}
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event StreamEvent
+			if json.Unmarshal([]byte(data), &event) == nil {
+				client.events <- event
+			}
+		}
+	}()
+	return client, http.StatusOK
+}
+
+// until returns the events received before one for symbol.
+func (c *streamClient) until(t *testing.T, symbol string) []StreamEvent {
+	t.Helper()
+	var events []StreamEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-c.events:
+			if event.Symbol == symbol && event.Type == StreamEventPrice {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("no event for %s; received %+v", symbol, events)
+		}
+	}
+}
+
+func tradeUpdates(events []StreamEvent) []StreamEvent {
+	var updates []StreamEvent
+	for _, event := range events {
+		if event.Type == StreamEventTradeUpdate {
+			updates = append(updates, event)
+		}
+	}
+	return updates
+}
+
+func TestStreamTradeUpdatesReachOnlyTheirUser(t *testing.T) {
+	replay := filepath.Join(t.TempDir(), "replay.json")
+	err := os.WriteFile(replay, []byte(`{"tradeUpdates": [
+		{"event": "new", "orderId": "o-1", "symbol": "AAPL", "side": "buy", "qty": "0", "price": "0", "positionQty": "10"},
+		{"event": "canceled", "orderId": "o-1", "symbol": "AAPL", "side": "buy", "qty": "0", "price": "0", "positionQty": "10"}
+	]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ALPACA_STREAM_REPLAY", replay)
+
+	userKey, _ := hiero.PrivateKeyGenerateEd25519()
+	otherKey, _ := hiero.PrivateKeyGenerateEd25519()
+	auth := newTestAuthenticator(t, map[string]hiero.PrivateKey{"0.0.1001": userKey, "0.0.1002": otherKey})
+	o, _ := newStubOAuth(t, auth)
+	router := oauthRouter(o)
+	userToken := signIn(t, auth, "0.0.1001", userKey)
+	serve(t, router, authorize(t, serve(t, router, "/brokerage/alpaca/connect", userToken)), userToken)
+	otherToken := signIn(t, auth, "0.0.1002", otherKey)
+
+	hub := NewStreamHub(auth)
+	server := httptest.NewServer(http.HandlerFunc(hub.HandleStream))
+	t.Cleanup(server.Close)
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		token string
+		want  int
+	}{
+		{name: "anonymous asking for a user", query: "?userAccountId=0.0.1001", want: http.StatusUnauthorized},
+		{name: "other user asking for a user", query: "?userAccountId=0.0.1001", token: otherToken, want: http.StatusForbidden},
+	} {
+		if _, status := openStream(t, server, tt.query, tt.token); status != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	user, _ := openStream(t, server, "?userAccountId=0.0.1001", userToken)
+	other, _ := openStream(t, server, "", otherToken)
+	anonymous, _ := openStream(t, server, "", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &AlpacaStream{Credentials: o.Credentials, Hub: hub, Backoff: time.Second, MaxBackoff: time.Second}
+	go s.streamTradeUpdates(ctx, "0.0.1001")
+
+	deadline := time.After(5 * time.Second)
+	var received []StreamEvent
+	for len(received) < 2 {
+		select {
+		case event := <-user.events:
+			if event.Type == StreamEventTradeUpdate {
+				received = append(received, event)
+			}
+		case <-deadline:
+			t.Fatalf("user received %d trade updates, want 2", len(received))
+		}
+	}
+	if received[0].UserAccountId != "0.0.1001" || received[1].Symbol != "AAPL" {
+		t.Fatalf("unexpected trade updates %+v", received)
+	}
+
+	// a price published after the trade updates reaches everyone behind them
+	hub.Publish(StreamEvent{Type: StreamEventPrice, Symbol: "SENTINEL"})
+	for name, client := range map[string]*streamClient{"other user": other, "anonymous": anonymous} {
+		if updates := tradeUpdates(client.until(t, "SENTINEL")); len(updates) > 0 {
+			t.Fatalf("%s received trade updates %+v", name, updates)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	tokenizeRequestPrefix = "tokenize-request:"
+	tokenizePendingPrefix = "tokenize-pending:"
+	IdempotencyKeyHeader  = "Idempotency-Key"
+)
+
+const (
+	TokenizePending   = "pending"
+	TokenizeCompleted = "completed"
+	TokenizeFailed    = "failed"
+)
+
+// tokenizeMu serialises tokenization so two requests cannot both mint the same delta.
+var tokenizeMu sync.Mutex
+
+// TokenizeMint is one asset minted for a request. Shares are whole-share terms, Units the
+// token's smallest denomination. Escrowed mints wait for the user to associate the token or
+// pass KYC.
+type TokenizeMint struct {
+	WorkflowId    string `json:"workflowId"`
+	Symbol        string `json:"symbol"`
+	TokenId       string `json:"tokenId"`
+	Shares        string `json:"shares"`
+	Units         int64  `json:"units"`
+	TransactionId string `json:"transactionId,omitempty"`
+	Escrowed      bool   `json:"escrowed,omitempty"`
+}
+
+// TokenizeRequest is stored under the caller's idempotency key so a retried request returns
+// the original outcome instead of minting again.
+type TokenizeRequest struct {
+	Key           string         `json:"key"`
+	UserAccountId string         `json:"userAccountId"`
+	Status        string         `json:"status"`
+	Mints         []TokenizeMint `json:"mints"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     string         `json:"createdAt"`
+	UpdatedAt     string         `json:"updatedAt"`
+}
+
+// PendingMint is tokens minted for a user that the mirror node may not show in their balance
+// yet: either the transfer has not happened or the mirror node has not ingested it. Its id is
+// the tokenization workflow's.
+type PendingMint struct {
+	Id            string `json:"id"`
+	Symbol        string `json:"symbol"`
+	Units         int64  `json:"units"`
+	RequestKey    string `json:"requestKey"`
+	TransactionId string `json:"transactionId,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+// TokenizePlan is what tokenizing a position would mint.
+type TokenizePlan struct {
+	Symbol          string `json:"symbol"`
+	BrokerageShares string `json:"brokerageShares"`
+	BrokerageUnits  int64  `json:"brokerageUnits"`
+	LockedUnits     int64  `json:"lockedUnits"`
+	PendingUnits    int64  `json:"pendingUnits"`
+	DeltaUnits      int64  `json:"deltaUnits"`
+
+	asset  AssetRecord
+	shares decimal.Decimal
+}
+
+func tokenizeRequestKey(userAccountId, key string) string {
+	return tokenizeRequestPrefix + userAccountId + ":" + key
+}
+
+func tokenizePendingKey(userAccountId, symbol, id string) string {
+	return tokenizePendingPrefix + userAccountId + ":" + symbol + ":" + id
+}
+
+func (u *UserHandler) getTokenizeRequest(userAccountId, key string) (TokenizeRequest, bool, error) {
+	var request TokenizeRequest
+	err := u.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(tokenizeRequestKey(userAccountId, key)))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &request)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return TokenizeRequest{}, false, nil
+	}
+	return request, err == nil, err
+}
+
+func (u *UserHandler) putTokenizeRequest(request TokenizeRequest) error {
+	request.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledRequest, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return u.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(tokenizeRequestKey(request.UserAccountId, request.Key)), marshaledRequest)
+	})
+}
+
+func (u *UserHandler) putPendingMint(userAccountId string, pending PendingMint) error {
+	marshaledPending, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	return u.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(tokenizePendingKey(userAccountId, pending.Symbol, pending.Id)), marshaledPending)
+	})
+}
+
+// pendingUnits sums the user's pending mints of symbol that the share lock does not cover:
+// those whose workflow started before shares were locked. Mints whose transfer the mirror
+// node reports as successful are in the wallet balance already and are dropped.
+func (u *UserHandler) pendingUnits(userAccountId, symbol string) (int64, error) {
+	var pending []PendingMint
+	prefix := []byte(tokenizePendingPrefix + userAccountId + ":" + symbol + ":")
+	err := u.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var mint PendingMint
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &mint)
+			})
+			if err != nil {
+				return err
+			}
+			pending = append(pending, mint)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var units int64
+	for _, mint := range pending {
+		if mint.TransactionId != "" {
+			result, err := mirrorTransactionResult(mint.TransactionId)
+			if err != nil {
+				return 0, err
+			}
+			// a failed transfer is retried or compensated by its workflow, which replaces or
+			// drops the pending mint itself
+			if result == "SUCCESS" {
+				err = u.DB.Update(func(txn *badger.Txn) error {
+					return txn.Delete([]byte(tokenizePendingKey(userAccountId, symbol, mint.Id)))
+				})
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		wf, err := u.Saga.Get(mint.Id)
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, err
+		}
+		if err == nil && wf.SharesLocked {
+			continue
+		}
+		units += mint.Units
+	}
+	return units, nil
+}
+
+// planTokenization works out, per eligible position, how many units are outstanding already
+// and how many more the brokerage position backs. Outstanding units are those the share lock
+// holds, wherever the tokens have gone since, and pending mints whose shares are not locked.
+func (u *UserHandler) planTokenization(userAccountId string) ([]TokenizePlan, error) {
+	brokerage, err := u.brokerage(userAccountId)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := brokerage.Positions()
+	if err != nil {
+		return nil, err
+	}
+	var plans []TokenizePlan
+	for _, position := range positions {
+		asset, ok, err := u.Assets.Eligible(position.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		// locked shares back the user's tokens, which are subtracted below
+		shares, units, err := asset.Units(position.QtyAvailable.Add(position.Locked))
+		if err != nil {
+			return nil, err
+		}
+		plan := TokenizePlan{
+			Symbol:          asset.Symbol,
+			BrokerageShares: shares.String(),
+			BrokerageUnits:  units,
+			asset:           asset,
+		}
+		var lock ShareLock
+		err = u.DB.View(func(txn *badger.Txn) error {
+			lock, err = getShareLock(txn, userAccountId, asset)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.LockedUnits = lock.Units
+		plan.PendingUnits, err = u.pendingUnits(userAccountId, asset.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		plan.DeltaUnits = plan.BrokerageUnits - plan.LockedUnits - plan.PendingUnits
+		plan.shares = asset.Shares(plan.DeltaUnits)
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// HandleTokenizePortfolio mints, for every position the asset registry allows, the units the
+// brokerage position backs beyond what the user already holds. Requests carry an
+// Idempotency-Key header; repeating a key returns the first request's outcome. The request
+// only plans and stores the workflows: they run in the background, so a new request is
+// answered with 202 and polled by repeating it.
+func (u *UserHandler) HandleTokenizePortfolio(w http.ResponseWriter, r *http.Request) {
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	if key == "" {
+		http.Error(w, "Missing Idempotency-Key header", http.StatusBadRequest)
+		return
+	}
+
+	tokenizeMu.Lock()
+	defer tokenizeMu.Unlock()
+
+	request, found, err := u.getTokenizeRequest(userAccountId, key)
+	if err != nil {
+		fmt.Println("Error getting tokenize request: ", err)
+		http.Error(w, "Failed to tokenize portfolio", http.StatusInternalServerError)
+		return
+	}
+	if found {
+		err = u.refreshTokenizeRequest(&request)
+		if err != nil {
+			fmt.Println("Error refreshing tokenize request: ", err)
+		}
+	}
+	if found && request.Status != TokenizeFailed {
+		writeTokenizeRequest(w, request, nil)
+		return
+	}
+
+	plans, err := u.planTokenization(userAccountId)
+	if err != nil {
+		writeBrokerageError(w, err, "get positions")
+		return
+	}
+	if len(plans) == 0 {
+		http.Error(w, "You have no allowed tokenized assets in your portfolio", http.StatusBadRequest)
+		return
+	}
+	for _, plan := range plans {
+		if plan.DeltaUnits < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": fmt.Sprintf("Your %s position is smaller than the tokens you hold", plan.Symbol),
+				"plans":   plans,
+			})
+			return
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	request = TokenizeRequest{
+		Key:           key,
+		UserAccountId: userAccountId,
+		Status:        TokenizePending,
+		Mints:         []TokenizeMint{},
+		CreatedAt:     now,
+	}
+	err = u.putTokenizeRequest(request)
+	if err != nil {
+		fmt.Println("Error storing tokenize request: ", err)
+		http.Error(w, "Failed to tokenize portfolio", http.StatusInternalServerError)
+		return
+	}
+
+	started := []string{}
+	for _, plan := range plans {
+		if plan.DeltaUnits == 0 {
+			continue
+		}
+		wf, err := u.Saga.Start(userAccountId, plan.asset, plan.DeltaUnits, key)
+		if err == nil {
+			// counted against the next request until the transfer shows in the wallet
+			err = u.putPendingMint(userAccountId, PendingMint{
+				Id:         wf.Id,
+				Symbol:     plan.Symbol,
+				Units:      plan.DeltaUnits,
+				RequestKey: key,
+				CreatedAt:  now,
+			})
+		}
+		if err != nil {
+			fmt.Println("Error starting tokenization of ", plan.Symbol, ": ", err)
+			request.Status = TokenizeFailed
+			request.Error = err.Error()
+			_ = u.putTokenizeRequest(request)
+			http.Error(w, "Failed to mint and record tokenized asset", http.StatusInternalServerError)
+			return
+		}
+		request.Mints = append(request.Mints, TokenizeMint{
+			WorkflowId: wf.Id,
+			Symbol:     plan.Symbol,
+			TokenId:    plan.asset.TokenId,
+			Shares:     plan.shares.String(),
+			Units:      plan.DeltaUnits,
+		})
+		err = u.putTokenizeRequest(request)
+		if err != nil {
+			fmt.Println("Error storing tokenize request: ", err)
+		}
+		started = append(started, wf.Id)
+	}
+	// runs once this request releases tokenizeMu
+	u.Saga.AdvanceLater(started...)
+
+	err = u.refreshTokenizeRequest(&request)
+	if err != nil {
+		fmt.Println("Error refreshing tokenize request: ", err)
+	}
+	writeTokenizeRequest(w, request, plans)
+}
+
+// refreshTokenizeRequest derives the request's status from its workflows: completed once all
+// completed, failed once none is left running and one was compensated, pending otherwise.
+func (u *UserHandler) refreshTokenizeRequest(request *TokenizeRequest) error {
+	status := TokenizeCompleted
+	failed := false
+	for j := range request.Mints {
+		mint := &request.Mints[j]
+		wf, err := u.Saga.Get(mint.WorkflowId)
+		if err != nil {
+			return err
+		}
+		if step := wf.step(StepTransfer); step != nil && step.Status == StepDone {
+			mint.TransactionId = step.TransactionId
+		}
+		mint.Escrowed = wf.Status == WorkflowEscrowed
+		switch wf.Status {
+		case WorkflowCompleted:
+		case WorkflowCompensated:
+			failed = true
+		default:
+			status = TokenizePending
+		}
+	}
+	if failed && status == TokenizeCompleted {
+		status = TokenizeFailed
+	}
+	if status == request.Status {
+		return nil
+	}
+	request.Status = status
+	return u.putTokenizeRequest(*request)
+}
+
+func writeTokenizeRequest(w http.ResponseWriter, request TokenizeRequest, plans []TokenizePlan) {
+	escrowed := false
+	for _, mint := range request.Mints {
+		escrowed = escrowed || mint.Escrowed
+	}
+	status := http.StatusOK
+	message := "Tokenized assets minted successfully"
+	switch {
+	case request.Status == TokenizePending && escrowed:
+		status = http.StatusAccepted
+		message = "Tokens are held in escrow until your account is associated with the token and KYC is complete"
+	case request.Status == TokenizePending:
+		status = http.StatusAccepted
+		message = "Tokenization is in progress"
+	case request.Status == TokenizeFailed:
+		status = http.StatusBadGateway
+		message = "Tokenization failed and was rolled back"
+	case len(request.Mints) == 0:
+		message = "Your portfolio is already fully tokenized"
+	}
+	response := map[string]interface{}{
+		"success": request.Status != TokenizeFailed,
+		"message": message,
+		"request": request,
+	}
+	if plans != nil {
+		response["plans"] = plans
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode tokenize request", http.StatusInternalServerError)
+		return
+	}
+}
@@ -3,9 +3,10 @@ package api
 import (
 	"math/big"
 
-	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/common"
 	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
 )
 
 
@@ -15,6 +16,9 @@ type LoanStatus struct {
 	BorrowedToken    string  `json:"borrowed_token"`
 	BorrowedAmount   float64 `json:"borrowed_amount"`
 	APY              float64 `json:"apy"`
+	MarketId         string  `json:"market_id,omitempty"`
+	TransactionHash  string  `json:"transaction_hash,omitempty"`
+	UpdatedAt        string  `json:"updated_at,omitempty"`
 }
 
 type StockToken struct {
@@ -24,6 +28,24 @@ type StockToken struct {
 	UnrealizedPL    float64 `json:"unrealizedPL"`
 	StockLogo       string  `json:"stockLogo"`
 	TokenizedAmount float64 `json:"tokenizedAmount"`
+	TokenizedUnits  int64   `json:"tokenizedUnits"`
+	TokenId         string  `json:"tokenId,omitempty"`
+	TokenDecimals   int     `json:"tokenDecimals"`
+}
+
+// normalize fills in the token fields of an entry recorded before they existed. Those
+// entries carried the raw minted units in TokenizedAmount.
+func (s *StockToken) normalize(asset AssetRecord) {
+	if s.TokenId != "" {
+		return
+	}
+	s.TokenId = asset.TokenId
+	s.TokenDecimals = asset.Decimals
+	if s.TokenizedUnits == 0 && s.TokenizedAmount > 0 {
+		units := decimal.NewFromFloat(s.TokenizedAmount).Truncate(0)
+		s.TokenizedUnits = units.IntPart()
+		s.TokenizedAmount = asset.Shares(s.TokenizedUnits).InexactFloat64()
+	}
 }
 
 type PoolPosition struct {
@@ -60,6 +82,7 @@ type TopicMessagesMNAPIResponse struct {
 		SequenceNumber int64  `json:"sequence_number"`
 		Message        string `json:"message"`
 	} `json:"messages"`
+	Links MirrorLinks `json:"links"`
 }
 
 type User struct {
@@ -73,16 +96,24 @@ type User struct {
 	UpdatedAt       string       `json:"updatedAt"`
 }
 
+// Portfolio is the user's brokerage account at a glance. PortfolioValueUSD is what the
+// brokerage reports; NetWorth adds the network and the lending pool to it.
 type Portfolio struct {
-	PortfolioValueUSD float64 `json:"portfolioValueUSD"`
-	TokenizedAssets   int     `json:"tokenizedAssets"`
-	OptionsAssets     int     `json:"optionsAssets"`
+	PortfolioValueUSD float64     `json:"portfolioValueUSD"`
+	TokenizedAssets   int         `json:"tokenizedAssets"`
+	Positions         int         `json:"positions"`
+	ShareLocks        []ShareLock `json:"shareLocks"`
+	NetWorth          NetWorth    `json:"netWorth"`
 }
 
 type UserHandler struct {
 	DB     *badger.DB
 	Client *hiero.Client
-	Alpaca *alpaca.Client
+	Session *MarketSessionTracker
+	Assets *AssetRegistry
+	Markets *MarketRegistry
+	Saga *TokenizationSaga
+	Credentials *BrokerageCredentialStore
 }
 
 type Market struct {
@@ -109,6 +140,7 @@ type UserPosition struct {
 	SupplyShares float64 `json:"supplyShares"`
 	BorrowShares float64 `json:"borrowShares"`
 	Collateral float64 `json:"collateral"`
+	Health *float64 `json:"health,omitempty"`
 }
 
 type MarketPosition struct {
@@ -119,3 +151,21 @@ type MarketPosition struct {
 	LastUpdate        *big.Int `json:"lastUpdate"`
 	Fee               *big.Int `json:"fee"`
 }
+
+type MarketParams struct {
+	LoanToken       common.Address `json:"loanToken"`
+	CollateralToken common.Address `json:"collateralToken"`
+	Oracle          common.Address `json:"oracle"`
+	Irm             common.Address `json:"irm"`
+	Lltv            *big.Int       `json:"lltv"`
+}
+
+type MarketState struct {
+	MarketId   string         `json:"marketId"`
+	Params     MarketParams   `json:"params"`
+	Market     MarketPosition `json:"market"`
+	BorrowRate *big.Int       `json:"borrowRate"`
+	BorrowAPY  float64        `json:"borrowAPY"`
+	SupplyAPY  float64        `json:"supplyAPY"`
+	AccruedAt  int64          `json:"accruedAt"`
+}
@@ -2,37 +2,30 @@ package api
 
 import (
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math"
 	"math/big"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
-	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
 	"github.com/dgraph-io/badger/v4"
-	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-chi/chi/v5"
 	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
 	"github.com/imroc/req/v3"
-	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
 )
 
 
 
-func NewUserHandler(db *badger.DB, client *hiero.Client, alpacaClient *alpaca.Client) *UserHandler {
-	return &UserHandler{DB: db, Client: client, Alpaca: alpacaClient}
+func NewUserHandler(db *badger.DB, client *hiero.Client, assets *AssetRegistry, credentials *BrokerageCredentialStore) *UserHandler {
+	return &UserHandler{DB: db, Client: client, Assets: assets, Credentials: credentials}
 }
 
-const (
-	AllowedTokenizedAssets  = "AAPL"
-	AllowedTokenizedAssetId = "0.0.6509511"
-)
-
 func (u *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	MyPrivateKey := os.Getenv("MY_PRIVATE_KEY")
 	privateKey, err := hiero.PrivateKeyFromStringEd25519(MyPrivateKey)
@@ -156,53 +149,6 @@ func (u *UserHandler) HandleCheckTopicExists(w http.ResponseWriter, r *http.Requ
 	_, _ = fmt.Fprintf(w, `{"exists": true, "topicId": "%s"}`, string(topicId))
 }
 
-func (u *UserHandler) HandleTokenizePortfolio(w http.ResponseWriter, r *http.Request) {
-	userAccountId := chi.URLParam(r, "userAccountId")
-
-	if userAccountId == "" {
-		http.Error(w, "Missing user account ID", http.StatusBadRequest)
-		return
-	}
-	positions, err := u.Alpaca.GetPositions()
-	if err != nil {
-		http.Error(w, "Failed to get positions", http.StatusInternalServerError)
-		return
-	}
-	fmt.Println("Positions found✅")
-	// find allowed tokenized assets in positions
-	var allowedTokenizedAssets []string
-	for _, position := range positions {
-		if position.Symbol == AllowedTokenizedAssets {
-			allowedTokenizedAssets = append(allowedTokenizedAssets, position.Symbol)
-		}
-	}
-
-	if len(allowedTokenizedAssets) == 0 {
-		http.Error(w, "You have no allowed tokenized assets in your portfolio", http.StatusBadRequest)
-		return
-	}
-	fmt.Println("Allowed tokenized assets found✅")
-
-	amountToMint := positions[0].QtyAvailable.InexactFloat64()
-
-	// mint and record tokenized assets
-	for _, asset := range allowedTokenizedAssets {
-		success, err := u.mintAndRecordTokenizedAsset(userAccountId, asset, amountToMint * 100) // dAAPL decimals
-		if err != nil {
-			http.Error(w, "Failed to mint and record tokenized asset", http.StatusInternalServerError)
-			return
-		}
-		if !success {
-			http.Error(w, "Failed to mint and record tokenized asset", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = fmt.Fprintf(w, `{"success": true, "message": "Tokenized assets minted successfully"}`)
-}
-
 func (u *UserHandler) HandleGetUserTokenizedAssets(w http.ResponseWriter, r *http.Request) {
 	userAccountId := chi.URLParam(r, "userAccountId")
 	if userAccountId == "" {
@@ -258,9 +204,9 @@ func (u *UserHandler) HandleGetUserPortfolio(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Failed to get topic ID", http.StatusInternalServerError)
 		return
 	}
-	portfolio, err := u.getUserPortfolio(string(topicId))
+	portfolio, err := u.getUserPortfolio(userAccountId, string(topicId))
 	if err != nil {
-		http.Error(w, "Failed to get user portfolio", http.StatusInternalServerError)
+		writeBrokerageError(w, err, "get user portfolio")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -275,14 +221,23 @@ func (u *UserHandler) HandleGetUserPortfolio(w http.ResponseWriter, r *http.Requ
 }
 
 func (u *UserHandler) HandleGetUserPositions(w http.ResponseWriter, r *http.Request) {
-	positions, err := u.Alpaca.GetPositions()
+	userAccountId := chi.URLParam(r, "userAccountId")
+	if userAccountId == "" {
+		http.Error(w, "Missing user account ID", http.StatusBadRequest)
+		return
+	}
+	brokerage, err := u.brokerage(userAccountId)
+	if err != nil {
+		writeBrokerageError(w, err, "get positions")
+		return
+	}
+	positions, err := brokerage.Positions()
 	if err != nil {
 		http.Error(w, "Failed to get positions", http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("Positions: ", positions)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string][]alpaca.Position{
+	err = json.NewEncoder(w).Encode(map[string][]BrokeragePosition{
 		"positions": positions,
 	})
 	if err != nil {
@@ -313,32 +268,6 @@ func (u *UserHandler) HandleGetStockLogo(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (u *UserHandler) HandlePortfolioHistory(w http.ResponseWriter, r *http.Request) {
-	historyRequest := alpaca.GetPortfolioHistoryRequest{
-		Period:        "30D",
-		TimeFrame:     alpaca.TimeFrame("1H"),
-		DateEnd:       time.Now(),
-		ExtendedHours: false,
-	}
-	
-	history, err := u.Alpaca.GetPortfolioHistory(historyRequest)
-	if err != nil {
-		fmt.Println("Error getting portfolio history: ", err)
-		http.Error(w, "Failed to get portfolio history", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]interface{}{
-		"history": history,
-	})
-	if err != nil {
-		http.Error(w, "Failed to encode portfolio history", http.StatusInternalServerError)
-		return
-	}
-
-}
-
 func (u *UserHandler) HandleGetUserPersonalInformation(w http.ResponseWriter, r *http.Request) {
 	userAccountId := chi.URLParam(r, "userAccountId")
 	if userAccountId == "" {
@@ -449,109 +378,33 @@ func (u *UserHandler) HandleGetUserPosition(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Missing user account ID", http.StatusBadRequest)
 		return
 	}
-	position, err := getUserPosition(userAccountId)
-	if err != nil {
-		fmt.Println("Error getting user position: ", err.Error())
-		http.Error(w, "Failed to get user position", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]UserPosition{
-		"position": position,
-	})
-	if err != nil {
-		http.Error(w, "Failed to encode user position", http.StatusInternalServerError)
+	if _, err := parseEvmAddress(userAccountId); err != nil {
+		http.Error(w, "Invalid user account ID", http.StatusBadRequest)
 		return
 	}
-}
-
-func (u *UserHandler) HandleGetMarketPriceAnalysis(w http.ResponseWriter, r *http.Request) {
-	marketTopic, err := u.getLatestMessageFromTopic("0.0.6514924")
+	// the pool knows accounts by their EVM address, which for ECDSA accounts is not the
+	// long-zero form of the account id
+	evmAddress, err := resolveEvmAddress(userAccountId)
 	if err != nil {
-		http.Error(w, "Failed to get market topic", http.StatusInternalServerError)
+		fmt.Println("Error resolving user address: ", err)
+		http.Error(w, "Failed to resolve user address", http.StatusBadRequest)
 		return
 	}
-	var marketTopicData MarketTopic
-	err = json.Unmarshal([]byte(marketTopic), &marketTopicData)
+	position, err := getUserPosition(DefaultMarketId, evmAddress)
 	if err != nil {
-		http.Error(w, "Failed to unmarshal market topic", http.StatusInternalServerError)
+		fmt.Println("Error getting user position: ", err.Error())
+		http.Error(w, "Failed to get user position", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]MarketTopic{
-		"marketTopic": marketTopicData,
+	err = json.NewEncoder(w).Encode(map[string]UserPosition{
+		"position": position,
 	})
 	if err != nil {
-		http.Error(w, "Failed to encode market topic", http.StatusInternalServerError)
-		return
-	}
-}
-
-func (u *UserHandler) HandleUpdateUserLoanStatus(w http.ResponseWriter, r *http.Request) {
-	MyPrivateKey := os.Getenv("MY_PRIVATE_KEY")
-	privateKey, err := hiero.PrivateKeyFromStringEd25519(MyPrivateKey)
-	if err != nil {
-		http.Error(w, "Failed to parse private key", http.StatusInternalServerError)
-		return
-	}
-	userAccountId := chi.URLParam(r, "userAccountId")
-	if userAccountId == "" {
-		http.Error(w, "Missing user account ID", http.StatusBadRequest)
-		return
-	}
-	topicId, err := u.getUserTopicId(userAccountId)
-	if err != nil {
-		http.Error(w, "Failed to get user topic ID", http.StatusInternalServerError)
-		return
-	}
-	userData, err := u.getLatestMessageFromTopic(topicId)
-	if err != nil {
-		http.Error(w, "Failed to get user data from topic", http.StatusInternalServerError)
-		return
-	}
-	var user User
-	err = json.Unmarshal([]byte(userData), &user)
-	if err != nil {
-		http.Error(w, "Failed to unmarshal user data", http.StatusInternalServerError)
-		return
-	}
-	var newLoanStatus LoanStatus
-	err = json.NewDecoder(r.Body).Decode(&newLoanStatus)
-	if err != nil {
-		http.Error(w, "Failed to decode loan status", http.StatusInternalServerError)
-		return
-	}
-	user.LoanStatus = append(user.LoanStatus, newLoanStatus)
-	marshaledUser, err := json.Marshal(user)
-	if err != nil {
-		http.Error(w, "Failed to marshal user data", http.StatusInternalServerError)
-		return
-	}
-	topicID, err := hiero.TopicIDFromString(topicId)
-	if err != nil {
-		http.Error(w, "Failed to convert topic ID to Hedera topic ID", http.StatusInternalServerError)
+		http.Error(w, "Failed to encode user position", http.StatusInternalServerError)
 		return
 	}
-	topicMsgSubmitTx, _ := hiero.NewTopicMessageSubmitTransaction().
-		SetTransactionMemo("User updated loan status").
-		SetTopicID(topicID).
-		SetMessage(marshaledUser).
-		FreezeWith(u.Client)
-
-	topicMsgSubmitTxId := topicMsgSubmitTx.GetTransactionID()
-	fmt.Printf("The topic message submit transaction ID: %s\n", topicMsgSubmitTxId.String())
-	topicMsgSubmitTxSigned := topicMsgSubmitTx.Sign(privateKey)
-	topicMsgSubmitTxSubmitted, _ := topicMsgSubmitTxSigned.Execute(u.Client)
-	topicMsgSubmitTxReceipt, _ := topicMsgSubmitTxSubmitted.GetReceipt(u.Client)
-
-	topicMsgSeqNum := topicMsgSubmitTxReceipt.TopicSequenceNumber
-	fmt.Printf("Topic Message Sequence Number: %v\n", topicMsgSeqNum)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = fmt.Fprintf(w, `{"success": true, "message": "User updated loan status successfully", "userAccountId": "%s", "topicId": "%s"}`, userAccountId, topicId)
 }
 
 func (u *UserHandler) HandleGetUserLoanStatus(w http.ResponseWriter, r *http.Request) {
@@ -577,6 +430,20 @@ func (u *UserHandler) HandleGetUserLoanStatus(w http.ResponseWriter, r *http.Req
 		return
 	}
 	loanStatus := user.LoanStatus
+	borrowAPYs := map[string]float64{}
+	for i := range loanStatus {
+		// entries without a justifying transaction were self-reported by older clients
+		if loanStatus[i].TransactionHash == "" {
+			marketId := loanStatus[i].MarketId
+			if marketId == "" {
+				marketId = DefaultMarketId
+			}
+			if _, ok := borrowAPYs[marketId]; !ok {
+				borrowAPYs[marketId] = currentBorrowAPY(marketId)
+			}
+			loanStatus[i].APY = borrowAPYs[marketId]
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(map[string][]LoanStatus{
@@ -588,202 +455,85 @@ func (u *UserHandler) HandleGetUserLoanStatus(w http.ResponseWriter, r *http.Req
 	}
 }
 
-func getUserPosition(userEvmAddress string) (UserPosition, error){
-	var marketId = "0xc6c8d3eb24d61523202abed6d47eb676e7f2fef743503b857f8559390318bb10"
-	var newContractID, _ = hiero.ContractIDFromString("0.0.6532033")
-	err := godotenv.Load(".env")
+func getUserPosition(marketId string, userEvmAddress string) (UserPosition, error){
+	marketIdBytes32, err := marketIdToBytes32(marketId)
 	if err != nil {
 		return UserPosition{}, err
 	}
-	 abiBytes, err := os.ReadFile("abi.json")
-	 if err != nil {
-		 return UserPosition{}, err
-	 }
- 
-	 contractABI, err := abi.JSON(strings.NewReader(string(abiBytes)))
-	 if err != nil {
-		 return UserPosition{}, err
-	 }
-
-	operatorIdStr := os.Getenv("MY_ACCOUNT_ID")
-	operatorKeyStr := os.Getenv("MY_PRIVATE_KEY")
-	if operatorIdStr == "" || operatorKeyStr == "" {
-		return UserPosition{}, errors.New("must set operator account id and private key")
+	var result struct {
+		SupplyShares  *big.Int
+		BorrowShares  *big.Int
+		Collateral    *big.Int
 	}
-
-	operatorId, _ := hiero.AccountIDFromString(operatorIdStr)
-	operatorKey, _ := hiero.PrivateKeyFromStringEd25519(operatorKeyStr)
-
-	client := hiero.ClientForTestnet()
-	client.SetOperator(operatorId, operatorKey)
-
-	marketIdBytes, _ := hex.DecodeString(marketId[2:])
-	var marketIdBytes32 [32]byte
-	copy(marketIdBytes32[:], marketIdBytes)
-	contractFunctionParameters := hiero.NewContractFunctionParameters()
-	contractFunctionParameters.AddBytes32(marketIdBytes32)
-	contractFunctionParameters.AddAddress(userEvmAddress)
-	transaction := hiero.NewContractCallQuery().
-	SetContractID(newContractID).
-	SetGas(600_000).
-	SetFunction("position", contractFunctionParameters)
-
-
-	contractFunctionResult, err := transaction.Execute(client)
-
+	err = callPool("position", &result, marketIdBytes32, common.HexToAddress(userEvmAddress))
 	if err != nil {
 		return UserPosition{}, err
 	}
-	 var result struct {
-        SupplyShares  *big.Int
-        BorrowShares  *big.Int
-        Collateral    *big.Int
-    }
 
-	err = contractABI.UnpackIntoInterface(&result, "position", contractFunctionResult.ContractCallResult)
-    if err != nil {
-        return UserPosition{}, err
-    }
-
-    supplyTokens := float64(result.SupplyShares.Uint64())
-    borrowTokens := float64(result.BorrowShares.Uint64())
-    collateralTokens := float64(result.Collateral.Uint64()) / 100
-
-	marketPosition, err := getMarketPosition()
+	marketState, err := getMarketState(marketId)
 	if err != nil {
 		return UserPosition{}, err
 	}
-
-    return UserPosition{
-		SupplyShares: supplyTokens * (float64(marketPosition.TotalSupplyAssets.Int64()) / float64(marketPosition.TotalSupplyShares.Int64())),
-		BorrowShares: borrowTokens * (float64(marketPosition.TotalBorrowAssets.Int64()) / float64(marketPosition.TotalBorrowShares.Int64())),
-		Collateral: collateralTokens,
-	}, nil
-
-}
-
-func getMarketPosition() (MarketPosition, error) {
-	var marketId = "0xc6c8d3eb24d61523202abed6d47eb676e7f2fef743503b857f8559390318bb10"
-	var newContractID, _ = hiero.ContractIDFromString("0.0.6532033")
-	err := godotenv.Load(".env")
-	if err != nil {
-		return MarketPosition{}, err
-	}
-	abiBytes, err := os.ReadFile("abi.json")
+	collateralDecimals, err := tokenDecimals(marketState.Params.CollateralToken)
 	if err != nil {
-		return MarketPosition{}, err
-	}
-	contractABI, err := abi.JSON(strings.NewReader(string(abiBytes)))
-	if err != nil {
-		return MarketPosition{}, err
-	}
-	operatorIdStr := os.Getenv("MY_ACCOUNT_ID")
-	operatorKeyStr := os.Getenv("MY_PRIVATE_KEY")
-	if operatorIdStr == "" || operatorKeyStr == "" {
-		return MarketPosition{}, errors.New("must set operator account id and private key")
+		return UserPosition{}, err
 	}
-	operatorId, _ := hiero.AccountIDFromString(operatorIdStr)
-	operatorKey, _ := hiero.PrivateKeyFromStringEd25519(operatorKeyStr)
-	client := hiero.ClientForTestnet()
-	client.SetOperator(operatorId, operatorKey)
 
-	marketIdBytes, _ := hex.DecodeString(marketId[2:])
-	var marketIdBytes32 [32]byte
-	copy(marketIdBytes32[:], marketIdBytes)
+	var price *big.Int
+	if result.BorrowShares.Sign() > 0 {
+		price, err = getOraclePrice(marketState.Params.Oracle)
+		if err != nil {
+			return UserPosition{}, err
+		}
+	}
+	return newUserPosition(result.SupplyShares, result.BorrowShares, result.Collateral, marketState, price, collateralDecimals), nil
 
-	contractFunctionParameters := hiero.NewContractFunctionParameters()
-	contractFunctionParameters.AddBytes32(marketIdBytes32)
+}
 
-	transaction := hiero.NewContractCallQuery().
-	SetContractID(newContractID).
-	SetGas(600_000).
-	SetFunction("market", contractFunctionParameters)
+// newUserPosition converts raw position shares into the assets they are worth in an accrued
+// market. price is only needed when the position has debt.
+func newUserPosition(supplyShares, borrowShares, collateral *big.Int, marketState MarketState, price *big.Int, collateralDecimals int) UserPosition {
+	market := marketState.Market
+	// interest accrued since the market's lastUpdate is already folded into the totals
+	supplyAssets := toAssetsDown(supplyShares, market.TotalSupplyAssets, market.TotalSupplyShares)
+	borrowAssets := toAssetsUp(borrowShares, market.TotalBorrowAssets, market.TotalBorrowShares)
 
-	contractFunctionResult, err := transaction.Execute(client)
-	if err != nil {
-		return MarketPosition{}, err
+	var health *float64
+	if borrowAssets.Sign() > 0 {
+		health = healthFactor(collateral, borrowAssets, price, marketState.Params.Lltv)
 	}
 
-	var result struct {
-		TotalSupplyAssets *big.Int
-		TotalSupplyShares *big.Int
-		TotalBorrowAssets *big.Int
-		TotalBorrowShares *big.Int
-		LastUpdate        *big.Int
-		Fee               *big.Int
-	}
-
-	err = contractABI.UnpackIntoInterface(&result, "market", contractFunctionResult.ContractCallResult)
-	if err != nil {
-		return MarketPosition{}, err
+	return UserPosition{
+		SupplyShares: float64(supplyAssets.Uint64()),
+		BorrowShares: float64(borrowAssets.Uint64()),
+		Collateral: float64(collateral.Uint64()) / math.Pow10(collateralDecimals),
+		Health: health,
 	}
-
-	return MarketPosition{
-		TotalSupplyAssets: result.TotalSupplyAssets,
-		TotalSupplyShares: result.TotalSupplyShares,
-		TotalBorrowAssets: result.TotalBorrowAssets,
-		TotalBorrowShares: result.TotalBorrowShares,
-		LastUpdate: result.LastUpdate,
-		Fee: result.Fee,
-	}, nil
 }
 
-func (u *UserHandler) UpdatePriceAnalysis(collateralTransacted, hashTransacted float64) (bool, error) {
-	privateKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+func getMarketPosition(marketId string) (MarketPosition, error) {
+	marketIdBytes32, err := marketIdToBytes32(marketId)
 	if err != nil {
-		return false, err
-	}
-	marketTopic, err := u.getLatestMessageFromTopic("0.0.6514924")
-	if err != nil {
-		return false, err
-	}
-	var marketTopicData MarketTopic
-	err = json.Unmarshal([]byte(marketTopic), &marketTopicData)
-	if err != nil {
-		fmt.Println("Error un-marshalling market topic: ", err)
-		return false, err
+		return MarketPosition{}, err
 	}
-	messages := marketTopicData.Messages
-	latestCollateral := messages[len(messages)-1].Collateral
-	latestHash := messages[len(messages)-1].Hash
-	
-	marketTopicData.Messages = append(marketTopicData.Messages, MarketMessages{
-		Collateral: latestCollateral + collateralTransacted,
-		Hash: latestHash + hashTransacted,
-		Timestamp: time.Now().Unix(),
-	})
-	marshaledMarketTopic, err := json.Marshal(marketTopicData)
+	var result MarketPosition
+	err = callPool("market", &result, marketIdBytes32)
 	if err != nil {
-		fmt.Println("Error marshalling market topic: ", err)
-		return false, err
+		return MarketPosition{}, err
 	}
-	topicID, err := hiero.TopicIDFromString("0.0.6514924")
+	return result, nil
+}
+
+// currentBorrowAPY is the projected borrow APY of a market, or 0 if the market can't be read.
+func currentBorrowAPY(marketId string) float64 {
+	marketState, err := getMarketState(marketId)
 	if err != nil {
-		fmt.Println("Error converting topic ID to Hedera topic ID: ", err)
-		return false, err
+		fmt.Println("Error getting market state: ", err)
+		return 0
 	}
-
-	topicMsgSubmitTx, _ := hiero.NewTopicMessageSubmitTransaction().
-		SetTransactionMemo("Market price analysis updated").
-		SetTopicID(topicID).
-		SetMessage(marshaledMarketTopic).
-		FreezeWith(u.Client)
-
-	topicMsgSubmitTxId := topicMsgSubmitTx.GetTransactionID()
-	fmt.Printf("The topic message submit transaction ID: %s\n", topicMsgSubmitTxId.String())
-	topicMsgSubmitTxSigned := topicMsgSubmitTx.Sign(privateKey)
-	topicMsgSubmitTxSubmitted, _ := topicMsgSubmitTxSigned.Execute(u.Client)
-	topicMsgSubmitTxReceipt, _ := topicMsgSubmitTxSubmitted.GetReceipt(u.Client)
-
-	topicMsgSeqNum := topicMsgSubmitTxReceipt.TopicSequenceNumber
-	fmt.Printf("Topic Message Sequence Number: %v\n", topicMsgSeqNum)
-
-	_ = u.Client.Close()
-	return true, nil
+	return marketState.BorrowAPY
 }
 
-
-
 func (u *UserHandler) getLatestMessageFromTopic(topicId string) (string, error) {
 	topicID, err := hiero.TopicIDFromString(topicId)
 	if err != nil {
@@ -852,6 +602,41 @@ func (u *UserHandler) getUserTopicId(userAccountId string) (string, error) {
 	return string(topicId), nil
 }
 
+// publishUserProfile submits the full user document as the newest message on the user's topic.
+func (u *UserHandler) publishUserProfile(topicId string, user User, memo string) error {
+	privateKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	topicID, err := hiero.TopicIDFromString(topicId)
+	if err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledUser, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	topicMsgSubmitTx, err := hiero.NewTopicMessageSubmitTransaction().
+		SetTransactionMemo(memo).
+		SetTopicID(topicID).
+		SetMessage(marshaledUser).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	topicMsgSubmitTxSubmitted, err := topicMsgSubmitTx.Sign(privateKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	topicMsgSubmitTxReceipt, err := topicMsgSubmitTxSubmitted.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Topic Message Sequence Number: %v\n", topicMsgSubmitTxReceipt.TopicSequenceNumber)
+	return nil
+}
+
 func (u *UserHandler) getUserTokenizedAssets(topicId string) ([]StockToken, error) {
 	userData, err := u.getLatestMessageFromTopic(topicId)
 	fmt.Println("User data: ", userData)
@@ -870,90 +655,67 @@ func (u *UserHandler) getUserTokenizedAssets(topicId string) ([]StockToken, erro
 	return tokenizedAssets, nil
 }
 
-func (u *UserHandler) mintAndRecordTokenizedAsset(userAccountId string, tokenizedAsset string, amountToMint float64) (bool, error) {
-	mintSuccess, err := u.mint(amountToMint)
-	if err != nil {
-		log.Fatalf("Failed to mint tokenized asset: %v", err)
-		return mintSuccess, err
-	}
-	fmt.Println("Minted tokenized asset✅")
-	recordSuccess, err := u.recordTokenizedAsset(userAccountId, tokenizedAsset, amountToMint)
-	if err != nil {
-		log.Fatalf("Failed to record tokenized asset: %v", err)
-		return recordSuccess, err
-	}
-	fmt.Println("Recorded tokenized asset✅")
-	if mintSuccess && recordSuccess {
-		fmt.Println("Successfully minted✅")
-	}
-	fmt.Printf("Mint Status: %v\n", mintSuccess)
-	fmt.Printf("Record Status: %v\n", recordSuccess)
-
-	transferSuccess, err := u.transfer(userAccountId, int64(amountToMint))
-	if err != nil {
-		log.Fatalf("Failed to transfer tokenized asset: %v", err)
-		return transferSuccess, err
-	}
-	fmt.Println("Transferred tokenized asset✅")
-
-	return mintSuccess && recordSuccess && transferSuccess, nil
-}
-
-func (u *UserHandler) mint(amountToMint float64) (bool, error) {
-	tokenId, err := hiero.TokenIDFromString(AllowedTokenizedAssetId)
+// mint mints units of the asset's token into the treasury under transactionId.
+func (u *UserHandler) mint(asset AssetRecord, amountToMint int64, transactionId hiero.TransactionID) error {
+	tokenId, err := hiero.TokenIDFromString(asset.TokenId)
 	if err != nil {
-		log.Fatalf("Failed to convert token ID to Hedera token ID: %v", err)
-		return false, err
+		return err
 	}
 	supplyKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
 	if err != nil {
-		log.Fatalf("Failed to convert token ID to Hedera token ID: %v", err)
-		return false, err
+		return err
+	}
+	if asset.MaxSupply > 0 {
+		token, err := getTokenInfo(asset.TokenId)
+		if err != nil {
+			return err
+		}
+		totalSupply, err := strconv.ParseUint(token.TotalSupply, 10, 64)
+		if err != nil {
+			return err
+		}
+		if totalSupply+uint64(amountToMint) > asset.MaxSupply {
+			return fmt.Errorf("minting %d %s would exceed its max supply of %d", amountToMint, asset.TokenSymbol, asset.MaxSupply)
+		}
 	}
 	transaction, err := hiero.NewTokenMintTransaction().
+		SetTransactionID(transactionId).
 		SetTokenID(tokenId).
 		SetAmount(uint64(amountToMint)).
 		SetMaxTransactionFee(hiero.HbarFrom(20, hiero.HbarUnits.Hbar)).
 		FreezeWith(u.Client)
-
 	if err != nil {
 		fmt.Println("Error freezing transaction: ", err)
-		return false, err
+		return err
 	}
 
 	txResponse, err := transaction.
 		Sign(supplyKey).
 		Execute(u.Client)
-
 	if err != nil {
 		fmt.Println("Error executing transaction: ", err)
-		return false, err
+		return err
 	}
 
 	receipt, err := txResponse.GetReceipt(u.Client)
-
 	if err != nil {
 		fmt.Println("Error getting receipt: ", err)
-		return false, err
+		return err
 	}
-	fmt.Println("Txn Receipt: ", receipt)
-
-	status := receipt.Status
-
-	fmt.Printf("The transaction consensus status is %v\n", status)
-
-
-	return true, nil
+	fmt.Printf("The mint transaction consensus status is %v\n", receipt.Status)
+	return nil
 }
 
-func (u *UserHandler) recordTokenizedAsset(userAccountId string, asset string, amountMinted float64) (bool, error) {
+// recordTokenizedAsset adds shares, in whole-share terms, and units, in the token's smallest
+// denomination, to the user's entry for the asset. Redemptions pass negative amounts.
+func (u *UserHandler) recordTokenizedAsset(userAccountId string, asset AssetRecord, shares decimal.Decimal, units int64, memo string, transactionId hiero.TransactionID) error {
 	privateKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
 	if err != nil {
-		return false, err
+		return err
 	}
 	// get user data from their associated topic and unmarshal it to User struct
 	if userAccountId == "" {
-		return false, errors.New("missing user account ID")
+		return errors.New("missing user account ID")
 	}
 	var topicId []byte
 	err = u.DB.View(func(txn *badger.Txn) error {
@@ -966,134 +728,160 @@ func (u *UserHandler) recordTokenizedAsset(userAccountId string, asset string, a
 		return err
 	})
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	topicID, err := hiero.TopicIDFromString(string(topicId))
 	if err != nil {
-		return false, err
+		return err
 	}
 	userData, err := u.getLatestMessageFromTopic(string(topicId))
 	if err != nil {
-		return false, err
+		return err
 	}
 	var user User
 	err = json.Unmarshal([]byte(userData), &user)
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	// obtain the user's tokenized assets field and find the tokenized being minted
 	// if it doesn't exist create a new entry and populate the tokenized asset with the symbol and amount minted
 	// if it does exist, add the amount minted to the existing entry
-	position, err := u.Alpaca.GetPosition(asset)
-	if err != nil {
-		return false, err
-	}
-	logo, err := getStockLogo(asset)
-	if err != nil {
-		return false, err
-	}
 	tokenizedAssets := user.TokenizedAssets
-	if len(tokenizedAssets) == 0 {
+	recorded := false
+	for i := range tokenizedAssets {
+		if tokenizedAssets[i].StockSymbol == asset.Symbol {
+			tokenized := &tokenizedAssets[i]
+			tokenized.normalize(asset)
+			total := decimal.NewFromFloat(tokenized.TokenizedAmount).Add(shares)
+			tokenized.TokenizedAmount = total.InexactFloat64()
+			tokenized.TokenizedUnits += units
+			recorded = true
+			break
+		}
+	}
+	if !recorded {
+		// only tokenizing adds an entry, so reversals and wipes don't need the brokerage
+		var position BrokeragePosition
+		if units > 0 {
+			brokerage, err := u.brokerage(userAccountId)
+			if err != nil {
+				return err
+			}
+			position, err = brokerage.Position(asset.Symbol)
+			if err != nil && !errors.Is(err, ErrPositionNotFound) {
+				return err
+			}
+		}
+		logo, err := getStockLogo(asset.Symbol)
+		if err != nil {
+			return err
+		}
 		tokenizedAssets = append(tokenizedAssets, StockToken{
-			StockSymbol:     asset,
+			StockSymbol:     asset.Symbol,
 			StockPrice:      position.CurrentPrice.InexactFloat64(),
 			StockChange:     position.ChangeToday.InexactFloat64(),
 			UnrealizedPL:    position.UnrealizedPL.InexactFloat64(),
 			StockLogo:       logo,
-			TokenizedAmount: amountMinted,
+			TokenizedAmount: shares.InexactFloat64(),
+			TokenizedUnits:  units,
+			TokenId:         asset.TokenId,
+			TokenDecimals:   asset.Decimals,
 		})
-		// update the user's tokenized assets field with the new tokenized asset
-		user.TokenizedAssets = tokenizedAssets
-	} else {
-		for _, tokenizedAsset := range tokenizedAssets {
-			if tokenizedAsset.StockSymbol == asset {
-				tokenizedAsset.TokenizedAmount += amountMinted
-				// update the user's tokenized assets field with the new tokenized asset
-				user.TokenizedAssets = tokenizedAssets
-				break
-			}
-		}
 	}
+	// update the user's tokenized assets field with the new tokenized asset
+	user.TokenizedAssets = tokenizedAssets
 
 	// marshal the user struct back to json and submit it to the topic
 	marshaledUser, err := json.Marshal(user)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	topicMsgSubmitTx, _ := hiero.NewTopicMessageSubmitTransaction().
-		SetTransactionMemo("Tokenized asset minted").
+	topicMsgSubmitTx, err := hiero.NewTopicMessageSubmitTransaction().
+		SetTransactionID(transactionId).
+		SetTransactionMemo(memo).
 		SetTopicID(topicID).
 		SetMessage(marshaledUser).
 		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
 
 	topicMsgSubmitTxId := topicMsgSubmitTx.GetTransactionID()
 	fmt.Printf("The topic message submit transaction ID: %s\n", topicMsgSubmitTxId.String())
 	topicMsgSubmitTxSigned := topicMsgSubmitTx.Sign(privateKey)
-	topicMsgSubmitTxSubmitted, _ := topicMsgSubmitTxSigned.Execute(u.Client)
-	topicMsgSubmitTxReceipt, _ := topicMsgSubmitTxSubmitted.GetReceipt(u.Client)
+	topicMsgSubmitTxSubmitted, err := topicMsgSubmitTxSigned.Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	topicMsgSubmitTxReceipt, err := topicMsgSubmitTxSubmitted.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("The topic message submit transaction receipt: %v\n", topicMsgSubmitTxReceipt)
-
-	return true, nil
-
+	return nil
 }
 
-func (u *UserHandler) transfer(userAccountId string, amountMinted int64) (bool, error) {
-	tokenId, err := hiero.TokenIDFromString("0.0.6509511")
+// transfer moves units of a token from the treasury to the user under transactionId.
+func (u *UserHandler) transfer(userAccountId string, assetTokenId string, amountMinted int64, transactionId hiero.TransactionID) error {
+	tokenId, err := hiero.TokenIDFromString(assetTokenId)
 	if err != nil {
 		fmt.Println("Error converting token id: ", err)
-		return false, err
+		return err
+	}
+	operatorKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
 	}
-	operatorKey, _ := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
 
 	accountId0, err := hiero.AccountIDFromString(os.Getenv("MY_ACCOUNT_ID"))
 	if err != nil {
 		fmt.Println("Error converting account id: ", err)
-		return false, err
+		return err
 	}
 	accountId1, err := hiero.AccountIDFromString(userAccountId)
 	if err != nil {
 		fmt.Println("Error converting account id: ", err)
-		return false, err
+		return err
 	}
 
 	transaction, err := hiero.NewTransferTransaction().
+		SetTransactionID(transactionId).
 		AddTokenTransfer(tokenId, accountId0, -amountMinted).
 		AddTokenTransfer(tokenId, accountId1, amountMinted).
 		FreezeWith(u.Client)
-
 	if err != nil {
 		fmt.Println("Error creating txn: ", err)
-		return false, err
+		return err
 	}
 
 	txResponse, err := transaction.Sign(operatorKey).Execute(u.Client)
-
 	if err != nil {
 		fmt.Println("Error sign txn: ", err)
-		return false, err
+		return err
 	}
 
 	receipt, err := txResponse.GetReceipt(u.Client)
 	if err != nil {
 		fmt.Println("Error get txn receipt: ", err)
-		return false, err
+		return err
 	}
-
-	status := receipt.Status
-
-	fmt.Printf("The transaction consensus status is %v\n", status)
-	return true, nil
+	fmt.Printf("The transfer transaction consensus status is %v\n", receipt.Status)
+	return nil
 }
 
-func (u *UserHandler) getUserPortfolio(topicId string) (Portfolio, error) {
-	positions, err := u.Alpaca.GetPositions()
+func (u *UserHandler) getUserPortfolio(userAccountId, topicId string) (Portfolio, error) {
+	brokerage, err := u.brokerage(userAccountId)
 	if err != nil {
 		return Portfolio{}, err
 	}
-	account, err := u.Alpaca.GetAccount()
+	positions, err := brokerage.Positions()
+	if err != nil {
+		return Portfolio{}, err
+	}
+	account, err := brokerage.Account()
 	if err != nil {
 		return Portfolio{}, err
 	}
@@ -1102,10 +890,17 @@ func (u *UserHandler) getUserPortfolio(topicId string) (Portfolio, error) {
 	if err != nil {
 		return Portfolio{}, err
 	}
+	shareLocks, err := u.ShareLocks(userAccountId)
+	if err != nil {
+		return Portfolio{}, err
+	}
+	netWorth := u.netWorth(userAccountId, positions, account, shareLocks)
 	return Portfolio{
 		PortfolioValueUSD: portfolioValueUSD,
-		OptionsAssets:     len(positions),
+		Positions:         len(positions),
 		TokenizedAssets:   len(tokenizedAssets),
+		ShareLocks:        shareLocks,
+		NetWorth:          netWorth,
 	}, nil
 }
 
@@ -1118,17 +913,10 @@ func (u *UserHandler) GrantKyc(userAccountId, tokenId string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	err = godotenv.Load(".env")
+	operatorKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
 	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	operatorKeyStr := os.Getenv("MY_PRIVATE_KEY")
-	if operatorKeyStr == "" {
-		log.Fatal("Must set MY_ACCOUNT_ID, MY_PRIVATE_KEY")
+		return false, err
 	}
-
-	operatorKey, _ := hiero.PrivateKeyFromStringEd25519(operatorKeyStr)
 	transaction, err := hiero.NewTokenGrantKycTransaction().
 		SetTokenID(tkId).
 		SetAccountID(accountId).
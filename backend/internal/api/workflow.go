@@ -0,0 +1,754 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-chi/chi/v5"
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+	"github.com/shopspring/decimal"
+)
+
+const workflowPrefix = "workflow:"
+
+const (
+	WorkflowRunning      = "running"
+	WorkflowEscrowed     = "escrowed"
+	WorkflowCompleted    = "completed"
+	WorkflowCompensating = "compensating"
+	WorkflowCompensated  = "compensated"
+	WorkflowStuck        = "stuck"
+)
+
+const (
+	StepMint     = "mint"
+	StepRecord   = "record"
+	StepTransfer = "transfer"
+	StepBurn     = "burn"
+	StepWipe     = "wipe"
+	StepUnrecord = "unrecord"
+
+	StepPending   = "pending"
+	StepSubmitted = "submitted"
+	StepDone      = "done"
+)
+
+var (
+	defaultWorkflowInterval    = 15 * time.Second
+	defaultWorkflowBackoff     = 30 * time.Second
+	defaultWorkflowMaxBackoff  = 30 * time.Minute
+	defaultWorkflowMaxAttempts = uint64(5)
+	// a transaction the mirror node has not seen this long after its valid start never
+	// reached consensus: its 120s validity window has passed, with margin for mirror lag
+	workflowSettleWindow = 3 * time.Minute
+)
+
+// errStepInFlight means a step's transaction was submitted recently and its outcome is not
+// known yet, so resubmitting it could apply it twice.
+var errStepInFlight = errors.New("step transaction not settled yet")
+
+// WorkflowStep is one transaction of a workflow. The transaction id is stored before the
+// transaction is submitted, so a step interrupted by a crash is resolved from the mirror node
+// instead of being submitted a second time.
+type WorkflowStep struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	TransactionId string `json:"transactionId,omitempty"`
+	Attempts      int    `json:"attempts"`
+	Error         string `json:"error,omitempty"`
+	CompletedAt   string `json:"completedAt,omitempty"`
+}
+
+// TokenizationWorkflow mints units of a token, records them on the user's profile topic and
+// transfers them to the user. It is escrowed, with the tokens held in the treasury, while the
+// user cannot receive them for lack of association or KYC. Undoing it burns tokens still in
+// the treasury, wipes tokens already transferred and reverses the profile record.
+type TokenizationWorkflow struct {
+	Id            string         `json:"id"`
+	UserAccountId string         `json:"userAccountId"`
+	Symbol        string         `json:"symbol"`
+	TokenId       string         `json:"tokenId"`
+	Shares        string         `json:"shares"`
+	Units         int64          `json:"units"`
+	RequestKey    string         `json:"requestKey"`
+	Status        string         `json:"status"`
+	Steps         []WorkflowStep `json:"steps"`
+	Compensation  []WorkflowStep `json:"compensation,omitempty"`
+	SharesLocked  bool           `json:"sharesLocked"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt int64          `json:"nextAttemptAt"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     string         `json:"createdAt"`
+	UpdatedAt     string         `json:"updatedAt"`
+}
+
+func (wf *TokenizationWorkflow) step(name string) *WorkflowStep {
+	for j := range wf.Steps {
+		if wf.Steps[j].Name == name {
+			return &wf.Steps[j]
+		}
+	}
+	return nil
+}
+
+func (wf *TokenizationWorkflow) done(name string) bool {
+	step := wf.step(name)
+	return step != nil && step.Status == StepDone
+}
+
+// TokenizationSaga runs tokenization workflows and resumes the unfinished ones: at start-up,
+// and every Interval for workflows whose backoff has elapsed. A workflow that fails
+// MaxAttempts times is compensated; one whose compensation fails as often is left stuck for
+// an operator. Escrowed workflows are checked every Interval without using up attempts.
+type TokenizationSaga struct {
+	Users       *UserHandler
+	Interval    time.Duration
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+func NewTokenizationSaga(users *UserHandler) *TokenizationSaga {
+	s := &TokenizationSaga{
+		Users:       users,
+		Interval:    defaultWorkflowInterval,
+		Backoff:     defaultWorkflowBackoff,
+		MaxBackoff:  defaultWorkflowMaxBackoff,
+		MaxAttempts: int(envUint64("WORKFLOW_MAX_ATTEMPTS", defaultWorkflowMaxAttempts)),
+	}
+	if interval, err := time.ParseDuration(os.Getenv("WORKFLOW_INTERVAL")); err == nil {
+		s.Interval = interval
+	}
+	if backoff, err := time.ParseDuration(os.Getenv("WORKFLOW_BACKOFF")); err == nil {
+		s.Backoff = backoff
+	}
+	return s
+}
+
+func newTransactionId() (hiero.TransactionID, error) {
+	operatorId, err := hiero.AccountIDFromString(os.Getenv("MY_ACCOUNT_ID"))
+	if err != nil {
+		return hiero.TransactionID{}, err
+	}
+	return hiero.TransactionIDGenerate(operatorId), nil
+}
+
+func putWorkflow(txn *badger.Txn, wf *TokenizationWorkflow) error {
+	wf.UpdatedAt = time.Now().Format(time.RFC3339)
+	marshaledWorkflow, err := json.Marshal(wf)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(workflowPrefix+wf.Id), marshaledWorkflow)
+}
+
+func (s *TokenizationSaga) put(wf *TokenizationWorkflow) error {
+	return s.Users.DB.Update(func(txn *badger.Txn) error {
+		return putWorkflow(txn, wf)
+	})
+}
+
+func (s *TokenizationSaga) Get(id string) (TokenizationWorkflow, error) {
+	var wf TokenizationWorkflow
+	err := s.Users.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(workflowPrefix + id))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &wf)
+		})
+	})
+	return wf, err
+}
+
+// List returns the workflows in the order they were started, optionally only those in status.
+func (s *TokenizationSaga) List(status string) ([]TokenizationWorkflow, error) {
+	workflows := []TokenizationWorkflow{}
+	err := s.Users.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(workflowPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var wf TokenizationWorkflow
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &wf)
+			})
+			if err != nil {
+				return err
+			}
+			if status == "" || wf.Status == status {
+				workflows = append(workflows, wf)
+			}
+		}
+		return nil
+	})
+	return workflows, err
+}
+
+// Start persists a workflow for units of asset and locks the shares behind them. The caller
+// advances it.
+func (s *TokenizationSaga) Start(userAccountId string, asset AssetRecord, units int64, requestKey string) (TokenizationWorkflow, error) {
+	now := time.Now()
+	wf := TokenizationWorkflow{
+		Id:            fmt.Sprintf("%020d-%s-%s", now.UnixNano(), userAccountId, asset.Symbol),
+		UserAccountId: userAccountId,
+		Symbol:        asset.Symbol,
+		TokenId:       asset.TokenId,
+		Shares:        asset.Shares(units).String(),
+		Units:         units,
+		RequestKey:    requestKey,
+		Status:        WorkflowRunning,
+		Steps: []WorkflowStep{
+			{Name: StepMint, Status: StepPending},
+			{Name: StepRecord, Status: StepPending},
+			{Name: StepTransfer, Status: StepPending},
+		},
+		SharesLocked:  true,
+		NextAttemptAt: now.Unix(),
+		CreatedAt:     now.Format(time.RFC3339),
+	}
+	err := s.Users.DB.Update(func(txn *badger.Txn) error {
+		err := adjustShareLock(txn, userAccountId, asset, units)
+		if err != nil {
+			return err
+		}
+		return putWorkflow(txn, &wf)
+	})
+	return wf, err
+}
+
+// settle resolves a step whose transaction was submitted but whose outcome was not recorded.
+// It reports whether the transaction succeeded; a transaction that failed or never reached
+// consensus can be submitted again under a new id.
+func settle(step *WorkflowStep) (bool, error) {
+	transaction, found, err := getMirrorTransaction(step.TransactionId)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		if transaction.Result == "SUCCESS" {
+			return true, nil
+		}
+		step.Error = transaction.Result
+		return false, nil
+	}
+	transactionId, err := hiero.TransactionIdFromString(step.TransactionId)
+	if err != nil || transactionId.ValidStart == nil {
+		return false, err
+	}
+	if time.Since(*transactionId.ValidStart) < workflowSettleWindow {
+		return false, errStepInFlight
+	}
+	return false, nil
+}
+
+// runStep executes a step once. The transaction id is persisted with put before submission.
+func runStep(step *WorkflowStep, put func() error, execute func(hiero.TransactionID) error) error {
+	if step.Status == StepDone {
+		return nil
+	}
+	if step.Status == StepSubmitted {
+		succeeded, err := settle(step)
+		if err != nil {
+			return err
+		}
+		if succeeded {
+			step.Status = StepDone
+			step.Error = ""
+			step.CompletedAt = time.Now().Format(time.RFC3339)
+			return put()
+		}
+	}
+
+	transactionId, err := newTransactionId()
+	if err != nil {
+		return err
+	}
+	step.Status = StepSubmitted
+	step.TransactionId = transactionId.String()
+	step.Attempts++
+	err = put()
+	if err != nil {
+		return err
+	}
+	err = execute(transactionId)
+	if err != nil {
+		step.Error = err.Error()
+		// a failed receipt means the transaction reached consensus and did nothing, so the
+		// step can be resubmitted; any other error leaves its outcome to settle
+		var receiptErr hiero.ErrHederaReceiptStatus
+		if errors.As(err, &receiptErr) {
+			step.Status = StepPending
+		}
+		_ = put()
+		return err
+	}
+	step.Status = StepDone
+	step.Error = ""
+	step.CompletedAt = time.Now().Format(time.RFC3339)
+	return put()
+}
+
+// runStep runs a step of wf, persisting the workflow around it.
+func (s *TokenizationSaga) runStep(wf *TokenizationWorkflow, step *WorkflowStep, execute func(hiero.TransactionID) error) error {
+	return runStep(step, func() error { return s.put(wf) }, execute)
+}
+
+func (s *TokenizationSaga) forward(wf *TokenizationWorkflow, asset AssetRecord) error {
+	shares, err := decimal.NewFromString(wf.Shares)
+	if err != nil {
+		return err
+	}
+	for j := range wf.Steps {
+		step := &wf.Steps[j]
+		var execute func(hiero.TransactionID) error
+		switch step.Name {
+		case StepMint:
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.mint(asset, wf.Units, transactionId)
+			}
+		case StepRecord:
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.recordTokenizedAsset(wf.UserAccountId, asset, shares, wf.Units, "Tokenized asset minted", transactionId)
+			}
+		case StepTransfer:
+			if step.Status == StepPending {
+				err := s.Users.readyForTransfer(wf.UserAccountId, asset)
+				if err != nil {
+					return fmt.Errorf("%s: %w", step.Name, err)
+				}
+			}
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.transfer(wf.UserAccountId, asset.TokenId, wf.Units, transactionId)
+			}
+		}
+		err := s.runStep(wf, step, execute)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+		if step.Name == StepTransfer {
+			err = s.Users.putPendingMint(wf.UserAccountId, PendingMint{
+				Id:            wf.Id,
+				Symbol:        wf.Symbol,
+				Units:         wf.Units,
+				RequestKey:    wf.RequestKey,
+				TransactionId: step.TransactionId,
+				CreatedAt:     wf.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compensationSteps undoes what the forward steps did, last step first: tokens the user
+// received are wiped, a profile record is reversed, and tokens still in the treasury are
+// burned.
+func compensationSteps(wf *TokenizationWorkflow) []WorkflowStep {
+	steps := []WorkflowStep{}
+	if wf.done(StepTransfer) {
+		steps = append(steps, WorkflowStep{Name: StepWipe, Status: StepPending})
+	}
+	if wf.done(StepRecord) {
+		steps = append(steps, WorkflowStep{Name: StepUnrecord, Status: StepPending})
+	}
+	if wf.done(StepMint) && !wf.done(StepTransfer) {
+		steps = append(steps, WorkflowStep{Name: StepBurn, Status: StepPending})
+	}
+	return steps
+}
+
+func (s *TokenizationSaga) compensate(wf *TokenizationWorkflow, asset AssetRecord) error {
+	shares, err := decimal.NewFromString(wf.Shares)
+	if err != nil {
+		return err
+	}
+	for j := range wf.Compensation {
+		step := &wf.Compensation[j]
+		var execute func(hiero.TransactionID) error
+		switch step.Name {
+		case StepBurn:
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.burn(asset.TokenId, wf.Units, transactionId)
+			}
+		case StepWipe:
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.wipe(wf.UserAccountId, asset.TokenId, wf.Units, transactionId)
+			}
+		case StepUnrecord:
+			execute = func(transactionId hiero.TransactionID) error {
+				return s.Users.recordTokenizedAsset(wf.UserAccountId, asset, shares.Neg(), -wf.Units, "Tokenized asset reversed", transactionId)
+			}
+		}
+		err := s.runStep(wf, step, execute)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+	}
+	// the units no longer circulate, so tokenization should not count them and their shares
+	// are released
+	return s.Users.DB.Update(func(txn *badger.Txn) error {
+		if wf.SharesLocked {
+			err := adjustShareLock(txn, wf.UserAccountId, asset, -wf.Units)
+			if err != nil {
+				return err
+			}
+			wf.SharesLocked = false
+			err = putWorkflow(txn, wf)
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Delete([]byte(tokenizePendingKey(wf.UserAccountId, wf.Symbol, wf.Id)))
+	})
+}
+
+func (s *TokenizationSaga) backoff(attempts int) time.Duration {
+	backoff := s.Backoff << min(attempts-1, 16)
+	return min(backoff, s.MaxBackoff)
+}
+
+// Advance runs a workflow from where it stopped until it finishes or a step fails, and
+// schedules the next attempt on failure.
+func (s *TokenizationSaga) Advance(wf *TokenizationWorkflow) error {
+	asset, err := s.Users.Assets.Get(wf.Symbol)
+	if err != nil {
+		return err
+	}
+	switch wf.Status {
+	case WorkflowRunning, WorkflowEscrowed:
+		err = s.forward(wf, asset)
+		if err == nil {
+			wf.Status = WorkflowCompleted
+			wf.Error = ""
+			return s.put(wf)
+		}
+		if errors.Is(err, errAwaitingOnboarding) {
+			wf.Status = WorkflowEscrowed
+			wf.Error = err.Error()
+			wf.NextAttemptAt = time.Now().Add(s.Interval).Unix()
+			_ = s.put(wf)
+			return err
+		}
+	case WorkflowCompensating:
+		err = s.compensate(wf, asset)
+		if err == nil {
+			wf.Status = WorkflowCompensated
+			return s.put(wf)
+		}
+	default:
+		return nil
+	}
+
+	fmt.Println("Error advancing workflow ", wf.Id, ": ", err)
+	wf.Error = err.Error()
+	if errors.Is(err, errStepInFlight) {
+		wf.NextAttemptAt = time.Now().Add(s.Interval).Unix()
+		_ = s.put(wf)
+		return err
+	}
+	wf.Attempts++
+	wf.NextAttemptAt = time.Now().Add(s.backoff(wf.Attempts)).Unix()
+	if wf.Attempts >= s.MaxAttempts {
+		if wf.Status == WorkflowRunning || wf.Status == WorkflowEscrowed {
+			compensationErr := s.startCompensation(wf)
+			if compensationErr != nil {
+				fmt.Println("Error starting compensation of workflow ", wf.Id, ": ", compensationErr)
+			}
+		} else {
+			wf.Status = WorkflowStuck
+		}
+	}
+	_ = s.put(wf)
+	return err
+}
+
+// startCompensation settles the forward steps whose outcome is unknown, so compensation
+// covers everything that happened, and switches the workflow to compensating.
+func (s *TokenizationSaga) startCompensation(wf *TokenizationWorkflow) error {
+	for j := range wf.Steps {
+		step := &wf.Steps[j]
+		if step.Status != StepSubmitted {
+			continue
+		}
+		succeeded, err := settle(step)
+		if err != nil {
+			return err
+		}
+		step.Status = StepPending
+		if succeeded {
+			step.Status = StepDone
+			step.CompletedAt = time.Now().Format(time.RFC3339)
+		}
+	}
+	wf.Status = WorkflowCompensating
+	wf.Compensation = compensationSteps(wf)
+	wf.Attempts = 0
+	wf.NextAttemptAt = time.Now().Unix()
+	return nil
+}
+
+// latest re-reads a workflow listed before tokenizeMu was taken, so it continues from what
+// other runs did meanwhile, and reports whether it is still in one of statuses.
+func (s *TokenizationSaga) latest(wf *TokenizationWorkflow, statuses ...string) (bool, error) {
+	stored, err := s.Get(wf.Id)
+	if err != nil {
+		return false, err
+	}
+	*wf = stored
+	return slices.Contains(statuses, wf.Status), nil
+}
+
+// Resume advances every workflow whose next attempt is due.
+func (s *TokenizationSaga) Resume() error {
+	workflows, err := s.List("")
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, wf := range workflows {
+		if (wf.Status != WorkflowRunning && wf.Status != WorkflowEscrowed && wf.Status != WorkflowCompensating) || wf.NextAttemptAt > now {
+			continue
+		}
+		tokenizeMu.Lock()
+		ok, err := s.latest(&wf, WorkflowRunning, WorkflowEscrowed, WorkflowCompensating)
+		if err == nil && ok && wf.NextAttemptAt <= now {
+			_ = s.Advance(&wf)
+		}
+		tokenizeMu.Unlock()
+	}
+	return nil
+}
+
+// AdvanceLater advances workflows in the background, one at a time under tokenizeMu, so a
+// request that started them does not wait on their transactions.
+func (s *TokenizationSaga) AdvanceLater(ids ...string) {
+	go func() {
+		for _, id := range ids {
+			tokenizeMu.Lock()
+			wf := TokenizationWorkflow{Id: id}
+			ok, err := s.latest(&wf, WorkflowRunning, WorkflowEscrowed, WorkflowCompensating)
+			if err == nil && ok {
+				// failures are retried by Resume
+				_ = s.Advance(&wf)
+			}
+			tokenizeMu.Unlock()
+			if err != nil {
+				fmt.Println("Error getting workflow ", id, ": ", err)
+			}
+		}
+	}()
+}
+
+// Cancel compensates a user's escrowed workflows, whose tokens they can no longer receive.
+func (s *TokenizationSaga) Cancel(userAccountId string) error {
+	workflows, err := s.List(WorkflowEscrowed)
+	if err != nil {
+		return err
+	}
+	for _, wf := range workflows {
+		if wf.UserAccountId != userAccountId {
+			continue
+		}
+		tokenizeMu.Lock()
+		ok, err := s.latest(&wf, WorkflowEscrowed)
+		if err == nil && ok {
+			err = s.startCompensation(&wf)
+			if err == nil {
+				err = s.Advance(&wf)
+			}
+		}
+		tokenizeMu.Unlock()
+		if err != nil {
+			fmt.Println("Error cancelling workflow ", wf.Id, ": ", err)
+		}
+	}
+	return nil
+}
+
+// Release advances a user's escrowed workflows now rather than at their next check.
+func (s *TokenizationSaga) Release(userAccountId string) error {
+	workflows, err := s.List(WorkflowEscrowed)
+	if err != nil {
+		return err
+	}
+	for _, wf := range workflows {
+		if wf.UserAccountId != userAccountId {
+			continue
+		}
+		tokenizeMu.Lock()
+		ok, err := s.latest(&wf, WorkflowEscrowed)
+		if err == nil && ok {
+			err = s.Advance(&wf)
+		}
+		tokenizeMu.Unlock()
+		if err != nil && !errors.Is(err, errAwaitingOnboarding) {
+			fmt.Println("Error releasing workflow ", wf.Id, ": ", err)
+		}
+	}
+	return nil
+}
+
+func (s *TokenizationSaga) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		err := s.Resume()
+		if err != nil {
+			fmt.Println("Error resuming workflows: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *UserHandler) wipe(userAccountId string, assetTokenId string, units int64, transactionId hiero.TransactionID) error {
+	tokenId, err := hiero.TokenIDFromString(assetTokenId)
+	if err != nil {
+		return err
+	}
+	accountId, err := hiero.AccountIDFromString(userAccountId)
+	if err != nil {
+		return err
+	}
+	wipeKey, err := hiero.PrivateKeyFromStringEd25519(os.Getenv("MY_PRIVATE_KEY"))
+	if err != nil {
+		return err
+	}
+	transaction, err := hiero.NewTokenWipeTransaction().
+		SetTransactionID(transactionId).
+		SetTokenID(tokenId).
+		SetAccountID(accountId).
+		SetAmount(uint64(units)).
+		FreezeWith(u.Client)
+	if err != nil {
+		return err
+	}
+	txResponse, err := transaction.Sign(wipeKey).Execute(u.Client)
+	if err != nil {
+		return err
+	}
+	receipt, err := txResponse.GetReceipt(u.Client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The wipe transaction consensus status is %v\n", receipt.Status)
+	return nil
+}
+
+func (s *TokenizationSaga) writeWorkflow(w http.ResponseWriter, wf TokenizationWorkflow, err error) {
+	if err != nil && !errors.Is(err, errStepInFlight) && !errors.Is(err, errAwaitingOnboarding) {
+		fmt.Println("Error advancing workflow: ", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]TokenizationWorkflow{
+		"workflow": wf,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode workflow", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *TokenizationSaga) requestWorkflow(w http.ResponseWriter, r *http.Request) (TokenizationWorkflow, bool) {
+	wf, err := s.Get(chi.URLParam(r, "workflowId"))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return wf, false
+	}
+	if err != nil {
+		fmt.Println("Error getting workflow: ", err)
+		http.Error(w, "Failed to get workflow", http.StatusInternalServerError)
+		return wf, false
+	}
+	return wf, true
+}
+
+func (s *TokenizationSaga) HandleListWorkflows(w http.ResponseWriter, r *http.Request) {
+	workflows, err := s.List(r.URL.Query().Get("status"))
+	if err != nil {
+		fmt.Println("Error listing workflows: ", err)
+		http.Error(w, "Failed to list workflows", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string][]TokenizationWorkflow{
+		"workflows": workflows,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode workflows", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *TokenizationSaga) HandleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf, ok := s.requestWorkflow(w, r)
+	if !ok {
+		return
+	}
+	s.writeWorkflow(w, wf, nil)
+}
+
+// HandleRetryWorkflow gives a stuck or failing workflow a fresh set of attempts in the
+// direction it was going.
+func (s *TokenizationSaga) HandleRetryWorkflow(w http.ResponseWriter, r *http.Request) {
+	tokenizeMu.Lock()
+	defer tokenizeMu.Unlock()
+	wf, ok := s.requestWorkflow(w, r)
+	if !ok {
+		return
+	}
+	switch wf.Status {
+	case WorkflowCompleted, WorkflowCompensated:
+		http.Error(w, "Workflow already finished", http.StatusConflict)
+		return
+	case WorkflowStuck:
+		wf.Status = WorkflowCompensating
+	}
+	wf.Attempts = 0
+	wf.NextAttemptAt = time.Now().Unix()
+	err := s.Advance(&wf)
+	s.writeWorkflow(w, wf, err)
+}
+
+// HandleCompensateWorkflow undoes a workflow, including one that completed.
+func (s *TokenizationSaga) HandleCompensateWorkflow(w http.ResponseWriter, r *http.Request) {
+	tokenizeMu.Lock()
+	defer tokenizeMu.Unlock()
+	wf, ok := s.requestWorkflow(w, r)
+	if !ok {
+		return
+	}
+	switch wf.Status {
+	case WorkflowCompensated:
+		http.Error(w, "Workflow already compensated", http.StatusConflict)
+		return
+	case WorkflowRunning, WorkflowEscrowed, WorkflowCompleted:
+		err := s.startCompensation(&wf)
+		if err != nil {
+			fmt.Println("Error starting compensation: ", err)
+			http.Error(w, "Workflow has a transaction in flight, try again shortly", http.StatusConflict)
+			return
+		}
+	case WorkflowStuck:
+		wf.Status = WorkflowCompensating
+		wf.Attempts = 0
+	}
+	err := s.Advance(&wf)
+	s.writeWorkflow(w, wf, err)
+}
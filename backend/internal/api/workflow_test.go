@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	hiero "github.com/hiero-ledger/hiero-sdk-go/v2/sdk"
+)
+
+// stubMirror points the mirror node at a server that reports results, keyed by SDK
+// transaction id, and has not ingested any other transaction.
+func stubMirror(t *testing.T, results map[string]string) {
+	t.Helper()
+	byPath := map[string]string{}
+	for transactionId, result := range results {
+		byPath[mirrorTransactionId(transactionId)] = result
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, ok := byPath[path.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(TransactionsMNAPIResponse{
+			Transactions: []MirrorTransaction{{Result: result}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	previous := MirrorNodeURL
+	MirrorNodeURL = server.URL
+	t.Cleanup(func() { MirrorNodeURL = previous })
+}
+
+var testOperator = hiero.AccountID{Account: 1001}
+
+func submittedAt(validStart time.Time) string {
+	return hiero.NewTransactionIDWithValidStart(testOperator, validStart).String()
+}
+
+func TestRunStep(t *testing.T) {
+	t.Setenv("MY_ACCOUNT_ID", testOperator.String())
+	succeeded := submittedAt(time.Now().Add(-time.Minute))
+	failed := submittedAt(time.Now().Add(-2 * time.Minute))
+	inFlight := submittedAt(time.Now())
+	stubMirror(t, map[string]string{succeeded: "SUCCESS", failed: "INSUFFICIENT_TX_FEE"})
+
+	tests := []struct {
+		name         string
+		step         WorkflowStep
+		executeErr   error
+		wantErr      error
+		wantStatus   string
+		wantExecuted bool
+		wantSameId   bool
+		wantAttempts int
+	}{
+		{
+			name:         "submits a pending step",
+			step:         WorkflowStep{Name: StepMint, Status: StepPending},
+			wantStatus:   StepDone,
+			wantExecuted: true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "failed receipt leaves the step to resubmit",
+			step:         WorkflowStep{Name: StepMint, Status: StepPending},
+			executeErr:   hiero.ErrHederaReceiptStatus{Status: hiero.StatusInvalidSignature},
+			wantStatus:   StepPending,
+			wantExecuted: true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "unknown outcome leaves the step to settle",
+			step:         WorkflowStep{Name: StepMint, Status: StepPending},
+			executeErr:   errors.New("receipt timed out"),
+			wantStatus:   StepSubmitted,
+			wantExecuted: true,
+			wantAttempts: 1,
+		},
+		{
+			name:       "done step is skipped",
+			step:       WorkflowStep{Name: StepMint, Status: StepDone, TransactionId: succeeded, Attempts: 1},
+			wantStatus: StepDone,
+			wantSameId: true,
+			// not submitted again
+			wantAttempts: 1,
+		},
+		{
+			name:         "resumes a stored transaction that succeeded",
+			step:         WorkflowStep{Name: StepMint, Status: StepSubmitted, TransactionId: succeeded, Attempts: 1},
+			wantStatus:   StepDone,
+			wantSameId:   true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "resubmits a stored transaction that failed",
+			step:         WorkflowStep{Name: StepMint, Status: StepSubmitted, TransactionId: failed, Attempts: 1},
+			wantStatus:   StepDone,
+			wantExecuted: true,
+			wantAttempts: 2,
+		},
+		{
+			name:         "waits for a stored transaction in flight",
+			step:         WorkflowStep{Name: StepMint, Status: StepSubmitted, TransactionId: inFlight, Attempts: 1},
+			wantErr:      errStepInFlight,
+			wantStatus:   StepSubmitted,
+			wantSameId:   true,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := tt.step
+			storedId := step.TransactionId
+			var persisted []WorkflowStep
+			put := func() error {
+				persisted = append(persisted, step)
+				return nil
+			}
+			executed := false
+			err := runStep(&step, put, func(transactionId hiero.TransactionID) error {
+				executed = true
+				// the id must be stored before the transaction goes out
+				if len(persisted) == 0 {
+					t.Fatal("step submitted before it was persisted")
+				}
+				last := persisted[len(persisted)-1]
+				if last.Status != StepSubmitted || last.TransactionId != transactionId.String() {
+					t.Errorf("persisted %s %q before submitting %s", last.Status, last.TransactionId, transactionId)
+				}
+				return tt.executeErr
+			})
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && tt.executeErr == nil && err != nil {
+				t.Errorf("err = %v", err)
+			}
+			if step.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", step.Status, tt.wantStatus)
+			}
+			if executed != tt.wantExecuted {
+				t.Errorf("executed = %v, want %v", executed, tt.wantExecuted)
+			}
+			if (step.TransactionId == storedId) != tt.wantSameId {
+				t.Errorf("transaction id %q, stored %q", step.TransactionId, storedId)
+			}
+			if step.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", step.Attempts, tt.wantAttempts)
+			}
+			if n := len(persisted); n > 0 && persisted[n-1] != step {
+				t.Errorf("last persisted %+v, want %+v", persisted[n-1], step)
+			}
+		})
+	}
+}
+
+func TestSettle(t *testing.T) {
+	succeeded := submittedAt(time.Now().Add(-time.Minute))
+	failed := submittedAt(time.Now().Add(-2 * time.Minute))
+	stubMirror(t, map[string]string{succeeded: "SUCCESS", failed: "INVALID_SIGNATURE"})
+
+	tests := []struct {
+		name          string
+		transactionId string
+		want          bool
+		wantErr       error
+		wantError     string
+	}{
+		{name: "succeeded", transactionId: succeeded, want: true},
+		{name: "failed", transactionId: failed, wantError: "INVALID_SIGNATURE"},
+		{name: "not ingested within its validity window", transactionId: submittedAt(time.Now()), wantErr: errStepInFlight},
+		{name: "never reached consensus", transactionId: submittedAt(time.Now().Add(-workflowSettleWindow - time.Minute))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := WorkflowStep{Name: StepTransfer, Status: StepSubmitted, TransactionId: tt.transactionId}
+			got, err := settle(&step)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("settle = %v, want %v", got, tt.want)
+			}
+			if step.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", step.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := &TokenizationSaga{Backoff: 30 * time.Second, MaxBackoff: 30 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 6, want: 16 * time.Minute},
+		{attempts: 7, want: 30 * time.Minute},
+		// the shift is capped, so many attempts cannot overflow
+		{attempts: 100, want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func testWorkflow(statuses ...string) TokenizationWorkflow {
+	wf := TokenizationWorkflow{Id: "wf", Status: WorkflowRunning}
+	for j, name := range []string{StepMint, StepRecord, StepTransfer} {
+		status := StepPending
+		if j < len(statuses) {
+			status = statuses[j]
+		}
+		wf.Steps = append(wf.Steps, WorkflowStep{Name: name, Status: status})
+	}
+	return wf
+}
+
+func stepNames(steps []WorkflowStep) []string {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestCompensationSteps(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     []string
+	}{
+		{name: "nothing done", want: []string{}},
+		{name: "minted", statuses: []string{StepDone}, want: []string{StepBurn}},
+		{name: "minted and recorded", statuses: []string{StepDone, StepDone}, want: []string{StepUnrecord, StepBurn}},
+		{name: "transferred", statuses: []string{StepDone, StepDone, StepDone}, want: []string{StepWipe, StepUnrecord}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := testWorkflow(tt.statuses...)
+			got := stepNames(compensationSteps(&wf))
+			if len(got) != len(tt.want) {
+				t.Fatalf("compensation = %v, want %v", got, tt.want)
+			}
+			for j := range got {
+				if got[j] != tt.want[j] {
+					t.Fatalf("compensation = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStartCompensationSettlesFailedStep(t *testing.T) {
+	failed := submittedAt(time.Now().Add(-time.Minute))
+	succeeded := submittedAt(time.Now().Add(-2 * time.Minute))
+	stubMirror(t, map[string]string{failed: "ACCOUNT_FROZEN_FOR_TOKEN", succeeded: "SUCCESS"})
+
+	tests := []struct {
+		name     string
+		transfer string
+		want     []string
+	}{
+		// the failed transfer needs no undoing; the steps before it are undone last first
+		{name: "transfer failed", transfer: failed, want: []string{StepUnrecord, StepBurn}},
+		{name: "transfer succeeded", transfer: succeeded, want: []string{StepWipe, StepUnrecord}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := testWorkflow(StepDone, StepDone, StepSubmitted)
+			wf.Steps[2].TransactionId = tt.transfer
+			wf.Attempts = 5
+			s := &TokenizationSaga{}
+			err := s.startCompensation(&wf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wf.Status != WorkflowCompensating || wf.Attempts != 0 {
+				t.Errorf("status %s after %d attempts, want compensating with none", wf.Status, wf.Attempts)
+			}
+			got := stepNames(wf.Compensation)
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("compensation = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
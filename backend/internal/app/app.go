@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
 	badger "github.com/dgraph-io/badger/v4"
 	"github.com/divin3circle/hashrexa/backend/internal/api"
 	"github.com/divin3circle/hashrexa/backend/internal/store"
@@ -16,7 +17,25 @@ import (
 
 type Application struct {
 	Logger *log.Logger
+	Auth *api.Authenticator
 	UserHandler *api.UserHandler
+	LoansHandler *api.LoansHandler
+	StocksHandler *api.StocksHandler
+	Markets *api.MarketRegistry
+	Assets *api.AssetRegistry
+	Credentials *api.BrokerageCredentialStore
+	AlpacaOAuth *api.AlpacaOAuth
+	Keeper *api.LiquidationKeeper
+	Indexer *api.EventIndexer
+	LoanReconciler *api.LoanReconciler
+	Oracle *api.OraclePublisher
+	Session *api.MarketSessionTracker
+	PriceFeed *api.PriceAnalysisFeed
+	Saga *api.TokenizationSaga
+	ShareLocks *api.ShareLockMonitor
+	Hub *api.StreamHub
+	Stream *api.AlpacaStream
+	Reserves *api.ReserveAttestor
 	DB *badger.DB
 	Client *hiero.Client
 	Alpaca *alpaca.Client
@@ -52,17 +71,70 @@ func NewApplication() (*Application, error) {
 		BaseURL:   "https://paper-api.alpaca.markets",
 	})
 
+	marketDataClient := marketdata.NewClient(marketdata.ClientOpts{
+		APIKey:    os.Getenv("ALPACA_API_KEY"),
+		APISecret: os.Getenv("ALPACA_API_SECRET"),
+	})
+
 	db, err := store.Open("/tmp/badgerdb3")
 	if err != nil {
 		return nil, err
 	}
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
-	uh := api.NewUserHandler(db, client, alpacaClient)
+	auth := api.NewAuthenticator(db)
+	assets := api.NewAssetRegistry(db)
+	session := api.NewMarketSessionTracker(alpacaClient, assets)
+	credentials := api.NewBrokerageCredentialStore(db, marketDataClient)
+	alpacaOAuth := api.NewAlpacaOAuth(db, credentials, auth)
+	uh := api.NewUserHandler(db, client, assets, credentials)
+	uh.Session = session
+	markets := api.NewMarketRegistry(db)
+	uh.Markets = markets
+	saga := api.NewTokenizationSaga(uh)
+	uh.Saga = saga
+	shareLocks := api.NewShareLockMonitor(uh)
+	hub := api.NewStreamHub(auth)
+	alpacaStream := api.NewAlpacaStream(credentials, assets, shareLocks, hub)
+	lh := api.NewLoansHandler(db, client, markets, session)
+	stocks := api.NewStocksHandler(db, alpacaClient, marketDataClient, assets)
+	indexer, err := api.NewEventIndexer(db)
+	if err != nil {
+		return nil, err
+	}
+	keeper := api.NewLiquidationKeeper(db, markets, session, indexer)
+	reconciler := api.NewLoanReconciler(uh, indexer)
+	priceFeed := api.NewPriceAnalysisFeed(uh, indexer, markets)
+	indexer.Subscribe(func() {
+		err := priceFeed.Apply()
+		if err != nil {
+			fmt.Println("Error updating price analysis: ", err)
+		}
+	})
+	oracle := api.NewOraclePublisher(db, marketDataClient, markets, assets, session)
+	reserves := api.NewReserveAttestor(db, api.NewAlpacaBrokerage(alpacaClient, marketDataClient), assets, credentials)
 
 	app := &Application{
 		Logger: logger,
+		Auth: auth,
 		UserHandler: uh,
+		LoansHandler: lh,
+		StocksHandler: stocks,
+		Markets: markets,
+		Assets: assets,
+		Credentials: credentials,
+		AlpacaOAuth: alpacaOAuth,
+		Keeper: keeper,
+		Indexer: indexer,
+		LoanReconciler: reconciler,
+		Oracle: oracle,
+		Session: session,
+		PriceFeed: priceFeed,
+		Saga: saga,
+		ShareLocks: shareLocks,
+		Hub: hub,
+		Stream: alpacaStream,
+		Reserves: reserves,
 		DB: db,
 		Client: client,
 		Alpaca: alpacaClient,
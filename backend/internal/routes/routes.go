@@ -3,6 +3,7 @@ package routes
 import (
 	"net/http"
 
+	"github.com/divin3circle/hashrexa/backend/internal/api"
 	"github.com/divin3circle/hashrexa/backend/internal/app"
 	"github.com/go-chi/chi/v5"
 )
@@ -14,7 +15,8 @@ func SetUpRoutes(app *app.Application) *chi.Mux {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -28,20 +30,84 @@ func SetUpRoutes(app *app.Application) *chi.Mux {
 	// app routes
 	r.Get("/health", app.HealthCheck)
 
+	// auth routes
+	r.Post("/auth/challenge/{userAccountId}", app.Auth.HandleChallenge)
+	r.Post("/auth/session/{userAccountId}", app.Auth.HandleSignIn)
+	r.Delete("/auth/session", app.Auth.HandleSignOut)
+
 	// user routes
-	r.Post("/auth/register/{userAccountId}/{topicId}", app.UserHandler.HandleRegisterUser)
 	r.Get("/topics/exists/{userAccountId}", app.UserHandler.HandleCheckTopicExists)
-	r.Get("/positions", app.UserHandler.HandleGetUserPositions)
 	r.Get("/tokenized-assets/{userAccountId}", app.UserHandler.HandleGetUserTokenizedAssets)
-	r.Get("/portfolio/{userAccountId}", app.UserHandler.HandleGetUserPortfolio)
 	r.Get("/stock-logo/{stockSymbol}", app.UserHandler.HandleGetStockLogo)
-	r.Get("/portfolio-history", app.UserHandler.HandlePortfolioHistory)
-	r.Get("/tokenize-portfolio/{userAccountId}", app.UserHandler.HandleTokenizePortfolio)
-	r.Get("/personal-information/{userAccountId}", app.UserHandler.HandleGetUserPersonalInformation)
-	r.Post("/personal-information/{userAccountId}", app.UserHandler.HandleUpdateUserPersonalInformation)
+	r.Get("/brokerage/alpaca/callback", app.AlpacaOAuth.HandleCallback)
+
+	// routes that read or act on the user's profile or brokerage account, for the signed-in
+	// user only
+	r.Group(func(r chi.Router) {
+		r.Use(app.Auth.RequireUser)
+		r.Post("/auth/register/{userAccountId}/{topicId}", app.UserHandler.HandleRegisterUser)
+		r.Get("/personal-information/{userAccountId}", app.UserHandler.HandleGetUserPersonalInformation)
+		r.Post("/personal-information/{userAccountId}", app.UserHandler.HandleUpdateUserPersonalInformation)
+		r.Get("/positions/{userAccountId}", app.UserHandler.HandleGetUserPositions)
+		r.Get("/portfolio/{userAccountId}", app.UserHandler.HandleGetUserPortfolio)
+		r.Get("/portfolio-history/{userAccountId}", app.UserHandler.HandlePortfolioHistory)
+		r.Post("/brokerage/{userAccountId}", app.UserHandler.HandleLinkBrokerage)
+		r.Delete("/brokerage/{userAccountId}", app.UserHandler.HandleUnlinkBrokerage)
+		r.Post("/brokerage/{userAccountId}/holdings", app.UserHandler.HandleUploadHoldings)
+		r.Get("/brokerage/{userAccountId}/holdings", app.UserHandler.HandleGetHoldings)
+		r.Get("/brokerage/status", app.AlpacaOAuth.HandleStatus)
+		r.Get("/brokerage/alpaca/connect", app.AlpacaOAuth.HandleConnect)
+		r.Post("/tokenize-portfolio/{userAccountId}", app.UserHandler.HandleTokenizePortfolio)
+		r.Post("/redeem/{userAccountId}", app.UserHandler.HandleRedeem)
+		r.Get("/redemptions/{userAccountId}", app.UserHandler.HandleGetRedemptions)
+		r.Get("/onboarding/{userAccountId}", app.UserHandler.HandleGetOnboarding)
+		r.Post("/user-loan-status/{userAccountId}", app.LoanReconciler.HandleReconcileUserLoanStatus)
+		r.Post("/loans/{marketId}/loan-status/{userAccountId}", app.LoanReconciler.HandleReconcileUserLoanStatus)
+	})
 	r.Get("/market-price-analysis", app.UserHandler.HandleGetMarketPriceAnalysis)
 	r.Get("/user-position/{userAccountId}", app.UserHandler.HandleGetUserPosition)
-	r.Post("/user-loan-status/{userAccountId}", app.UserHandler.HandleUpdateUserLoanStatus)
 	r.Get("/user-loan-status/{userAccountId}", app.UserHandler.HandleGetUserLoanStatus)
+
+	// loan routes
+	r.Get("/market", app.LoansHandler.HandleGetMarket)
+	r.Get("/liquidations", app.Keeper.HandleGetLiquidations)
+	r.Get("/user-activity/{address}", app.Indexer.HandleGetUserActivity)
+	r.Get("/market-volume/{marketId}", app.Indexer.HandleGetMarketVolume)
+	r.Get("/markets", app.Markets.HandleListMarkets)
+	r.Get("/markets/{marketId}", app.LoansHandler.HandleGetMarket)
+	r.Get("/loans/{marketId}/position/{userAccountId}", app.LoansHandler.HandleGetPosition)
+	r.Get("/loans/{marketId}/liquidations", app.Keeper.HandleGetLiquidations)
+	r.Post("/loans/{marketId}/simulate", app.LoansHandler.HandleSimulate)
+
+	// asset routes
+	r.Get("/assets", app.Assets.HandleListAssets)
+
+	// stock routes
+	r.Get("/stocks", app.StocksHandler.HandleListStocks)
+	r.Get("/stocks/{symbol}/quote", app.StocksHandler.HandleGetQuote)
+	r.Get("/stocks/{symbol}/bars", app.StocksHandler.HandleGetBars)
+
+	// oracle routes
+	r.Get("/oracle/{symbol}", app.Oracle.HandleGetOraclePrice)
+	r.Get("/reserves", app.Reserves.HandleGetReserves)
+
+	// stream routes
+	r.Get("/stream", app.Hub.HandleStream)
+
+	// admin routes
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(api.AdminOnly)
+		r.Post("/markets", app.Markets.HandleCreateMarket)
+		r.Get("/assets", app.Assets.HandleListAssets)
+		r.Post("/assets", app.Assets.HandleCreateAsset)
+		r.Put("/assets/{symbol}", app.Assets.HandleUpdateAsset)
+		r.Get("/workflows", app.Saga.HandleListWorkflows)
+		r.Get("/workflows/{workflowId}", app.Saga.HandleGetWorkflow)
+		r.Post("/workflows/{workflowId}/retry", app.Saga.HandleRetryWorkflow)
+		r.Post("/workflows/{workflowId}/compensate", app.Saga.HandleCompensateWorkflow)
+		r.Post("/kyc/{userAccountId}", app.UserHandler.HandleUpdateKyc)
+		r.Get("/share-locks", app.ShareLocks.HandleListShareLocks)
+		r.Post("/holdings/{userAccountId}/attest", app.UserHandler.HandleAttestHoldings)
+	})
 	return r
 }
\ No newline at end of file
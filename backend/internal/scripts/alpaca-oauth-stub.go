@@ -0,0 +1,179 @@
+package scripts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// AlpacaOAuthStub serves a stand-in for Alpaca's OAuth2 provider and the parts of its
+// trading API the backend calls for a linked account, so the connect flow can be exercised
+// locally. Authorization is granted without a consent page. It also serves the stream stub's
+// endpoints. Point the backend at it with
+//
+//	ALPACA_OAUTH_AUTHORIZE_URL=http://localhost:9999/oauth/authorize
+//	ALPACA_OAUTH_TOKEN_URL=http://localhost:9999/oauth/token
+//	ALPACA_OAUTH_REVOKE_URL=http://localhost:9999/oauth/revoke
+//	ALPACA_BASE_URL=http://localhost:9999
+func AlpacaOAuthStub(addr string) error {
+	handler, err := NewAlpacaOAuthStub()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Alpaca OAuth stub listening on %s\n", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+// NewAlpacaOAuthStub returns the stub's handler, for serving it from tests.
+func NewAlpacaOAuthStub() (http.Handler, error) {
+	stub := &alpacaOAuthStub{codes: map[string]string{}, tokens: map[string]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", stub.authorize)
+	mux.HandleFunc("/oauth/token", stub.token)
+	mux.HandleFunc("/oauth/revoke", stub.revoke)
+	mux.HandleFunc("/v2/account", stub.account)
+	mux.HandleFunc("/v2/positions", stub.positions)
+	err := registerStreamStub(mux)
+	if err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+type alpacaOAuthStub struct {
+	mu sync.Mutex
+	// codes maps an unused authorization code to the redirect URI it was issued for
+	codes  map[string]string
+	tokens map[string]bool
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func stubError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": status * 100000, "message": message})
+}
+
+func (s *alpacaOAuthStub) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") == "" {
+		stubError(w, http.StatusBadRequest, "response_type=code and client_id are required")
+		return
+	}
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		stubError(w, http.StatusBadRequest, "invalid redirect_uri")
+		return
+	}
+	code := randomHex()
+	s.mu.Lock()
+	s.codes[code] = query.Get("redirect_uri")
+	s.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *alpacaOAuthStub) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		stubError(w, http.StatusBadRequest, "expected a form POST")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_secret") == "" {
+		stubError(w, http.StatusBadRequest, "unsupported grant")
+		return
+	}
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	redirectURI, ok := s.codes[code]
+	delete(s.codes, code)
+	token := ""
+	if ok && redirectURI == r.PostForm.Get("redirect_uri") {
+		token = "stub-" + randomHex()
+		s.tokens[token] = true
+	}
+	s.mu.Unlock()
+	if token == "" {
+		stubError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token": token,
+		"token_type":   "bearer",
+		"scope":        "account:write trading data",
+	})
+}
+
+func (s *alpacaOAuthStub) revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		stubError(w, http.StatusBadRequest, "expected a form POST")
+		return
+	}
+	s.mu.Lock()
+	delete(s.tokens, r.PostForm.Get("token"))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *alpacaOAuthStub) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[token]
+}
+
+func (s *alpacaOAuthStub) account(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		stubError(w, http.StatusUnauthorized, "access key verification failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"id":              "00000000-0000-0000-0000-000000000000",
+		"account_number":  "PASTUB0001",
+		"status":          "ACTIVE",
+		"currency":        "USD",
+		"cash":            "10000",
+		"portfolio_value": "12000",
+		"equity":          "12000",
+		"last_equity":     "11900",
+	})
+}
+
+func (s *alpacaOAuthStub) positions(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		stubError(w, http.StatusUnauthorized, "access key verification failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode([]map[string]string{{
+		"asset_id":        "b0b6dd9d-8b9b-48a9-ba46-b9d54906e415",
+		"symbol":          "AAPL",
+		"exchange":        "NASDAQ",
+		"asset_class":     "us_equity",
+		"qty":             "10",
+		"qty_available":   "10",
+		"avg_entry_price": "190",
+		"side":            "long",
+		"market_value":    "2000",
+		"cost_basis":      "1900",
+		"unrealized_pl":   "100",
+		"current_price":   "200",
+		"lastday_price":   "198",
+		"change_today":    "0.0101",
+	}})
+}
@@ -0,0 +1,265 @@
+package scripts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// StreamReplay is what the stream stub plays back. Trades are sent round-robin, one a second
+// per subscribed symbol; trade updates are sent once to each trade-updates connection,
+// after the connection's since, and the connection is then held open.
+type StreamReplay struct {
+	Trades       []ReplayTrade       `json:"trades"`
+	TradeUpdates []ReplayTradeUpdate `json:"tradeUpdates"`
+}
+
+type ReplayTrade struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+	Size   uint32  `json:"size"`
+}
+
+// ReplayTradeUpdate is an order event for Alpaca's trade updates stream. Its timestamp
+// follows from its position in the replay.
+type ReplayTradeUpdate struct {
+	Event       string `json:"event"`
+	OrderId     string `json:"orderId"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	Qty         string `json:"qty"`
+	Price       string `json:"price"`
+	PositionQty string `json:"positionQty"`
+}
+
+var defaultStreamReplay = StreamReplay{
+	Trades: []ReplayTrade{
+		{Symbol: "AAPL", Price: 200.00, Size: 100},
+		{Symbol: "TSLA", Price: 250.00, Size: 50},
+		{Symbol: "AAPL", Price: 200.15, Size: 20},
+		{Symbol: "TSLA", Price: 249.60, Size: 10},
+		{Symbol: "AAPL", Price: 199.90, Size: 300},
+		{Symbol: "TSLA", Price: 250.40, Size: 75},
+	},
+	TradeUpdates: []ReplayTradeUpdate{
+		{Event: "new", OrderId: "stub-order-1", Symbol: "AAPL", Side: "sell", Qty: "0", Price: "0", PositionQty: "10"},
+		{Event: "fill", OrderId: "stub-order-1", Symbol: "AAPL", Side: "sell", Qty: "4", Price: "200.15", PositionQty: "6"},
+	},
+}
+
+// loadStreamReplay reads the replay at ALPACA_STREAM_REPLAY, a JSON StreamReplay, or returns
+// the built-in one.
+func loadStreamReplay() (StreamReplay, error) {
+	path := os.Getenv("ALPACA_STREAM_REPLAY")
+	if path == "" {
+		return defaultStreamReplay, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return StreamReplay{}, err
+	}
+	var replay StreamReplay
+	err = json.Unmarshal(data, &replay)
+	return replay, err
+}
+
+// AlpacaStreamStub serves a stand-in for Alpaca's market data stream and trade updates
+// stream that plays back a fixed replay, so the stream consumer can be exercised locally.
+// Credentials are not checked. Point the backend at it with
+//
+//	ALPACA_STREAM_URL=ws://localhost:9998/v2
+//	ALPACA_BASE_URL=http://localhost:9998
+//
+// The Alpaca OAuth stub serves the same endpoints, so a linked stub account streams too.
+func AlpacaStreamStub(addr string) error {
+	mux := http.NewServeMux()
+	err := registerStreamStub(mux)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Alpaca stream stub listening on %s\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func registerStreamStub(mux *http.ServeMux) error {
+	replay, err := loadStreamReplay()
+	if err != nil {
+		return err
+	}
+	stub := &alpacaStreamStub{replay: replay}
+	mux.HandleFunc("/v2/events/trades", stub.tradeUpdates)
+	mux.HandleFunc("/v2/iex", stub.marketData)
+	mux.HandleFunc("/v2/sip", stub.marketData)
+	return nil
+}
+
+type alpacaStreamStub struct {
+	replay StreamReplay
+}
+
+func (s *alpacaStreamStub) tradeUpdates(w http.ResponseWriter, r *http.Request) {
+	since, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	// a reconnection resumes after the last update it saw, so updates are stamped with a
+	// fixed start that makes their order, not the wall clock, decide what is replayed
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for j, update := range s.replay.TradeUpdates {
+		at := start.Add(time.Duration(j) * time.Second)
+		if !at.After(since) {
+			continue
+		}
+		event, err := json.Marshal(map[string]interface{}{
+			"at":           at,
+			"event":        update.Event,
+			"event_id":     fmt.Sprintf("stub-event-%d", j),
+			"execution_id": fmt.Sprintf("stub-execution-%d", j),
+			"order": map[string]string{
+				"id":     update.OrderId,
+				"symbol": update.Symbol,
+				"side":   update.Side,
+			},
+			"qty":          update.Qty,
+			"price":        update.Price,
+			"position_qty": update.PositionQty,
+		})
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", event)
+		if err != nil {
+			return
+		}
+		_ = controller.Flush()
+	}
+	<-r.Context().Done()
+}
+
+// stream messages are maps whose first key must be T, so they are encoded from structs
+type streamStubStatus struct {
+	T   string `msgpack:"T"`
+	Msg string `msgpack:"msg"`
+}
+
+type streamStubSubscription struct {
+	T      string   `msgpack:"T"`
+	Trades []string `msgpack:"trades"`
+	Quotes []string `msgpack:"quotes"`
+}
+
+type streamStubTrade struct {
+	T          string    `msgpack:"T"`
+	Symbol     string    `msgpack:"S"`
+	Id         int64     `msgpack:"i"`
+	Exchange   string    `msgpack:"x"`
+	Price      float64   `msgpack:"p"`
+	Size       uint32    `msgpack:"s"`
+	Timestamp  time.Time `msgpack:"t"`
+	Conditions []string  `msgpack:"c"`
+	Tape       string    `msgpack:"z"`
+}
+
+type streamStubQuote struct {
+	T         string    `msgpack:"T"`
+	Symbol    string    `msgpack:"S"`
+	BidPrice  float64   `msgpack:"bp"`
+	BidSize   uint32    `msgpack:"bs"`
+	AskPrice  float64   `msgpack:"ap"`
+	AskSize   uint32    `msgpack:"as"`
+	Timestamp time.Time `msgpack:"t"`
+}
+
+func streamStubWrite(ctx context.Context, conn *websocket.Conn, messages ...interface{}) error {
+	data, err := msgpack.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	return conn.Write(ctx, websocket.MessageBinary, data)
+}
+
+func (s *alpacaStreamStub) marketData(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	ctx := r.Context()
+
+	err = streamStubWrite(ctx, conn, streamStubStatus{T: "success", Msg: "connected"})
+	if err != nil {
+		return
+	}
+	// auth
+	_, _, err = conn.Read(ctx)
+	if err != nil {
+		return
+	}
+	err = streamStubWrite(ctx, conn, streamStubStatus{T: "success", Msg: "authenticated"})
+	if err != nil {
+		return
+	}
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return
+	}
+	var subscribe struct {
+		Trades []string `msgpack:"trades"`
+		Quotes []string `msgpack:"quotes"`
+	}
+	err = msgpack.Unmarshal(data, &subscribe)
+	if err != nil {
+		return
+	}
+	err = streamStubWrite(ctx, conn, streamStubSubscription{T: "subscription", Trades: subscribe.Trades, Quotes: subscribe.Quotes})
+	if err != nil {
+		return
+	}
+
+	// control messages, such as later subscriptions, are read and ignored
+	go func() {
+		for {
+			if _, _, err := conn.Read(ctx); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var id int64
+	for {
+		sent := false
+		for _, trade := range s.replay.Trades {
+			if !slices.Contains(subscribe.Trades, trade.Symbol) && !slices.Contains(subscribe.Trades, "*") {
+				continue
+			}
+			sent = true
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			id++
+			now := time.Now()
+			err = streamStubWrite(ctx, conn,
+				streamStubQuote{T: "q", Symbol: trade.Symbol, BidPrice: trade.Price - 0.01, BidSize: 1, AskPrice: trade.Price + 0.01, AskSize: 1, Timestamp: now},
+				streamStubTrade{T: "t", Symbol: trade.Symbol, Id: id, Exchange: "V", Price: trade.Price, Size: trade.Size, Timestamp: now, Conditions: []string{"@"}, Tape: "C"},
+			)
+			if err != nil {
+				return
+			}
+		}
+		if !sent {
+			<-ctx.Done()
+			return
+		}
+	}
+}
@@ -15,10 +15,9 @@ import (
 )
 
 var newContractID, _ = hiero.ContractIDFromString("0.0.6532033")
-var marketId = "0xc6c8d3eb24d61523202abed6d47eb676e7f2fef743503b857f8559390318bb10"
 var userEvmAddress = "0x0eab38daf1be107e0981c55bff252f351bd0ee7f"
 
-func TestCall(){
+func TestCall(marketId string){
 	err := godotenv.Load(".env")
 	if err != nil {
 		log.Fatal("Error loading .env file")
@@ -91,7 +90,7 @@ type UserPosition struct {
 	Collateral float64 `json:"collateral"`
 }
 
-func GetUserPosition(userEvmAddress string) (UserPosition, error){
+func GetUserPosition(marketId string, userEvmAddress string) (UserPosition, error){
 	err := godotenv.Load(".env")
 	if err != nil {
 		return UserPosition{}, err
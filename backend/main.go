@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,13 +10,27 @@ import (
 
 	"github.com/divin3circle/hashrexa/backend/internal/app"
 	"github.com/divin3circle/hashrexa/backend/internal/routes"
+	"github.com/divin3circle/hashrexa/backend/internal/scripts"
 )
 
 func main() {
 	var port int
+	var backfillPriceAnalysis bool
+	var alpacaOAuthStub string
+	var alpacaStreamStub string
 	flag.IntVar(&port, "port", 8080, "Port to listen on")
+	flag.BoolVar(&backfillPriceAnalysis, "backfill-price-analysis", false, "Recompute the market price analysis series from contract history and exit")
+	flag.StringVar(&alpacaOAuthStub, "alpaca-oauth-stub", "", "Serve a stub Alpaca OAuth server on this address instead of the API")
+	flag.StringVar(&alpacaStreamStub, "alpaca-stream-stub", "", "Serve a stub Alpaca stream server replaying ALPACA_STREAM_REPLAY on this address instead of the API")
 	flag.Parse()
 
+	if alpacaOAuthStub != "" {
+		log.Fatal(scripts.AlpacaOAuthStub(alpacaOAuthStub))
+	}
+	if alpacaStreamStub != "" {
+		log.Fatal(scripts.AlpacaStreamStub(alpacaStreamStub))
+	}
+
 	app, err := app.NewApplication()
 
 	if err != nil {
@@ -25,6 +40,26 @@ func main() {
 
 	defer app.DB.Close()
 
+	if backfillPriceAnalysis {
+		err = app.PriceFeed.Backfill()
+		if err != nil {
+			log.Fatalf("Failed to backfill price analysis: %v", err)
+		}
+		app.Logger.Printf("Price analysis backfilled")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.Session.Run(ctx)
+	go app.Keeper.Run(ctx)
+	go app.Indexer.Run(ctx)
+	go app.Oracle.Run(ctx)
+	go app.Saga.Run(ctx)
+	go app.ShareLocks.Run(ctx)
+	go app.Reserves.Run(ctx)
+	go app.Stream.Run(ctx)
+
 	r := routes.SetUpRoutes(app)
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
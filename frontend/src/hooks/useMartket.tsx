@@ -18,10 +18,10 @@ import {
   EvmAddress,
 } from "@hashgraph/sdk";
 import { BACKEND_URL, metadata, projectId } from "@/config";
+import { authFetch } from "@/lib/auth";
 import { toast } from "react-hot-toast";
 
 import { PoolPosition } from "@/types";
-import axios from "axios";
 
 const contractId = ContractId.fromString("0.0.6532033");
 const userEvmAddress = "0x0eab38daf1be107e0981c55bff252f351bd0ee7f";
@@ -359,24 +359,26 @@ async function sendLoanStatus(
   const accountId = AccountId.fromString(address).toString();
   const evmAddress = accountIdToEvmAddress(accountId);
   console.log("evmAddress on sendLoanStatus", evmAddress);
-  const response = await axios.post(
+  const response = await authFetch(
+    address,
     `${BACKEND_URL}/user-loan-status/${address}`,
     {
-      collateral_token: "dAAPL",
-      collateral_amount: collateralAmount,
-      borrowed_token: "HASH",
-      borrowed_amount: borrowedAmount,
-      apy: apy,
-    },
-    {
+      method: "POST",
       headers: {
         "Content-Type": "application/json",
       },
+      body: JSON.stringify({
+        collateral_token: "dAAPL",
+        collateral_amount: collateralAmount,
+        borrowed_token: "HASH",
+        borrowed_amount: borrowedAmount,
+        apy: apy,
+      }),
     }
   );
   if (response.status !== 200) {
     console.error("Failed to send loan status:", response.status);
     throw new Error("Failed to send loan status");
   }
-  return response.data;
+  return response.json();
 }
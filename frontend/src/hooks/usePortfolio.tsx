@@ -1,8 +1,10 @@
 import { BACKEND_URL } from "@/config";
+import { authFetch } from "@/lib/auth";
 import { MOCK_TOKENS } from "@/mocks";
 import { AccountBalancesResponse, Portfolio, TokenBalance } from "@/types";
 import { useAppKitAccount } from "@reown/appkit/react-core";
 import { useQuery, useMutation, useQueryClient } from "@tanstack/react-query";
+import { useRef } from "react";
 import toast from "react-hot-toast";
 import { useNavigate } from "react-router-dom";
 import { useAssociate } from "./useAssociate";
@@ -54,15 +56,21 @@ export function useTokenizePortfolio() {
     useAssociate("0.0.6509511");
   const queryClient = useQueryClient();
   const navigate = useNavigate();
+  // one key per tokenization, kept until it succeeds so a retry cannot mint twice
+  const idempotencyKey = useRef<string | null>(null);
   const { mutate, isPending, error, data } = useMutation({
     mutationFn: async () => {
+      const key = (idempotencyKey.current ??= crypto.randomUUID());
       await associate();
+      const message = await tokenizePortfolio(address, key);
+      idempotencyKey.current = null;
+      return message;
     },
-    onSuccess: async () => {
-      toast.success("Portfolio tokenized successfully");
+    onSuccess: async (message) => {
+      // the backend answers 202 while the tokens are still being minted
+      toast.success(message ?? "Portfolio tokenized successfully");
       queryClient.invalidateQueries({ queryKey: ["portfolio-balance"] });
       queryClient.invalidateQueries({ queryKey: ["tokenizedAssets"] });
-      await tokenizePortfolio(address);
       navigate("/wallet");
     },
     onError: (error) => {
@@ -121,23 +129,43 @@ async function getPortfolioBalance(
 ): Promise<Portfolio> {
   if (!userAccountId) {
     console.log("No user account ID");
-    return { portfolioValueUSD: 0, tokenizedAssets: 0, optionsAssets: 0 };
+    return {
+      portfolioValueUSD: 0,
+      tokenizedAssets: 0,
+      positions: 0,
+      netWorth: { items: [], categories: {}, totalUSD: 0 },
+    };
   }
-  const response = await fetch(`${BACKEND_URL}/portfolio/${userAccountId}`);
+  const response = await authFetch(
+    userAccountId,
+    `${BACKEND_URL}/portfolio/${userAccountId}`
+  );
   const data = await response.json();
   return data.portfolio as Portfolio;
 }
 
-async function tokenizePortfolio(userAccountId: string | undefined) {
+async function tokenizePortfolio(
+  userAccountId: string | undefined,
+  idempotencyKey: string
+) {
   if (!userAccountId) {
     console.log("No user account ID");
     return;
   }
-  const response = await fetch(
-    `${BACKEND_URL}/tokenize-portfolio/${userAccountId}`
+  const response = await authFetch(
+    userAccountId,
+    `${BACKEND_URL}/tokenize-portfolio/${userAccountId}`,
+    {
+      method: "POST",
+      headers: { "Idempotency-Key": idempotencyKey },
+    }
   );
+  if (!response.ok) {
+    throw new Error(`Failed to tokenize portfolio: ${response.status}`);
+  }
   const data = await response.json();
   console.log("Tokenized portfolio:", data);
+  return data.message as string | undefined;
 }
 
 async function getTokenBalance(
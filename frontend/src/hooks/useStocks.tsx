@@ -1,52 +1,152 @@
 import { useQuery } from "@tanstack/react-query";
+import { useAppKitAccount } from "@reown/appkit/react-core";
 import {
   Position,
   PositionsResponse,
   Stock,
+  PortfolioHistory,
   PortfolioHistoryData,
+  StockBar,
+  StockHistoricalPrice,
+  StockListing,
+  StockQuote,
 } from "@/types";
 
 import { BACKEND_URL } from "@/config";
+import { authFetch } from "@/lib/auth";
 
 const useStocks = () => {
+  const { address } = useAppKitAccount();
   const { data, isLoading, error } = useQuery<Stock[]>({
-    queryKey: ["stocks"],
-    queryFn: async () => await getStocks(),
+    queryKey: ["stocks", address],
+    queryFn: async () => await getStocks(address),
+    enabled: !!address,
   });
 
   return { data, isLoading, error };
 };
 
 export const useHistorical = () => {
+  const { address } = useAppKitAccount();
   const { data, isLoading, error } = useQuery<PortfolioHistoryData[]>({
-    queryKey: ["portfolio-history"],
-    queryFn: () => getPortfolioHistory(),
+    queryKey: ["portfolio-history", address],
+    queryFn: () => getPortfolioHistory(address),
+    enabled: !!address,
   });
 
   return { data, isLoading, error };
 };
 
-async function getPortfolioHistory(): Promise<PortfolioHistoryData[]> {
-  const response = await fetch(`${BACKEND_URL}/portfolio-history`);
-  const data = await response.json();
+export const useStockCatalog = () => {
+  const { data, isLoading, error } = useQuery<StockListing[]>({
+    queryKey: ["stock-catalog"],
+    queryFn: getStockCatalog,
+  });
 
-  if (!data || !data.history) {
+  return { data, isLoading, error };
+};
+
+export const useStockQuote = (symbol: string | undefined) => {
+  const { data, isLoading, error } = useQuery<StockQuote | null>({
+    queryKey: ["stock-quote", symbol],
+    queryFn: () => getStockQuote(symbol),
+    enabled: !!symbol,
+    refetchInterval: 15000,
+  });
+
+  return { data, isLoading, error };
+};
+
+export const useStockBars = (
+  symbol: string | undefined,
+  timeframe: string = "1D"
+) => {
+  const { data, isLoading, error } = useQuery<StockHistoricalPrice[]>({
+    queryKey: ["stock-bars", symbol, timeframe],
+    queryFn: () => getStockBars(symbol, timeframe),
+    enabled: !!symbol,
+  });
+
+  return { data, isLoading, error };
+};
+
+async function getStockCatalog(): Promise<StockListing[]> {
+  const response = await fetch(`${BACKEND_URL}/stocks`);
+  if (!response.ok) {
+    return [];
+  }
+  const data: { stocks: StockListing[] } = await response.json();
+  return data.stocks;
+}
+
+async function getStockQuote(
+  symbol: string | undefined
+): Promise<StockQuote | null> {
+  const response = await fetch(`${BACKEND_URL}/stocks/${symbol}/quote`);
+  if (!response.ok) {
+    return null;
+  }
+  const data: { quote: StockQuote } = await response.json();
+  return data.quote;
+}
+
+async function getStockBars(
+  symbol: string | undefined,
+  timeframe: string
+): Promise<StockHistoricalPrice[]> {
+  const response = await fetch(
+    `${BACKEND_URL}/stocks/${symbol}/bars?timeframe=${timeframe}`
+  );
+  if (!response.ok) {
+    return [];
+  }
+  const data: { bars: StockBar[] } = await response.json();
+  return data.bars.map((bar) => ({
+    date: new Date(bar.t * 1000).toISOString(),
+    price: bar.close,
+  }));
+}
+
+async function getPortfolioHistory(
+  userAccountId: string | undefined
+): Promise<PortfolioHistoryData[]> {
+  if (!userAccountId) {
+    return [];
+  }
+  const response = await authFetch(
+    userAccountId,
+    `${BACKEND_URL}/portfolio-history/${userAccountId}?period=1M&timeframe=1D`
+  );
+  if (!response.ok) {
     return [];
   }
+  const data: PortfolioHistory = await response.json();
 
-  const history = data.history;
-  const { equity, profit_loss, profit_loss_pct, timestamp } = history;
+  if (!data || !data.history) {
+    return [];
+  }
 
-  return timestamp.map((ts: number, index: number) => ({
-    date: new Date(ts * 1000).toISOString().split("T")[0],
-    equity: parseFloat(equity[index] || "0"),
-    profitLoss: parseFloat(profit_loss[index] || "0"),
-    profitLossPercent: parseFloat(profit_loss_pct[index] || "0"),
+  return data.history.map((point) => ({
+    date: new Date(point.t * 1000).toISOString().split("T")[0],
+    equity: point.equity,
+    profitLoss: point.pnl,
+    profitLossPercent: point.pnl_pct,
   }));
 }
 
-export async function getStocks(): Promise<Stock[]> {
-  const response = await fetch(`${BACKEND_URL}/positions`);
+export async function getStocks(
+  userAccountId: string | undefined
+): Promise<Stock[]> {
+  if (!userAccountId) {
+    return [];
+  }
+  const response = await authFetch(
+    userAccountId,
+    `${BACKEND_URL}/positions/${userAccountId}`
+  );
+  if (!response.ok) {
+    return [];
+  }
   const data: PositionsResponse = await response.json();
   const stocks = await Promise.all(
     data.positions.map((stock) => getStock(stock))
@@ -60,9 +160,9 @@ async function getStock(position: Position): Promise<Stock> {
   return {
     symbol: position.symbol,
     name: position.symbol,
-    price: parseFloat(position.current_price),
-    change: parseFloat(position.change_today),
-    changePercent: parseFloat(position.change_today),
+    price: parseFloat(position.currentPrice),
+    change: parseFloat(position.changeToday),
+    changePercent: parseFloat(position.changeToday),
     logo: stockLogo,
     quantity: parseFloat(position.qty),
   };
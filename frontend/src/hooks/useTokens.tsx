@@ -2,7 +2,6 @@ import { BACKEND_URL } from "@/config";
 import { useQuery } from "@tanstack/react-query";
 import { Stock, TokenizedAsset, FullTokenizedAssets } from "@/types";
 import { useAppKitAccount } from "@reown/appkit/react-core";
-import { getStocks } from "./useStocks";
 
 export function useTokens() {
   const { address } = useAppKitAccount();
@@ -68,6 +67,10 @@ async function getAndProcessTokenizedAssets(
 }
 
 export async function getAppleStockPrice(): Promise<number> {
-  const appleStock = await getStocks();
-  return appleStock.find((stock) => stock.symbol === "AAPL")?.price || 0;
+  const response = await fetch(`${BACKEND_URL}/oracle/AAPL?limit=1`);
+  if (!response.ok) {
+    return 0;
+  }
+  const data = await response.json();
+  return data.latest?.price || 0;
 }
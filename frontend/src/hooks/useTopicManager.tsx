@@ -17,6 +17,7 @@ import { useAppKitAccount } from "@reown/appkit/react";
 import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
 import { useNavigate } from "react-router-dom";
 import { PUBLIC_KEY } from "@/lib/utils";
+import { authFetch } from "@/lib/auth";
 import { useAssociate } from "./useAssociate";
 
 export function useTopicManager() {
@@ -125,7 +126,8 @@ async function registerTopic(
     console.error("No user account id or topic id");
     return false;
   }
-  const data = await fetch(
+  const data = await authFetch(
+    userAccountId,
     `${BACKEND_URL}/auth/register/${userAccountId}/${topicId}`,
     {
       method: "POST",
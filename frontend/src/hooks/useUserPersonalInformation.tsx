@@ -1,4 +1,5 @@
 import { BACKEND_URL } from "@/config";
+import { authFetch } from "@/lib/auth";
 import { UserPersonalInformation } from "@/types";
 import { useAppKitAccount } from "@reown/appkit/react-core";
 import { useQuery } from "@tanstack/react-query";
@@ -19,7 +20,8 @@ export function usePersonalInformation() {
 async function getPersonalInformation(
   address: string
 ): Promise<UserPersonalInformation> {
-  const response = await fetch(
+  const response = await authFetch(
+    address,
     `${BACKEND_URL}/personal-information/${address}`,
     {
       method: "GET",
@@ -0,0 +1,66 @@
+import {
+  DAppConnector,
+  HederaJsonRpcMethod,
+  HederaChainId,
+} from "@hashgraph/hedera-wallet-connect";
+import { LedgerId } from "@hashgraph/sdk";
+import { BACKEND_URL, metadata, projectId } from "@/config";
+
+// signIn has the wallet sign a challenge from the backend, which answers with a session
+// cookie for the account.
+export async function signIn(userAccountId: string) {
+  const challengeResponse = await fetch(
+    `${BACKEND_URL}/auth/challenge/${userAccountId}`,
+    { method: "POST", credentials: "include" }
+  );
+  if (!challengeResponse.ok) {
+    throw new Error("Failed to get sign-in challenge");
+  }
+  const challenge: { message: string } = await challengeResponse.json();
+
+  const dAppConnector = new DAppConnector(
+    metadata,
+    LedgerId.TESTNET,
+    projectId,
+    Object.values(HederaJsonRpcMethod),
+    [],
+    [HederaChainId.Testnet]
+  );
+  await dAppConnector.init();
+  await dAppConnector.openModal();
+
+  const signed = await dAppConnector.signMessage({
+    signerAccountId: `hedera:testnet:${userAccountId}`,
+    message: challenge.message,
+  });
+  const signatureMap = (signed.result as unknown as { signatureMap: string })
+    .signatureMap;
+
+  const sessionResponse = await fetch(
+    `${BACKEND_URL}/auth/session/${userAccountId}`,
+    {
+      method: "POST",
+      credentials: "include",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ message: challenge.message, signatureMap }),
+    }
+  );
+  if (!sessionResponse.ok) {
+    throw new Error("Failed to sign in");
+  }
+}
+
+// authFetch calls a route that needs a session, signing in and retrying once when the
+// backend has none for the account.
+export async function authFetch(
+  userAccountId: string,
+  url: string,
+  init: RequestInit = {}
+) {
+  const response = await fetch(url, { ...init, credentials: "include" });
+  if (response.status !== 401) {
+    return response;
+  }
+  await signIn(userAccountId);
+  return fetch(url, { ...init, credentials: "include" });
+}
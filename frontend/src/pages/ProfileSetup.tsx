@@ -6,8 +6,8 @@ import { Label } from "@/components/ui/label";
 import { UserPersonalInformation } from "@/types";
 import logo from "../../public/icon-dark.png";
 import { useMutation } from "@tanstack/react-query";
-import axios from "axios";
 import { BACKEND_URL } from "@/config";
+import { authFetch } from "@/lib/auth";
 import { useAppKitAccount } from "@reown/appkit/react-core";
 import toast from "react-hot-toast";
 
@@ -15,11 +15,22 @@ function ProfileSetup() {
   const navigate = useNavigate();
   const { address } = useAppKitAccount();
   const { mutate, isPending } = useMutation({
-    mutationFn: (data: UserPersonalInformation) => {
-      return axios.post(
+    mutationFn: async (data: UserPersonalInformation) => {
+      const response = await authFetch(
+        data.userAccountId,
         `${BACKEND_URL}/personal-information/${data.userAccountId}`,
-        data
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify(data),
+        }
       );
+      if (!response.ok) {
+        throw new Error(
+          `Failed to save personal information: ${response.status}`
+        );
+      }
+      return response;
     },
     onSuccess: () => {
       navigate("/profile");
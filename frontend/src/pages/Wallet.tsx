@@ -92,7 +92,7 @@ function Wallet() {
             </div>
             <div className="flex flex-col gap-1 rounded-3xl bg-gray-100 px-2 py-1 border border-gray-300">
               <p className="text-sm text-gray-500">
-                {data.optionsAssets} Stocks Options
+                {data.positions} Stock positions
               </p>
             </div>
           </div>
@@ -37,24 +37,15 @@ export interface UserPersonalInformation {
 }
 
 export interface Position {
-  asset_id: string;
   symbol: string;
-  exchange: string;
-  asset_class: string;
-  asset_marginable: boolean;
   qty: string;
-  qty_available: string;
-  avg_entry_price: string;
-  side: "long" | "short";
-  market_value: string;
-  cost_basis: string;
-  unrealized_pl: string;
-  unrealized_plpc: string;
-  unrealized_intraday_pl: string;
-  unrealized_intraday_plpc: string;
-  current_price: string;
-  lastday_price: string;
-  change_today: string;
+  qtyAvailable: string;
+  avgEntryPrice: string;
+  currentPrice: string;
+  changeToday: string;
+  marketValue: string;
+  costBasis: string;
+  unrealizedPL: string;
 }
 
 export interface PositionsResponse {
@@ -71,10 +62,28 @@ export interface Stock {
   quantity: number;
 }
 
+export interface NetWorthItem {
+  category: string;
+  asset: string;
+  tokenId?: string;
+  marketId?: string;
+  amount: number;
+  priceUSD: number;
+  valueUSD: number;
+  priced: boolean;
+}
+
+export interface NetWorth {
+  items: NetWorthItem[];
+  categories: Record<string, number>;
+  totalUSD: number;
+}
+
 export interface Portfolio {
   portfolioValueUSD: number;
   tokenizedAssets: number;
-  optionsAssets: number;
+  positions: number;
+  netWorth: NetWorth;
 }
 
 export interface Token {
@@ -100,15 +109,41 @@ export interface StockHistoricalPrice {
   price: number;
 }
 
+export interface StockListing {
+  symbol: string;
+  name: string;
+  exchange: string;
+  fractionable: boolean;
+  tokenId: string;
+  tokenSymbol: string;
+}
+
+export interface StockQuote {
+  symbol: string;
+  bidPrice: number;
+  askPrice: number;
+  lastPrice: number;
+  timestamp: string;
+}
+
+export interface StockBar {
+  t: number;
+  open: number;
+  high: number;
+  low: number;
+  close: number;
+  volume: number;
+}
+
+export interface PortfolioHistoryPoint {
+  t: number;
+  equity: number;
+  pnl: number;
+  pnl_pct: number;
+}
+
 export interface PortfolioHistory {
-  history: {
-    base_value: string;
-    equity: string[];
-    profit_loss: string[];
-    profit_loss_pct: string[];
-    timeframe: string;
-    timestamp: number[];
-  };
+  history: PortfolioHistoryPoint[];
 }
 
 export interface PortfolioHistoryData {